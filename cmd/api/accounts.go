@@ -0,0 +1,344 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	accountJobsInterval = time.Minute
+	exportTTL           = 7 * 24 * time.Hour
+	mailDateLayout      = "2 January 2006 15:04 MST"
+)
+
+// @Summary      Delete account
+// @Description  Schedules the authenticated user's account for deletion once the grace period is over. In anonymize mode (the default) reviews and votes are kept under a deleted user; in delete mode they are removed too.
+// @Tags         Users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.DeleteAccountInput  true  "Deletion mode and current password"
+// @Param        If-Match  header  string  false  "ETag of the account version being deleted; 412 if it has changed since"
+// @Success      202    {object}  map[string]data.AccountDeletion
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      412    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me [delete]
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.DeleteAccountInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = data.DeletionAnonymize
+	}
+
+	v := validator.New()
+	if data.ValidateDeletionMode(v, input.Mode); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user, ok := app.requireCurrentPassword(w, r, userID, input.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, int64(user.Version)) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	tx, err := app.models.Users.DB.BeginTx(ctx, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to begin transaction: %w", err))
+		return
+	}
+	defer tx.Rollback()
+
+	deletion, err := app.models.Users.ScheduleDeletion(ctx, tx, user.ID, input.Mode, time.Now().Add(app.config.accounts.deletionGrace))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Outbox.Enqueue(ctx, tx, user.Email, user.Locale, "account_deletion_scheduled.tmpl", map[string]any{
+		"mode":         deletion.Mode,
+		"scheduledFor": deletion.ScheduledFor.UTC().Format(mailDateLayout),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to commit transaction: %w", err))
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"deletion": deletion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Cancel account deletion
+// @Description  Keeps the authenticated user's account, withdrawing a deletion that is still in its grace period
+// @Tags         Users
+// @Security     BearerAuth
+// @Produce      json
+// @Success      204  {object}  nil
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/deletion [delete]
+func (app *application) cancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Users.CancelDeletion(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Export personal data
+// @Description  Starts building a JSON archive of everything stored about the authenticated user. A download link is emailed once it is ready; asking again while it is being built returns the same export.
+// @Tags         Users
+// @Security     BearerAuth
+// @Produce      json
+// @Success      202  {object}  map[string]data.DataExport
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/export [get]
+func (app *application) requestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := app.models.Exports.Request(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"export": export}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Download personal data export
+// @Description  Downloads an export archive with the token from the link that was emailed. Links expire after seven days.
+// @Tags         Users
+// @Produce      json
+// @Param        token  path      string  true  "Download token"
+// @Success      200    {object}  object
+// @Failure      404    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/exports/{token} [get]
+func (app *application) downloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, archive, err := app.models.Exports.GetArchive(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="cinemesis-export-%d.json"`, id))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// runAccountJobs builds requested exports, carries out deletions whose grace
+// period is over, removes expired exports and stale lockouts and refreshes the
+// mean rating, until ctx is cancelled. Like the outbox, it may run on several
+// instances at once.
+func (app *application) runAccountJobs(ctx context.Context) {
+	ticker := time.NewTicker(accountJobsInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil && app.buildNextExport() {
+		}
+		for ctx.Err() == nil && app.purgeNextAccount() {
+		}
+		app.deleteExpiredExports()
+		app.deleteStaleLockouts()
+		app.refreshRatingMean()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// buildNextExport builds the oldest pending export and queues the email with
+// its download link, and reports whether there was one to build.
+func (app *application) buildNextExport() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := func() error {
+		tx, err := app.models.Exports.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		export, err := app.models.Exports.ClaimNext(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		user, err := app.models.Users.Get(ctx, export.UserID)
+		if err != nil {
+			return err
+		}
+
+		token, err := app.models.Exports.Complete(ctx, tx, export, exportTTL)
+		if err != nil {
+			return err
+		}
+
+		err = app.models.Outbox.Enqueue(ctx, tx, user.Email, user.Locale, "data_export_ready.tmpl", map[string]any{
+			"downloadURL": app.config.baseURL + "/v1/exports/" + token,
+			"expiresAt":   export.ExpiresAt.UTC().Format(mailDateLayout),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		app.logger.Info("built data export", "id", export.ID, "user_id", export.UserID)
+		return nil
+	}()
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, data.ErrRecordNotFound):
+		return false
+	default:
+		app.logger.Error("failed to build data export", "error", err.Error())
+		return false
+	}
+}
+
+// purgeNextAccount deletes or anonymizes the next account that is due, and
+// reports whether there was one.
+func (app *application) purgeNextAccount() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	userID, mode, err := app.models.Users.PurgeNextDue(ctx)
+	switch {
+	case err == nil:
+		app.authCache.invalidateUser(userID)
+		app.logger.Info("deleted account", "user_id", userID, "mode", mode)
+		return true
+	case errors.Is(err, data.ErrRecordNotFound):
+		return false
+	default:
+		app.logger.Error("failed to delete account", "error", err.Error())
+		return false
+	}
+}
+
+func (app *application) deleteExpiredExports() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	n, err := app.models.Exports.DeleteExpired(ctx)
+	if err != nil {
+		app.logger.Error("failed to delete expired data exports", "error", err.Error())
+		return
+	}
+	if n > 0 {
+		app.logger.Info("deleted expired data exports", "count", n)
+	}
+}
+
+// deleteStaleLockouts forgets failed attempts that no longer count towards a
+// lockout.
+func (app *application) deleteStaleLockouts() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	n, err := app.models.Lockouts.DeleteStale(ctx, lockoutWindow)
+	if err != nil {
+		app.logger.Error("failed to delete stale lockouts", "error", err.Error())
+		return
+	}
+	if n > 0 {
+		app.logger.Info("deleted stale lockouts", "count", n)
+	}
+}
+
+// refreshRatingMean recomputes the mean rating the weighted rating is built
+// from.
+func (app *application) refreshRatingMean() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := app.models.Movies.RefreshRatingMean(ctx); err != nil {
+		app.logger.Error("failed to refresh mean rating", "error", err.Error())
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"cinemesis/internal/bulk"
+	"cinemesis/internal/data"
+	"cinemesis/internal/filters"
+	"cinemesis/internal/utils"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	maxImportBytes   = 64 << 20
+	importBatchSize  = 500
+	maxImportErrors  = 1000
+	exportPageSize   = 500
+	bulkRequestLimit = 10 * time.Minute
+)
+
+type importReport struct {
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []importRowError `json:"errors"`
+}
+
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// fail records a rejected row. Only the first maxImportErrors rows are listed,
+// Failed keeps counting past that.
+func (r *importReport) fail(row int, errs map[string]string) {
+	r.Failed++
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, importRowError{Row: row, Errors: errs})
+	}
+}
+
+type importRow struct {
+	row        int
+	movie      *data.Movie
+	genreNames []string
+}
+
+// @Summary      Import movies
+// @Description  Streams movies from CSV (title, year, runtime and "|"-separated genres columns), NDJSON, or a TMDB-style JSON array. Rows are validated one by one and stored in batches; the response lists the rows that were rejected.
+// @Tags         Movies
+// @Security     BearerAuth
+// @Accept       text/csv,application/x-ndjson,application/json
+// @Produce      json
+// @Param        format  query     string  false  "Overrides the Content-Type (csv, ndjson, json)"
+// @Success      200     {object}  importReport
+// @Failure      400     {object}  ErrorResponse
+// @Failure      415     {object}  ErrorResponse
+// @Failure      500     {object}  ErrorResponse
+// @Router       /v1/movies/import [post]
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Served from POST /v1/movies/:id, which has no other use.
+	if !app.idParamIs(r, "import") {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	format := utils.ReadString(r.URL.Query(), "format", bulk.FormatFromContentType(r.Header.Get("Content-Type")))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	reader, err := bulk.NewReader(format, r.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, bulk.ErrUnsupportedFormat):
+			app.unsupportedMediaTypeResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	// Large imports take longer than the server's read and write timeouts allow.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(bulkRequestLimit))
+	_ = rc.SetWriteDeadline(time.Now().Add(bulkRequestLimit))
+
+	report := importReport{Errors: []importRowError{}}
+	batch := make([]importRow, 0, importBatchSize)
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.importMovieBatch(r.Context(), batch, &report)
+
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				err = fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			}
+			app.badRequestResponse(w, r, fmt.Errorf("import stopped after %d movies were imported: %w", report.Imported, err))
+			return
+		}
+
+		if record.Errors != nil {
+			report.fail(record.Row, record.Errors)
+			continue
+		}
+
+		genreNames := record.Movie.GenreNames
+		movie := &data.Movie{
+			Title:   record.Movie.Title,
+			Year:    record.Movie.Year,
+			Runtime: record.Movie.Runtime,
+		}
+
+		v := validator.New()
+		data.ValidateGenre(v, &genreNames)
+		data.ValidateMovie(v, movie)
+		if !v.Valid() {
+			report.fail(record.Row, v.Errors)
+			continue
+		}
+
+		batch = append(batch, importRow{row: record.Row, movie: movie, genreNames: genreNames})
+		if len(batch) == importBatchSize {
+			app.importMovieBatch(r.Context(), batch, &report)
+			batch = batch[:0]
+		}
+	}
+
+	app.importMovieBatch(r.Context(), batch, &report)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importMovieBatch stores a batch of validated rows in one transaction. If the
+// transaction fails every row in it is reported as failed and the import goes
+// on with the next batch.
+func (app *application) importMovieBatch(ctx context.Context, batch []importRow, report *importReport) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := app.insertMovieBatch(ctx, batch)
+	if err != nil {
+		app.logger.Error("movie import batch failed", "first_row", batch[0].row, "rows", len(batch), "error", err.Error())
+		for _, row := range batch {
+			report.fail(row.row, map[string]string{"movie": "could not be stored"})
+		}
+		return
+	}
+
+	report.Imported += len(batch)
+}
+
+func (app *application) insertMovieBatch(ctx context.Context, batch []importRow) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := app.models.Movies.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, row := range batch {
+		for _, name := range row.genreNames {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	genres, err := app.models.Genres.UpsertBatch(ctx, tx, names)
+	if err != nil {
+		return fmt.Errorf("failed to upsert genres: %w", err)
+	}
+
+	genresByName := make(map[string]data.Genre, len(genres))
+	for _, genre := range genres {
+		genresByName[genre.Name] = genre
+	}
+
+	for _, row := range batch {
+		err = app.models.Movies.Insert(ctx, tx, row.movie)
+		if err != nil {
+			return fmt.Errorf("failed to create movie from row %d: %w", row.row, err)
+		}
+
+		movieGenres := make([]data.Genre, 0, len(row.genreNames))
+		for _, name := range row.genreNames {
+			movieGenres = append(movieGenres, genresByName[name])
+		}
+
+		err = app.models.Genres.AttachGenresToMovie(ctx, tx, row.movie.ID, movieGenres)
+		if err != nil {
+			return fmt.Errorf("failed to attach genres for row %d: %w", row.row, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// @Summary      Export movies
+// @Description  Streams every movie matching the same filters as the movie listing, as CSV or NDJSON
+// @Tags         Movies
+// @Security     BearerAuth
+// @Produce      text/csv,application/x-ndjson
+// @Param        format     query     string   false  "csv (default) or ndjson"
+// @Param        title      query     string   false  "Filter by movie title"
+// @Param        genres     query     []string false  "Comma-separated list of genre names"
+// @Param        actor      query     string   false  "Only movies with this person in the cast (ID or full name)"
+// @Param        director   query     string   false  "Only movies directed by this person (ID or full name)"
+// @Param        min_rating query     number   false  "Only movies with at least this average rating (0-10)"
+// @Param        sort       query     string   false  "Sort by field, as for the movie listing"
+// @Success      200
+// @Failure      422        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /v1/movies/export [get]
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	v := validator.New()
+	format := utils.ReadString(qs, "format", bulk.FormatCSV)
+	v.Check(validator.PermittedValue(format, bulk.FormatCSV, bulk.FormatNDJSON), "format", validator.CodeNotAllowed, "must be csv or ndjson")
+
+	qs.Del("cursor")
+	qs.Del("page")
+	qs.Del("page_size")
+	movieFilters := filters.ParseMovieFiltersFromQuery(qs, v)
+
+	movieFilters.ValidateMovieFilters(v, movieFilters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// The export walks the whole result set in keyset order, one page at a time.
+	movieFilters.CursorMode = true
+	movieFilters.PageSize = exportPageSize
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	genreIDs, err := app.models.Genres.GetIDsByNames(ctx, movieFilters.Genres)
+	cancel()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(bulkRequestLimit))
+
+	writer, _ := bulk.NewWriter(format, w)
+	started := false
+
+	for {
+		movies, err := app.exportMoviePage(r.Context(), genreIDs, movieFilters)
+		if err != nil {
+			if !started {
+				app.serverErrorResponse(w, r, err)
+			} else {
+				app.logError(r, fmt.Errorf("export aborted: %w", err))
+			}
+			return
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", bulk.ContentType(format))
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, format))
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		var next *filters.Cursor
+		movies, next, _ = filters.TrimCursorPage(movieFilters.PageFilters, movieFilters.CursorSort(), movies,
+			func(m *data.Movie) (string, int64) { return m.SortKey(movieFilters.SortColumn()), m.ID })
+
+		for _, movie := range movies {
+			err = writer.Write(movie)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			app.logError(r, fmt.Errorf("export aborted: %w", err))
+			return
+		}
+
+		if next == nil {
+			return
+		}
+		movieFilters.Cursor = next
+	}
+}
+
+func (app *application) exportMoviePage(ctx context.Context, genreIDs []int64, movieFilters filters.MovieFilters) ([]*data.Movie, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	movies, _, err := app.models.Movies.GetFiltered(ctx, genreIDs, movieFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Genres.LoadGenresForMovies(ctx, movies)
+	if err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
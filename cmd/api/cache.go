@@ -0,0 +1,98 @@
+package main
+
+import (
+	"cinemesis/internal/cache"
+	"cinemesis/internal/data"
+	"context"
+	"crypto/sha256"
+	"time"
+)
+
+// authCache sits in front of the two lookups every authenticated request makes:
+// the user owning a token, and that user's effective permissions. Entries are
+// dropped explicitly whenever the underlying data changes, and otherwise expire
+// after the configured TTL.
+type authCache struct {
+	users       *cache.Cache[[sha256.Size]byte, data.User]
+	permissions *cache.Cache[int64, data.Permissions]
+}
+
+func newAuthCache(size int, ttl time.Duration) *authCache {
+	return &authCache{
+		users:       cache.New[[sha256.Size]byte, data.User](size, ttl),
+		permissions: cache.New[int64, data.Permissions](size, ttl),
+	}
+}
+
+func (c *authCache) stats() map[string]cache.Stats {
+	return map[string]cache.Stats{
+		"users":       c.users.Stats(),
+		"permissions": c.permissions.Stats(),
+	}
+}
+
+// invalidateToken drops the cached user for a single authentication token.
+func (c *authCache) invalidateToken(token string) {
+	c.users.Delete(sha256.Sum256([]byte(token)))
+}
+
+// invalidateUserTokens drops the cached user for every token held by the user.
+func (c *authCache) invalidateUserTokens(userID int64) {
+	c.users.DeleteFunc(func(_ [sha256.Size]byte, user data.User) bool {
+		return user.ID == userID
+	})
+}
+
+// invalidateAllTokens drops every cached token, for when tokens were revoked
+// without us knowing who they belonged to.
+func (c *authCache) invalidateAllTokens() {
+	c.users.Clear()
+}
+
+func (c *authCache) invalidatePermissions(userID int64) {
+	c.permissions.Delete(userID)
+}
+
+// invalidateUser drops everything cached about the user.
+func (c *authCache) invalidateUser(userID int64) {
+	c.invalidateUserTokens(userID)
+	c.invalidatePermissions(userID)
+}
+
+// userForToken returns the user owning an authentication token. The token's
+// last-used time is only recorded on a cache miss, so it is accurate to within
+// the cache TTL.
+func (app *application) userForToken(ctx context.Context, token string) (*data.User, error) {
+	hash := sha256.Sum256([]byte(token))
+
+	if user, ok := app.authCache.users.Get(hash); ok {
+		return &user, nil
+	}
+
+	user, err := app.models.Users.GetForToken(ctx, data.ScopeAuthentication, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Tokens.Touch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	app.authCache.users.Set(hash, *user)
+	return user, nil
+}
+
+func (app *application) permissionsForUser(ctx context.Context, userID int64) (data.Permissions, error) {
+	if permissions, ok := app.authCache.permissions.Get(userID); ok {
+		return permissions, nil
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	app.authCache.permissions.Set(userID, permissions)
+	return permissions, nil
+}
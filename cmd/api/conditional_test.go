@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"cinemesis/internal/data"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	tag := etag(7, []byte(`{"movie":{}}`))
+	assert.Regexp(t, `^"7-[0-9a-f]{16}"$`, tag)
+	assert.NotEqual(t, tag, etag(7, []byte(`{"movie":{"title":"Alien"}}`)))
+
+	version, ok := etagVersion(tag)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), version)
+
+	for _, bad := range []string{`W/"7-abc"`, `"abc"`, `7-abc`, `"x-abc"`} {
+		_, ok := etagVersion(bad)
+		assert.False(t, ok, bad)
+	}
+
+	assert.True(t, noneMatch(`"1-aa", `+tag, tag))
+	assert.True(t, noneMatch(`W/`+tag, tag))
+	assert.True(t, noneMatch(`*`, tag))
+	assert.False(t, noneMatch(`"7-0000000000000000"`, tag))
+	assert.False(t, noneMatch(``, tag))
+}
+
+func TestReviewConditionalRequests(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	app := &application{
+		config: config{env: "testing"},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		models: data.Models{
+			Reviews:     data.ReviewModel{DB: db},
+			Permissions: data.PermissionModel{DB: db},
+		},
+		authCache: newAuthCache(0, 0),
+	}
+
+	author := &data.User{ID: 1, Activated: true}
+
+	// expectShow expects the review to be fetched with the author's own vote.
+	expectShow := func() {
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM reviews r JOIN users u ON r.user_id = u.id LEFT JOIN review_votes rv`)).
+			WithArgs(int64(1), author.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "movie_id", "text", "rating", "upvotes", "downvotes", "created_at", "edited", "version", "user_name", "total_votes", "user_vote"}).
+				AddRow(1, author.ID, 1, "A thoroughly decent film", 7, 0, 0, reviewCreatedAt, false, 2, "Author", 0, 0))
+	}
+
+	// showTag fetches the review as the author and returns its ETag.
+	showTag := func(t *testing.T) string {
+		expectShow()
+		w := httptest.NewRecorder()
+		app.showReviewHandler(w, newReviewTestRequest(app, http.MethodGet, "/v1/reviews/1", nil, author))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Header().Get("ETag")
+	}
+
+	t.Run("Show sets a version ETag", func(t *testing.T) {
+		tag := showTag(t)
+		assert.Regexp(t, `^"2-[0-9a-f]{16}"$`, tag)
+		assert.Equal(t, tag, showTag(t))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Show with matching If-None-Match is not modified", func(t *testing.T) {
+		tag := showTag(t)
+
+		expectShow()
+		req := newReviewTestRequest(app, http.MethodGet, "/v1/reviews/1", nil, author)
+		req.Header.Set("If-None-Match", tag)
+		w := httptest.NewRecorder()
+
+		app.showReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, tag, w.Header().Get("ETag"))
+		assert.Empty(t, w.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update with stale If-Match fails before writing", func(t *testing.T) {
+		req := newReviewTestRequest(app, http.MethodPatch, "/v1/reviews/1", []byte(`{"rating": 9}`), author)
+		req.Header.Set("If-Match", `"1-0123456789abcdef"`)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+
+		app.updateReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update with current If-Match returns new ETag", func(t *testing.T) {
+		tag := showTag(t)
+
+		req := newReviewTestRequest(app, http.MethodPatch, "/v1/reviews/1", []byte(`{"rating": 9}`), author)
+		req.Header.Set("If-Match", tag)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE reviews`)).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), int64(1), int32(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).AddRow(1, reviewCreatedAt, 3))
+
+		app.updateReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Regexp(t, `^"3-`, w.Header().Get("ETag"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Concurrent edit is a precondition failure with If-Match", func(t *testing.T) {
+		tag := showTag(t)
+
+		req := newReviewTestRequest(app, http.MethodPatch, "/v1/reviews/1", []byte(`{"rating": 9}`), author)
+		req.Header.Set("If-Match", tag)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE reviews`)).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}))
+
+		app.updateReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Concurrent edit is a conflict without If-Match", func(t *testing.T) {
+		req := newReviewTestRequest(app, http.MethodPatch, "/v1/reviews/1", []byte(`{"rating": 9}`), author)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE reviews`)).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}))
+
+		app.updateReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Delete with stale If-Match keeps the review", func(t *testing.T) {
+		req := newReviewTestRequest(app, http.MethodDelete, "/v1/reviews/1", nil, author)
+		req.Header.Set("If-Match", `"5-0123456789abcdef"`)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+
+		app.deleteReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Concurrent edit before a delete keeps the review", func(t *testing.T) {
+		tag := showTag(t)
+
+		req := newReviewTestRequest(app, http.MethodDelete, "/v1/reviews/1", nil, author)
+		req.Header.Set("If-Match", tag)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM reviews WHERE id = $1 AND version = $2`)).
+			WithArgs(int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		app.deleteReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
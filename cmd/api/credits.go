@@ -0,0 +1,188 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary      List a movie's credits
+// @Description  Returns the cast and crew of the movie with the specified ID
+// @Tags         Credits
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Movie ID"
+// @Success      200  {object}  []data.Credit
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/movies/{id}/credits [get]
+func (app *application) listMovieCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	_, err = app.models.Movies.Get(ctx, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	credits, err := app.models.Credits.GetForMovie(ctx, movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"credits": credits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Credit a person on a movie
+// @Description  Adds a cast or crew credit to the movie with the specified ID
+// @Tags         Credits
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int               true  "Movie ID"
+// @Param        credit  body      data.CreditInput  true  "Credit JSON"
+// @Success      201     {object}  data.Credit
+// @Failure      400     {object}  ErrorResponse
+// @Failure      404     {object}  ErrorResponse
+// @Failure      422     {object}  ErrorResponse
+// @Failure      500     {object}  ErrorResponse
+// @Router       /v1/movies/{id}/credits [post]
+func (app *application) createMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input data.CreditInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	credit := &data.Credit{
+		PersonID:     input.PersonID,
+		Role:         input.Role,
+		Character:    input.Character,
+		BillingOrder: input.BillingOrder,
+	}
+
+	v := validator.New()
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	_, err = app.models.Movies.Get(ctx, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	person, err := app.models.People.Get(ctx, credit.PersonID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("person_id", validator.CodeNotFound, "no person with this id")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	credit.Name = person.Name
+
+	err = app.models.Credits.Insert(ctx, movieID, credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredit):
+			v.AddError("person_id", validator.CodeAlreadyExists, "is already credited in this role")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/credits", movieID))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"credit": credit}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Remove a credit from a movie
+// @Description  Deletes one cast or crew credit of the movie with the specified ID
+// @Tags         Credits
+// @Security     BearerAuth
+// @Param        id      path  int  true  "Movie ID"
+// @Param        credit  path  int  true  "Credit ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/movies/{id}/credits/{credit} [delete]
+func (app *application) deleteMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+	creditID, err := strconv.ParseInt(params.ByName("credit"), 10, 64)
+	if err != nil || creditID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.Credits.Delete(ctx, movieID, creditID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"cinemesis/internal/mailer"
+	"cinemesis/internal/utils"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// @Summary      List captured mail
+// @Description  Lists messages held by the in-memory mail transport, newest first, so activation and password reset flows can be followed without an SMTP server. Only routed in development with MAIL_TRANSPORT=memory.
+// @Tags         Debug
+// @Produce      json
+// @Param        to   query     string  false  "Only messages sent to this address"
+// @Success      200  {object}  map[string][]mailer.Message
+// @Router       /debug/mail [get]
+func (app *application) listCapturedMailHandler(w http.ResponseWriter, r *http.Request) {
+	to := utils.ReadString(r.URL.Query(), "to", "")
+
+	messages := []mailer.Message{}
+	for _, msg := range app.mailCapture.Messages() {
+		if to == "" || strings.EqualFold(msg.To, to) {
+			messages = append(messages, msg)
+		}
+	}
+	slices.Reverse(messages)
+
+	err := app.writeResponse(w, r, http.StatusOK, envelope{"messages": messages}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
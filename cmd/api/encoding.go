@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// errNotAcceptable is returned by an encoder that can't represent a response.
+var errNotAcceptable = errors.New("response can't be represented in the requested media type")
+
+// responseFormat encodes response envelopes in one media type.
+type responseFormat struct {
+	mediaType string
+	aliases   []string
+	encode    func(data envelope, pretty bool) ([]byte, error)
+}
+
+// responseFormats are the media types responses can be sent in, in order of
+// preference when the Accept header rates several the same.
+var responseFormats = []responseFormat{
+	{mediaType: "application/json", encode: encodeJSON},
+	{mediaType: "text/csv", encode: encodeCSV},
+	{mediaType: "application/xml", aliases: []string{"text/xml"}, encode: encodeXML},
+	{mediaType: "application/msgpack", aliases: []string{"application/vnd.msgpack", "application/x-msgpack"}, encode: encodeMsgpack},
+}
+
+// csvColumns lists the CSV columns of each envelope key holding a list that
+// can be sent as CSV, in order. A response is sent as CSV by writing the first
+// of its keys found here; the other keys, such as the metadata, are left out.
+var csvColumns = map[string][]string{
+	"movies": {
+		"id", "title", "year", "runtime", "genres", "average_rating", "weighted_rating", "rating_count",
+		"in_watchlist", "watched", "updated_at", "version",
+	},
+	"reviews": {
+		"id", "movie_id", "user_id", "user_name", "rating", "text", "upvotes", "downvotes",
+		"total_votes", "user_vote", "edited", "created_at",
+	},
+	"genres": {"id", "name", "version"},
+}
+
+// negotiate picks the response format for the request's Accept header. It
+// reports false if the client accepts none of them.
+func negotiate(r *http.Request) (responseFormat, bool) {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return responseFormats[0], true
+	}
+
+	best, bestQ := responseFormat{}, 0.0
+	for _, f := range responseFormats {
+		if q := acceptQuality(header, f); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// acceptQuality returns the q value an Accept header gives the format, from
+// its most specific matching range.
+func acceptQuality(header string, f responseFormat) float64 {
+	q, specificity := 0.0, -1
+	for accept := range strings.SplitSeq(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		s := -1
+		switch {
+		case mediaType == f.mediaType || slices.Contains(f.aliases, mediaType):
+			s = 2
+		case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(f.mediaType, strings.TrimSuffix(mediaType, "*")):
+			s = 1
+		case mediaType == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+	}
+	return q
+}
+
+// wantsPretty reports whether JSON should be indented: when the request has a
+// pretty parameter that isn't false, and otherwise outside production.
+func (app *application) wantsPretty(r *http.Request) bool {
+	qs := r.URL.Query()
+	if !qs.Has("pretty") {
+		return app.config.env != "production"
+	}
+	pretty, err := strconv.ParseBool(qs.Get("pretty"))
+	return err != nil || pretty
+}
+
+func encodeJSON(data envelope, pretty bool) ([]byte, error) {
+	return marshalJSON(data, pretty)
+}
+
+func encodeMsgpack(data envelope, _ bool) ([]byte, error) {
+	v, err := jsonValue(data)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(msgpackNumbers(v))
+}
+
+// msgpackNumbers converts the json.Numbers in v to integers where they are
+// whole, and floats otherwise, so they are sent as MessagePack numbers.
+func msgpackNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, e := range v {
+			v[key] = msgpackNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = msgpackNumbers(e)
+		}
+	}
+	return v
+}
+
+// encodeCSV writes the first list of the envelope that has CSV columns. Only
+// the columns present in the list are written, so a sparse fieldset gives a
+// narrower table.
+func encodeCSV(data envelope, _ bool) ([]byte, error) {
+	key, ok := csvKey(data)
+	if !ok {
+		return nil, errNotAcceptable
+	}
+
+	v, err := jsonValue(data[key])
+	if err != nil {
+		return nil, err
+	}
+	rows, _ := v.([]any)
+
+	columns := csvColumns[key]
+	if len(rows) > 0 {
+		columns = slices.DeleteFunc(slices.Clone(columns), func(c string) bool {
+			return !slices.ContainsFunc(rows, func(row any) bool {
+				_, ok := row.(map[string]any)[c]
+				return ok
+			})
+		})
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(columns)
+
+	for _, row := range rows {
+		object, _ := row.(map[string]any)
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = csvCell(object[c])
+		}
+		cw.Write(record)
+	}
+
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+func csvKey(data envelope) (string, bool) {
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		if _, ok := csvColumns[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// csvCell formats a JSON value for a CSV cell. Lists of named objects, such as
+// genres, become their names joined by |, as in the bulk export. Text that a
+// spreadsheet would run as a formula is quoted with a leading '.
+func csvCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		cells := make([]string, len(v))
+		for i, e := range v {
+			if object, ok := e.(map[string]any); ok && object["name"] != nil {
+				e = object["name"]
+			}
+			cells[i] = csvCell(e)
+		}
+		return strings.Join(cells, "|")
+	default:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+}
+
+// encodeXML writes the envelope as it appears in JSON, with each member as an
+// element of the same name and each list element as an item element.
+func encodeXML(data envelope, pretty bool) ([]byte, error) {
+	js, err := marshalJSON(data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "\t")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	if err := jsonToXML(dec, enc, "response"); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// jsonToXML copies the next JSON value from dec to enc as an element called
+// name. Streaming the tokens keeps members in the order JSON has them.
+func jsonToXML(dec *json.Decoder, enc *xml.Encoder, name string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := jsonToXML(dec, enc, key.(string)); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for dec.More() {
+				if err := jsonToXML(dec, enc, "item"); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	case nil:
+	case string:
+		err = enc.EncodeToken(xml.CharData(tok))
+	case json.Number:
+		err = enc.EncodeToken(xml.CharData(tok.String()))
+	case bool:
+		err = enc.EncodeToken(xml.CharData(strconv.FormatBool(tok)))
+	}
+	if err != nil {
+		return err
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// jsonValue returns v as it appears in JSON, decoded into maps, slices and
+// scalars, so that other formats carry the same members as the JSON API,
+// custom encodings included. Numbers are kept as json.Number.
+func jsonValue(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var out any
+	if err := dec.Decode(&out); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cinemesis/internal/data"
+	"cinemesis/internal/filters"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                                 "application/json",
+		"*/*":                              "application/json",
+		"text/csv":                         "text/csv",
+		"text/*":                           "text/csv",
+		"application/json;q=0.5, text/csv": "text/csv",
+		"text/xml":                         "application/xml",
+		"application/x-msgpack":            "application/msgpack",
+		"text/csv;q=0, */*;q=0.1":          "application/json",
+	}
+
+	for accept, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.Header.Set("Accept", accept)
+
+		f, ok := negotiate(r)
+		require.True(t, ok, accept)
+		assert.Equal(t, want, f.mediaType, accept)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("Accept", "image/png")
+	_, ok := negotiate(r)
+	assert.False(t, ok)
+}
+
+func TestWriteResponse(t *testing.T) {
+	app := &application{
+		config: config{env: "production"},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	movies := []*data.Movie{
+		{ID: 1, Title: "Alien", Year: 1979, Genres: []data.Genre{{ID: 1, Name: "horror"}, {ID: 2, Name: "sci-fi"}}, Version: 1},
+		{ID: 2, Title: "=HYPERLINK(\"x\")", Year: 2001, Version: 4},
+	}
+	list := envelope{"movies": movies, "metadata": Metadata{CurrentPage: 1}}
+
+	write := func(t *testing.T, target, accept string, env envelope) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		require.NoError(t, app.writeResponse(w, r, http.StatusOK, env, nil))
+		return w
+	}
+
+	t.Run("Compact JSON in production", func(t *testing.T) {
+		w := write(t, "/v1/movies", "", envelope{"genre": data.Genre{ID: 1, Name: "horror"}})
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+		assert.Equal(t, `{"genre":{"id":1,"name":"horror"}}`+"\n", w.Body.String())
+	})
+
+	t.Run("Pretty JSON on request", func(t *testing.T) {
+		w := write(t, "/v1/movies?pretty", "", envelope{"genre": data.Genre{ID: 1, Name: "horror"}})
+		assert.Equal(t, "{\n\t\"genre\": {\n\t\t\"id\": 1,\n\t\t\"name\": \"horror\"\n\t}\n}\n", w.Body.String())
+	})
+
+	t.Run("CSV list", func(t *testing.T) {
+		w := write(t, "/v1/movies", "text/csv", list)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Equal(t, ""+
+			"id,title,year,genres,average_rating,weighted_rating,rating_count,updated_at,version\n"+
+			"1,Alien,1979,horror|sci-fi,0,0,0,0001-01-01T00:00:00Z,1\n"+
+			"2,\"'=HYPERLINK(\"\"x\"\")\",2001,,0,0,0,0001-01-01T00:00:00Z,4\n",
+			w.Body.String())
+	})
+
+	t.Run("CSV of a sparse list", func(t *testing.T) {
+		out, err := sparse(movies, filters.Fieldset{Fields: []string{"id", "title"}})
+		require.NoError(t, err)
+
+		w := write(t, "/v1/movies", "text/csv", envelope{"movies": out})
+		assert.Equal(t, "id,title\n1,Alien\n2,\"'=HYPERLINK(\"\"x\"\")\"\n", w.Body.String())
+	})
+
+	t.Run("Not acceptable", func(t *testing.T) {
+		w := write(t, "/v1/movies/1", "text/csv", envelope{"movie": movies[0]})
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		w = write(t, "/v1/movies", "image/png", list)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		w := write(t, "/v1/genres", "application/xml", envelope{"genres": []data.Genre{{ID: 1, Name: "horror"}}})
+		assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+		assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+			`<response><genres><item><id>1</id><name>horror</name></item></genres></response>`+"\n",
+			w.Body.String())
+	})
+
+	t.Run("MessagePack", func(t *testing.T) {
+		w := write(t, "/v1/movies", "application/msgpack", list)
+		assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+
+		var got struct {
+			Movies []struct {
+				ID     int64  `msgpack:"id"`
+				Title  string `msgpack:"title"`
+				Genres []struct {
+					Name string `msgpack:"name"`
+				} `msgpack:"genres"`
+			} `msgpack:"movies"`
+			Metadata map[string]any `msgpack:"metadata"`
+		}
+		require.NoError(t, msgpack.Unmarshal(w.Body.Bytes(), &got))
+		require.Len(t, got.Movies, 2)
+		assert.Equal(t, int64(1), got.Movies[0].ID)
+		assert.Equal(t, "sci-fi", got.Movies[0].Genres[1].Name)
+		assert.EqualValues(t, 1, got.Metadata["current_page"])
+	})
+
+	t.Run("Versioned responses tag each format", func(t *testing.T) {
+		env := envelope{"genres": []data.Genre{{ID: 1, Name: "horror"}}}
+		tags := map[string]bool{}
+		for _, accept := range []string{"application/json", "text/csv", "application/xml"} {
+			r := httptest.NewRequest(http.MethodGet, "/v1/genres", nil)
+			r.Header.Set("Accept", accept)
+			w := httptest.NewRecorder()
+			require.NoError(t, app.writeVersionedResponse(w, r, http.StatusOK, 1, env, nil))
+			tags[w.Header().Get("ETag")] = true
+		}
+		assert.Len(t, tags, 3)
+	})
+}
+
+func TestCSVCell(t *testing.T) {
+	assert.Equal(t, "", csvCell(nil))
+	assert.Equal(t, "7.5", csvCell(json.Number("7.5")))
+	assert.Equal(t, "true", csvCell(true))
+	assert.Equal(t, "'-1+1", csvCell("-1+1"))
+	assert.Equal(t, "a|b", csvCell([]any{"a", map[string]any{"name": "b"}}))
+	assert.Equal(t, `{"x":1}`, csvCell(map[string]any{"x": 1}))
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"cinemesis/internal/requestid"
+	"cinemesis/internal/validator"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, problemBadRequest, err.Error())
 }
 
 func (app *application) logError(r *http.Request, err error) {
@@ -19,10 +25,25 @@ func (app *application) logError(r *http.Request, err error) {
 		method = r.Method
 		uri    = r.URL.RequestURI()
 	)
-	app.logger.Error(err.Error(), "method", method, "uri", uri)
+	app.logger.Error(err.Error(), "request_id", requestid.FromContext(r.Context()), "method", method, "uri", uri)
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+// errorResponse reports an error of type t. Clients that accept
+// application/problem+json get problem details; everyone else gets the
+// envelope the API has always sent.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, t problemType, message any) {
+	if wantsProblem(r) {
+		if err := writeProblem(w, newProblem(r, status, t, message), app.wantsPretty(r)); err != nil {
+			app.logError(r, err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if v, ok := message.(*validator.Validator); ok {
+		message = v.Errors
+	}
+
 	statusText := http.StatusText(status)
 
 	env := envelope{
@@ -31,7 +52,12 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 		"error":  message,
 	}
 
-	err := app.writeJSON(w, status, env, nil)
+	// The ID lets a client reporting an error point at the matching logs.
+	if id := requestid.FromContext(r.Context()); id != "" {
+		env["request_id"] = id
+	}
+
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -41,49 +67,94 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 	const message = "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, problemServerError, message)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	const message = "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, problemNotFound, message)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	const message = "the %s method is not supported for this resource"
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, fmt.Sprintf(message, r.Method))
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, problemMethodNotAllowed, fmt.Sprintf(message, r.Method))
 }
 
-func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, problemValidationFailed, v)
 }
 
+// editConflictResponse reports that the record changed since it was read. A
+// client that said which version it expected with If-Match is told its
+// precondition failed instead.
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
 	const message = "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, problemEditConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	const message = "the record has changed since the version given in If-Match, fetch it again before retrying"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, problemPreconditionFailed, message)
 }
 
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	const message = "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, problemInvalidCredentials, message)
+}
+
+// tooManyAttemptsResponse refuses an attempt while the client is being held
+// back after failed ones. It is the same whether or not the account exists.
+func (app *application) tooManyAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	const message = "too many attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, problemTooManyAttempts, message)
+}
+
+// setRetryAfter tells the client how long to wait, in whole seconds rounded up
+// so it never comes back too early.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(d)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
 
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
 	const message = "invalid or missing authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, problemInvalidToken, message)
+}
+
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	const message = "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, problemInvalidRefreshToken, message)
 }
 
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	const message = "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, problemAuthRequired, message)
 }
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	const message = "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, problemInactiveAccount, message)
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	const message = "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, problemNotPermitted, message)
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	const message = "the response can't be sent in any media type the Accept header allows; use JSON, or CSV for movie, review and genre lists, XML or MessagePack"
+	app.errorResponse(w, r, http.StatusNotAcceptable, problemNotAcceptable, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	const message = "the request body must be CSV, NDJSON or JSON; set the Content-Type header or the format parameter"
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, problemUnsupportedMediaType, message)
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cinemesis/internal/filters"
+	"encoding/json"
+)
+
+// sparse returns each item cut down to the members the fieldset keeps, for
+// requests with a fields parameter. Without one the items are returned as
+// they are.
+func sparse[T any](items []T, fs filters.Fieldset) (any, error) {
+	if !fs.Sparse() {
+		return items, nil
+	}
+
+	keep := fs.Keep()
+	out := make([]map[string]json.RawMessage, len(items))
+
+	for i, item := range items {
+		js, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(js, &members); err != nil {
+			return nil, err
+		}
+
+		out[i] = make(map[string]json.RawMessage, len(keep))
+		for _, name := range keep {
+			if m, ok := members[name]; ok {
+				out[i][name] = m
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// sparseOne is sparse for a single item.
+func sparseOne[T any](item T, fs filters.Fieldset) (any, error) {
+	items, err := sparse([]T{item}, fs)
+	if err != nil || !fs.Sparse() {
+		return item, err
+	}
+	return items.([]map[string]json.RawMessage)[0], nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cinemesis/internal/data"
+	"cinemesis/internal/filters"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparse(t *testing.T) {
+	movies := []*data.Movie{{ID: 1, Title: "Alien", Year: 1979, Genres: []data.Genre{{ID: 2, Name: "horror"}}, Version: 3}}
+
+	t.Run("Keeps fields and relations", func(t *testing.T) {
+		out, err := sparse(movies, filters.Fieldset{Fields: []string{"id", "title"}, Include: []string{"genres"}})
+		require.NoError(t, err)
+
+		js, err := json.Marshal(out)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"id":1,"title":"Alien","genres":[{"id":2,"name":"horror"}]}]`, string(js))
+	})
+
+	t.Run("Returns items unchanged without fields", func(t *testing.T) {
+		out, err := sparseOne(movies[0], filters.Fieldset{Include: []string{"genres"}})
+		require.NoError(t, err)
+		assert.Same(t, movies[0], out)
+	})
+}
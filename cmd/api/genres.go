@@ -33,12 +33,13 @@ func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if input.Name == "" {
-		app.failedValidationResponse(w, r, map[string]string{"name": "Name is required"})
+	v := validator.New()
+	if v.Check(input.Name != "", "name", validator.CodeRequired, "Name is required"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	createdGenre, err := app.models.Genres.Insert(input.Name)
+	createdGenre, err := app.models.Genres.Insert(r.Context(), input.Name)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -47,7 +48,7 @@ func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Reques
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/genres/create/%d", createdGenre.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"genre": createdGenre}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"genre": createdGenre}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -58,11 +59,12 @@ func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Reques
 // @Tags         Genres
 // @Security     BearerAuth
 // @Accept       json
-// @Produce      json
+// @Produce      json,text/csv,xml,application/msgpack
 // @Param        id   path      int  true  "Movie ID"
 // @Success      200  {object}  []data.Genre
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
+// @Failure      406  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/genres/movie/{id} [get]
 func (app *application) getMovieGenresHandler(w http.ResponseWriter, r *http.Request) {
@@ -89,7 +91,7 @@ func (app *application) getMovieGenresHandler(w http.ResponseWriter, r *http.Req
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/genres/movie/%d", movieID))
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"genres": genres}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genres": genres}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -127,7 +129,7 @@ func (app *application) addGenresToMovieHandler(w http.ResponseWriter, r *http.R
 
 	v := validator.New()
 	if data.ValidateGenre(v, &input.Genres); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -172,7 +174,7 @@ func (app *application) addGenresToMovieHandler(w http.ResponseWriter, r *http.R
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/genres/attach/%d", movieID))
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"genres": genres}, nil)
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"genres": genres}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -186,9 +188,12 @@ func (app *application) addGenresToMovieHandler(w http.ResponseWriter, r *http.R
 // @Produce      json
 // @Param        id     path      int        true  "Movie ID"
 // @Param        genres body      []string   true  "The new genres to associate with the movie"
+// @Param        If-Match  header  string    false  "ETag of the version being changed; 412 if the movie has changed since"
 // @Success      202    {object}  data.Movie
 // @Failure      400    {object}  ErrorResponse
 // @Failure      404    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      412    {object}  ErrorResponse
 // @Failure      500    {object}  ErrorResponse
 // @Router       /v1/genres/update/movie/{id}/ [put]
 func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http.Request) {
@@ -210,7 +215,7 @@ func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http
 
 	v := validator.New()
 	if data.ValidateGenre(v, &input.Genres); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -228,6 +233,10 @@ func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	if !app.checkIfMatch(w, r, int64(movie.Version)) {
+		return
+	}
+
 	tx, err := app.models.Movies.DB.BeginTx(ctx, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -241,6 +250,7 @@ func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	movie.Genres = []data.Genre{}
 	if len(input.Genres) > 0 {
 		genres, err := app.models.Genres.UpsertBatch(ctx, tx, input.Genres)
 		if err != nil {
@@ -253,6 +263,21 @@ func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http
 			app.serverErrorResponse(w, r, err)
 			return
 		}
+
+		movie.Genres = genres
+	}
+
+	// The genres are part of the movie, so replacing them is a new version of
+	// it, made only if no other change got in first.
+	err = app.models.Movies.Update(ctx, tx, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
 	err = tx.Commit()
@@ -264,7 +289,7 @@ func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/genres/detach/movie/%d", movieID))
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"movie": movie}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusAccepted, int64(movie.Version), envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -275,9 +300,10 @@ func (app *application) replaceMovieGenresHandler(w http.ResponseWriter, r *http
 // @Tags         Genres
 // @Security     BearerAuth
 // @Accept       json
-// @Produce      json
+// @Produce      json,text/csv,xml,application/msgpack
 // @Success      200  {object}  []data.Genre
 // @Failure      400  {object}  ErrorResponse
+// @Failure      406  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/genres [get]
 func (app *application) getAllGenresHandler(w http.ResponseWriter, r *http.Request) {
@@ -290,7 +316,7 @@ func (app *application) getAllGenresHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"genres": genres}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genres": genres}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -303,7 +329,10 @@ func (app *application) getAllGenresHandler(w http.ResponseWriter, r *http.Reque
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int     true  "Genre ID"
+// @Param        If-None-Match  header  string  false  "ETag from an earlier response; 304 if unchanged"
 // @Success      200  {object}  data.Genre
+// @Header       200  {string}  ETag  "Entity tag of the genre"
+// @Success      304  "Not modified"
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
@@ -329,7 +358,7 @@ func (app *application) showGenreHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"genre": genre}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(genre.Version), envelope{"genre": genre}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -343,10 +372,13 @@ func (app *application) showGenreHandler(w http.ResponseWriter, r *http.Request)
 // @Produce      json
 // @Param        id   path      int     true  "Genre ID"
 // @Param        genre body      data.Genre true  "Updated genre JSON"
+// @Param        If-Match  header  string  false  "ETag of the version being edited; 412 if the genre has changed since"
 // @Success      200  {object}  data.Genre
+// @Header       200  {string}  ETag  "Entity tag of the updated genre"
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
 // @Failure      409  {object}  ErrorResponse
+// @Failure      412  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/genres/update/{id} [patch]
 func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
@@ -374,26 +406,35 @@ func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Reques
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
-	err = app.models.Genres.Update(ctx, id, *input.Name)
+	genre, err := app.models.Genres.Get(ctx, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	updatedGenre, err := app.models.Genres.Get(ctx, id)
+	if !app.checkIfMatch(w, r, int64(genre.Version)) {
+		return
+	}
+
+	genre.Name = *input.Name
+
+	err = app.models.Genres.Update(ctx, genre)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"genre": updatedGenre}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(genre.Version), envelope{"genre": genre}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -406,8 +447,10 @@ func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Reques
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int     true  "Genre ID"
+// @Param        If-Match  header  string  false  "ETag of the version being deleted; 412 if the genre has changed since"
 // @Success      204  {object}  nil
 // @Failure      404  {object}  ErrorResponse
+// @Failure      412  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/genres/delete/{id} [delete]
 func (app *application) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
@@ -420,11 +463,26 @@ func (app *application) deleteGenreHandler(w http.ResponseWriter, r *http.Reques
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
-	err = app.models.Genres.Delete(ctx, id)
+	// With If-Match the delete is made on the condition that the genre is
+	// still at the version checked, so a change in between isn't lost.
+	if r.Header.Get("If-Match") != "" {
+		var genre *data.Genre
+		genre, err = app.models.Genres.Get(ctx, id)
+		if err == nil {
+			if !app.checkIfMatch(w, r, int64(genre.Version)) {
+				return
+			}
+			err = app.models.Genres.DeleteVersion(ctx, id, genre.Version)
+		}
+	} else {
+		err = app.models.Genres.Delete(ctx, id)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cinemesis/internal/filters"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,11 +18,13 @@ import (
 type envelope map[string]any
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitzero"`
-	PageSize     int `json:"page_size,omitzero"`
-	FirstPage    int `json:"first_page,omitzero"`
-	LastPage     int `json:"last_page,omitzero"`
-	TotalRecords int `json:"total_records,omitzero"`
+	CurrentPage  int    `json:"current_page,omitzero"`
+	PageSize     int    `json:"page_size,omitzero"`
+	FirstPage    int    `json:"first_page,omitzero"`
+	LastPage     int    `json:"last_page,omitzero"`
+	TotalRecords int    `json:"total_records,omitzero"`
+	NextCursor   string `json:"next_cursor,omitzero"`
+	PrevCursor   string `json:"prev_cursor,omitzero"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -37,31 +40,125 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
+// calculateCursorMetadata builds the metadata for a page fetched in cursor mode.
+// Page numbers are meaningless there; the total is only known if it was asked for.
+func (app *application) calculateCursorMetadata(totalRecords, pageSize int, next, prev *filters.Cursor) Metadata {
+	metadata := Metadata{
+		PageSize:     pageSize,
+		TotalRecords: totalRecords,
+	}
+	if next != nil {
+		metadata.NextCursor = app.cursors.Encode(*next)
+	}
+	if prev != nil {
+		metadata.PrevCursor = app.cursors.Encode(*prev)
+	}
+	return metadata
+}
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam reads a positive integer URL parameter, for routes that carry
+// a second ID besides "id".
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+// readUserIDParam reads the "id" URL parameter of a user route. The value "me"
+// resolves to the authenticated user.
+func (app *application) readUserIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	if params.ByName("id") == "me" {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			return 0, errors.New("invalid id parameter")
+		}
+		return user.ID, nil
+	}
+	return app.readIDParam(r)
+}
+
+// idParamIs reports whether the "id" URL parameter is the fixed segment, for
+// the static paths httprouter can only serve through a wildcard beside them,
+// such as /v1/movies/export next to /v1/movies/:id.
+func (app *application) idParamIs(r *http.Request, segment string) bool {
+	return httprouter.ParamsFromContext(r.Context()).ByName("id") == segment
+}
+
+// writeResponse writes data in the format the request's Accept header asks
+// for, or 406 Not Acceptable if there is none it can be sent in.
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	body, mediaType, ok, err := app.encodeResponse(r, data)
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
+	if !ok {
+		app.notAcceptableResponse(w, r)
+		return nil
+	}
 
-	maps.Copy(w.Header(), headers)
+	writeBody(w, status, mediaType, body, headers)
+	return nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(js)
+// encodeResponse encodes data in the negotiated format and returns it with its
+// media type. It reports false if no format the client accepts can hold data.
+func (app *application) encodeResponse(r *http.Request, data envelope) ([]byte, string, bool, error) {
+	format, ok := negotiate(r)
+	if !ok {
+		return nil, "", false, nil
+	}
+
+	body, err := format.encode(data, app.wantsPretty(r))
+	if errors.Is(err, errNotAcceptable) {
+		return nil, "", false, nil
+	}
+	return body, format.mediaType, true, err
+}
+
+// writeJSON writes data as JSON whatever the request accepts, for error
+// responses.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	js, err := marshalJSON(data, app.wantsPretty(r))
+	if err != nil {
+		return err
+	}
+
+	writeBody(w, status, "application/json", js, headers)
 
 	return nil
 }
 
+func marshalJSON(data any, pretty bool) ([]byte, error) {
+	var js []byte
+	var err error
+	if pretty {
+		js, err = json.MarshalIndent(data, "", "\t")
+	} else {
+		js, err = json.Marshal(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+func writeBody(w http.ResponseWriter, status int, mediaType string, body []byte, headers http.Header) {
+	maps.Copy(w.Header(), headers)
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
 	dec := json.NewDecoder(r.Body)
@@ -111,17 +208,3 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	}
 	return nil
 }
-
-func (app *application) background(fn func()) {
-	app.wg.Add(1)
-	go func() {
-		defer app.wg.Done()
-
-		defer func() {
-			if err := recover(); err != nil {
-				app.logger.Error(fmt.Sprintf("%v", err))
-			}
-		}()
-		fn()
-	}()
-}
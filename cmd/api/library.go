@@ -0,0 +1,486 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/filters"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// loadMovieFlags marks the movies the authenticated user has on their watchlist
+// or in their diary. Anonymous requests get no flags.
+func (app *application) loadMovieFlags(ctx context.Context, r *http.Request, movies ...*data.Movie) error {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return nil
+	}
+	return app.models.Watchlist.LoadUserFlags(ctx, user.ID, movies)
+}
+
+// getMovieForInput looks up the movie a request body refers to. A missing movie
+// is a validation error on movie_id rather than a 404 for the route.
+func (app *application) getMovieForInput(ctx context.Context, w http.ResponseWriter, r *http.Request, movieID int64) (*data.Movie, bool) {
+	movie, err := app.models.Movies.Get(ctx, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v := validator.New()
+			v.AddError("movie_id", validator.CodeNotFound, "no movie with this id")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return movie, true
+}
+
+// @Summary      List the watchlist
+// @Description  Returns the movies the authenticated user wants to watch
+// @Tags         Library
+// @Security     BearerAuth
+// @Produce      json
+// @Param        page       query     int     false  "Page number (default is 1)"
+// @Param        page_size  query     int     false  "Page size (default is 20)"
+// @Param        sort       query     string  false  "Sort by field (added_at, title, year), use '-' for descending (default -added_at)"
+// @Success      200        {object}  map[string]interface{}  "watchlist: []WatchlistEntry, metadata: Metadata"
+// @Failure      401        {object}  ErrorResponse
+// @Failure      403        {object}  ErrorResponse
+// @Failure      422        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /v1/users/me/watchlist [get]
+func (app *application) listWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	watchlistFilters := filters.ParseWatchlistFiltersFromQuery(r.URL.Query(), v)
+
+	watchlistFilters.ValidateWatchlistFilters(v, watchlistFilters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	entries, totalRecords, err := app.models.Watchlist.GetAll(ctx, userID, watchlistFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	metadata := calculateMetadata(totalRecords, watchlistFilters.Page, watchlistFilters.PageSize)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"watchlist": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Add to the watchlist
+// @Description  Adds a movie to the authenticated user's watchlist
+// @Tags         Library
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        movie  body      object{movie_id=int}  true  "Movie to add"
+// @Success      201    {object}  data.WatchlistEntry
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/watchlist [post]
+func (app *application) addToWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.MovieID > 0, "movie_id", validator.CodeRequired, "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	movie, ok := app.getMovieForInput(ctx, w, r, input.MovieID)
+	if !ok {
+		return
+	}
+
+	entry := &data.WatchlistEntry{
+		MovieID: movie.ID,
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+	}
+
+	err = app.models.Watchlist.Insert(ctx, userID, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyOnWatchlist):
+			v.AddError("movie_id", validator.CodeAlreadyExists, "is already on the watchlist")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Remove from the watchlist
+// @Description  Removes a movie from the authenticated user's watchlist
+// @Tags         Library
+// @Security     BearerAuth
+// @Param        movie  path  int  true  "Movie ID"
+// @Success      204
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/watchlist/{movie} [delete]
+func (app *application) removeFromWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readNamedIDParam(r, "movie")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.Watchlist.Delete(ctx, userID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      List diary entries
+// @Description  Returns the authenticated user's watched diary
+// @Tags         Library
+// @Security     BearerAuth
+// @Produce      json
+// @Param        movie_id   query     int     false  "Only entries for this movie"
+// @Param        page       query     int     false  "Page number (default is 1)"
+// @Param        page_size  query     int     false  "Page size (default is 20)"
+// @Param        sort       query     string  false  "Sort by field (watched_on, rating, title), use '-' for descending (default -watched_on)"
+// @Success      200        {object}  map[string]interface{}  "diary: []DiaryEntry, metadata: Metadata"
+// @Failure      401        {object}  ErrorResponse
+// @Failure      403        {object}  ErrorResponse
+// @Failure      422        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /v1/users/me/diary [get]
+func (app *application) listDiaryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	diaryFilters := filters.ParseDiaryFiltersFromQuery(r.URL.Query(), v)
+
+	diaryFilters.ValidateDiaryFilters(v, diaryFilters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	entries, totalRecords, err := app.models.Diary.GetAll(ctx, userID, diaryFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	metadata := calculateMetadata(totalRecords, diaryFilters.Page, diaryFilters.PageSize)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"diary": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Log a watched movie
+// @Description  Adds an entry to the authenticated user's diary. watched_on defaults to today.
+// @Tags         Library
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        entry  body      data.DiaryEntryInput  true  "Diary entry"
+// @Success      201    {object}  data.DiaryEntry
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/diary [post]
+func (app *application) createDiaryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.DiaryEntryInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.DiaryEntry{
+		MovieID:   input.MovieID,
+		WatchedOn: input.WatchedOn,
+		Rewatch:   input.Rewatch,
+		Rating:    input.Rating,
+		Notes:     input.Notes,
+	}
+	if entry.WatchedOn == "" {
+		entry.WatchedOn = time.Now().Format(data.DateLayout)
+	}
+
+	v := validator.New()
+	if data.ValidateDiaryEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	movie, ok := app.getMovieForInput(ctx, w, r, entry.MovieID)
+	if !ok {
+		return
+	}
+	entry.Title = movie.Title
+	entry.Year = movie.Year
+
+	err = app.models.Diary.Insert(ctx, userID, entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/diary/%d", entry.ID))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Get a diary entry
+// @Description  Returns one entry of the authenticated user's diary
+// @Tags         Library
+// @Security     BearerAuth
+// @Produce      json
+// @Param        entry  path      int  true  "Diary entry ID"
+// @Success      200    {object}  data.DiaryEntry
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      404    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/diary/{entry} [get]
+func (app *application) showDiaryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	entryID, err := app.readNamedIDParam(r, "entry")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	entry, err := app.models.Diary.Get(ctx, userID, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update a diary entry
+// @Description  Updates the date, rewatch flag, rating or notes of a diary entry
+// @Tags         Library
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        entry  path      int                   true  "Diary entry ID"
+// @Param        input  body      data.DiaryEntryInput  true  "Fields to update (movie_id is ignored)"
+// @Success      200    {object}  data.DiaryEntry
+// @Failure      400    {object}  ErrorResponse
+// @Failure      404    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/diary/{entry} [patch]
+func (app *application) updateDiaryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	entryID, err := app.readNamedIDParam(r, "entry")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	entry, err := app.models.Diary.Get(ctx, userID, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		WatchedOn *string `json:"watched_on"`
+		Rewatch   *bool   `json:"rewatch"`
+		Rating    *uint8  `json:"rating"`
+		Notes     *string `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.WatchedOn != nil {
+		entry.WatchedOn = *input.WatchedOn
+	}
+	if input.Rewatch != nil {
+		entry.Rewatch = *input.Rewatch
+	}
+	if input.Rating != nil {
+		entry.Rating = *input.Rating
+	}
+	if input.Notes != nil {
+		entry.Notes = *input.Notes
+	}
+
+	v := validator.New()
+	if data.ValidateDiaryEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Diary.Update(ctx, userID, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete a diary entry
+// @Description  Deletes one entry of the authenticated user's diary
+// @Tags         Library
+// @Security     BearerAuth
+// @Param        entry  path  int  true  "Diary entry ID"
+// @Success      204
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/diary/{entry} [delete]
+func (app *application) deleteDiaryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	entryID, err := app.readNamedIDParam(r, "entry")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.Diary.Delete(ctx, userID, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// getRouteList loads the list named by the "list" parameter, which must belong
+// to the user in the URL. Private lists of other users are reported as not
+// found, so their existence is not revealed.
+func (app *application) getRouteList(ctx context.Context, w http.ResponseWriter, r *http.Request, ownerID int64) (*data.List, bool) {
+	listID, err := app.readNamedIDParam(r, "list")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	list, err := app.models.Lists.Get(ctx, listID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if list.UserID != ownerID || !list.Public && list.UserID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return list, true
+}
+
+// @Summary      List a user's lists
+// @Description  Returns the custom lists of a user. Other users only see public lists.
+// @Tags         Lists
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      string  true  "User ID or 'me'"
+// @Success      200  {object}  map[string][]data.List
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/{id}/lists [get]
+func (app *application) listUserListsHandler(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := app.readUserIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	lists, err := app.models.Lists.GetForUser(ctx, ownerID, ownerID == app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"lists": lists}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Create a list
+// @Description  Creates a custom list for the authenticated user
+// @Tags         Lists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        list  body      data.ListInput  true  "List JSON"
+// @Success      201   {object}  data.List
+// @Failure      400   {object}  ErrorResponse
+// @Failure      401   {object}  ErrorResponse
+// @Failure      403   {object}  ErrorResponse
+// @Failure      422   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /v1/users/me/lists [post]
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.ListInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		UserID:      userID,
+		Name:        input.Name,
+		Description: input.Description,
+		Public:      input.Public,
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.Lists.Insert(ctx, list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/%d/lists/%d", userID, list.ID))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Get a list
+// @Description  Returns a list with its movies in order. Private lists are only visible to their owner.
+// @Tags         Lists
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id    path      string  true  "User ID or 'me'"
+// @Param        list  path      int     true  "List ID"
+// @Success      200   {object}  data.List
+// @Failure      401   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /v1/users/{id}/lists/{list} [get]
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	ownerID, err := app.readUserIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	list, ok := app.getRouteList(ctx, w, r, ownerID)
+	if !ok {
+		return
+	}
+
+	list.Items, err = app.models.Lists.GetItems(ctx, list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update a list
+// @Description  Updates a list's name, description or visibility. movie_ids, if given, sets the order of the list and must contain each of its movies once.
+// @Tags         Lists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        list   path      int                                                         true  "List ID"
+// @Param        input  body      object{name=string,description=string,public=bool,movie_ids=[]int}  true  "Fields to update"
+// @Success      200    {object}  data.List
+// @Failure      400    {object}  ErrorResponse
+// @Failure      404    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/lists/{list} [patch]
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	list, ok := app.getRouteList(ctx, w, r, userID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Public      *bool   `json:"public"`
+		MovieIDs    []int64 `json:"movie_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Lists.Update(ctx, list, input.MovieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrInvalidListOrder):
+			v.AddError("movie_ids", validator.CodeInvalid, "must contain every movie of the list exactly once")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	list.Items, err = app.models.Lists.GetItems(ctx, list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete a list
+// @Description  Deletes one of the authenticated user's lists
+// @Tags         Lists
+// @Security     BearerAuth
+// @Param        list  path  int  true  "List ID"
+// @Success      204
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/lists/{list} [delete]
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	listID, err := app.readNamedIDParam(r, "list")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.Lists.Delete(ctx, userID, listID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Add a movie to a list
+// @Description  Adds a movie to one of the authenticated user's lists, at the given position or at the end
+// @Tags         Lists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        list  path      int                 true  "List ID"
+// @Param        item  body      data.ListItemInput  true  "Movie to add"
+// @Success      201   {object}  data.ListItem
+// @Failure      400   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      422   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /v1/users/me/lists/{list}/movies [post]
+func (app *application) addListItemHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.ListItemInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	item := &data.ListItem{
+		MovieID:  input.MovieID,
+		Position: input.Position,
+		Note:     input.Note,
+	}
+
+	v := validator.New()
+	if data.ValidateListItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	list, ok := app.getRouteList(ctx, w, r, userID)
+	if !ok {
+		return
+	}
+
+	movie, ok := app.getMovieForInput(ctx, w, r, item.MovieID)
+	if !ok {
+		return
+	}
+	item.Title = movie.Title
+	item.Year = movie.Year
+
+	err = app.models.Lists.AddItem(ctx, list.ID, item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateListItem):
+			v.AddError("movie_id", validator.CodeAlreadyExists, "is already in this list")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Remove a movie from a list
+// @Description  Removes a movie from one of the authenticated user's lists
+// @Tags         Lists
+// @Security     BearerAuth
+// @Param        list   path  int  true  "List ID"
+// @Param        movie  path  int  true  "Movie ID"
+// @Success      204
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/lists/{list}/movies/{movie} [delete]
+func (app *application) removeListItemHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readNamedIDParam(r, "movie")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	list, ok := app.getRouteList(ctx, w, r, userID)
+	if !ok {
+		return
+	}
+
+	err = app.models.Lists.RemoveItem(ctx, list.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
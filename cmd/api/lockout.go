@@ -0,0 +1,258 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// lockoutWindow is how long failures are remembered: a subject with no failure
+// for this long starts over.
+const lockoutWindow = time.Hour
+
+// lockoutPolicy says how failed attempts for one kind of subject are slowed
+// down: after delayAfter failures each attempt has to wait, twice as long as the
+// one before up to maxDelay, and after lockAfter the subject is locked out.
+type lockoutPolicy struct {
+	kind       string
+	delayAfter int
+	maxDelay   time.Duration
+	lockAfter  int
+	lockFor    time.Duration
+}
+
+var (
+	// emailLockout protects a single account from password guessing.
+	emailLockout = lockoutPolicy{kind: data.LockoutEmail, delayAfter: 3, maxDelay: 30 * time.Second, lockAfter: 10, lockFor: 15 * time.Minute}
+	// ipLockout slows down a client guessing across many accounts, with room
+	// for many users behind one NAT.
+	ipLockout = lockoutPolicy{kind: data.LockoutIP, delayAfter: 20, maxDelay: 30 * time.Second, lockAfter: 100, lockFor: 15 * time.Minute}
+	// mailLockout stops password reset and activation emails from being used to
+	// flood an inbox. Every request counts, not just failed ones.
+	mailLockout = lockoutPolicy{kind: data.LockoutMail, delayAfter: 2, maxDelay: 5 * time.Minute, lockAfter: 5, lockFor: time.Hour}
+)
+
+// delay is how long after the last failure the next attempt is refused.
+func (p lockoutPolicy) delay(failures int) time.Duration {
+	if failures < p.delayAfter {
+		return 0
+	}
+
+	d := time.Second
+	for i := p.delayAfter; i < failures && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.maxDelay)
+}
+
+// retryAfter returns how long the subject has to wait before another attempt,
+// or zero if it may try now.
+func (app *application) retryAfter(ctx context.Context, p lockoutPolicy, subject string) (time.Duration, error) {
+	f, err := app.models.Lockouts.Get(ctx, p.kind, subject)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	now := time.Now()
+	if f.Locked(now) {
+		return f.LockedUntil.Sub(now), nil
+	}
+	if now.Sub(f.LastFailureAt) > lockoutWindow {
+		return 0, nil
+	}
+
+	return max(f.LastFailureAt.Add(p.delay(f.Failures)).Sub(now), 0), nil
+}
+
+// recordFailure counts a failed attempt, locking the subject out once it has
+// had too many. It reports whether this attempt started a lockout.
+func (app *application) recordFailure(ctx context.Context, p lockoutPolicy, subject string) (bool, error) {
+	f, err := app.models.Lockouts.RecordFailure(ctx, p.kind, subject, lockoutWindow)
+	if err != nil {
+		return false, err
+	}
+
+	if f.Failures < p.lockAfter {
+		return false, nil
+	}
+
+	return app.models.Lockouts.Lock(ctx, p.kind, subject, time.Now().Add(p.lockFor))
+}
+
+// signInRetryAfter returns how long a sign-in for email from ip has to wait,
+// whichever of the two is held back longer.
+func (app *application) signInRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	emailWait, err := app.retryAfter(ctx, emailLockout, data.LockoutSubject(email))
+	if err != nil {
+		return 0, err
+	}
+
+	ipWait, err := app.retryAfter(ctx, ipLockout, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(emailWait, ipWait), nil
+}
+
+// signInFailed records a failed sign-in for email and ip. user is nil when no
+// account has the address; otherwise its owner is told when it gets locked.
+func (app *application) signInFailed(ctx context.Context, email, ip string, user *data.User) error {
+	locked, err := app.recordFailure(ctx, emailLockout, data.LockoutSubject(email))
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		app.logger.Warn("email locked out", "ip", ip)
+		if user != nil {
+			err = app.notifyLockout(ctx, user, ip)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	locked, err = app.recordFailure(ctx, ipLockout, ip)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		app.logger.Warn("ip locked out", "ip", ip)
+	}
+
+	return nil
+}
+
+// signInSucceeded forgets the failed attempts for email. Those from the IP are
+// kept, so one good account doesn't reset guessing at others.
+func (app *application) signInSucceeded(ctx context.Context, email string) error {
+	err := app.models.Lockouts.Clear(ctx, data.LockoutEmail, data.LockoutSubject(email))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (app *application) notifyLockout(ctx context.Context, user *data.User, ip string) error {
+	tx, err := app.models.Outbox.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = app.models.Outbox.Enqueue(ctx, tx, user.Email, user.Locale, "account_locked.tmpl", map[string]any{
+		"lockedUntil": time.Now().Add(emailLockout.lockFor).UTC().Format(mailDateLayout),
+		"ip":          ip,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// @Summary      List lockouts
+// @Description  Lists the email addresses and IPs currently locked out after too many failed attempts
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string][]data.AuthFailures
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/lockouts [get]
+func (app *application) listLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := app.models.Lockouts.GetLocked(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"lockouts": lockouts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Unlock a user
+// @Description  Lifts the sign-in lockout of a user's email address and forgets its failed attempts
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      204  {object}  nil
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/{id}/lockout [delete]
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Lockouts.Clear(r.Context(), data.LockoutEmail, data.LockoutSubject(user.Email))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Unlock an IP
+// @Description  Lifts the sign-in lockout of a client IP and forgets its failed attempts
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        ip   path      string  true  "Client IP"
+// @Success      204  {object}  nil
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/lockouts/ips/{ip} [delete]
+func (app *application) unlockIPHandler(w http.ResponseWriter, r *http.Request) {
+	ip := httprouter.ParamsFromContext(r.Context()).ByName("ip")
+
+	err := app.models.Lockouts.Clear(r.Context(), data.LockoutIP, ip)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,18 +2,20 @@ package main
 
 import (
 	"cinemesis/internal/data"
+	"cinemesis/internal/filters"
 	"cinemesis/internal/mailer"
+	"cinemesis/internal/ratelimit"
+	"cinemesis/internal/sqltrace"
 	"cinemesis/internal/utils"
 	"cinemesis/internal/vcs"
 	"context"
+	"crypto/rand"
 	"database/sql"
-	"expvar"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -21,7 +23,9 @@ import (
 	_ "cinemesis/docs"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -29,17 +33,19 @@ var (
 )
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port    int
+	env     string
+	baseURL string
+	db      struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  time.Duration
 	}
 	limiter struct {
-		rps     float64
-		burst   int
+		write   ratelimit.Limit
+		read    ratelimit.Limit
+		auth    ratelimit.Limit
 		enabled bool
 	}
 	smtp struct {
@@ -49,17 +55,44 @@ type config struct {
 		password string
 		sender   string
 	}
+	mail struct {
+		transport string
+		dir       string
+	}
 	cors struct {
 		trustedOrigins []string
 	}
+	authCache struct {
+		size int
+		ttl  time.Duration
+	}
+	cursor struct {
+		secret string
+	}
+	metrics struct {
+		addr string
+	}
+	accounts struct {
+		deletionGrace time.Duration
+	}
+	tracing struct {
+		exporter    string
+		sampleRatio float64
+	}
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer *mailer.Mailer
-	wg     sync.WaitGroup
+	config      config
+	logger      *slog.Logger
+	models      data.Models
+	mailer      *mailer.Mailer
+	mailCapture *mailer.MemoryTransport
+	authCache   *authCache
+	limiter     ratelimit.Store
+	cursors     *filters.CursorCodec
+	meters      *appMetrics
+	tracer      trace.Tracer
+	wg          sync.WaitGroup
 }
 
 // NOTE: Swaggo is not compatible with openAPI 3.0, it means
@@ -86,6 +119,7 @@ func main() {
 	// Server
 	flag.IntVar(&cfg.port, "port", utils.GetEnvInt("PORT", 4000), "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.baseURL, "base-url", utils.GetEnvString("BASE_URL", "http://localhost:4000"), "Public URL of the API, used for links in emails")
 
 	// DB
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("POSTGRESQL_CONN"), "PostgreSQL DSN")
@@ -94,8 +128,12 @@ func main() {
 	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", utils.GetEnvDuration("DB_MAX_IDLE_TIME", 15*time.Minute), "PostgreSQL max connection idle time")
 
 	// Limiter
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", utils.GetEnvFloat("LIMITER_RPS", 2), "Rate limiter maximum requests per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", utils.GetEnvInt("LIMITER_BURST", 4), "Rate limiter maximum burst")
+	flag.Float64Var(&cfg.limiter.write.Rate, "limiter-rps", utils.GetEnvFloat("LIMITER_RPS", 2), "Rate limiter maximum requests per second for writes")
+	flag.IntVar(&cfg.limiter.write.Burst, "limiter-burst", utils.GetEnvInt("LIMITER_BURST", 4), "Rate limiter maximum burst for writes")
+	flag.Float64Var(&cfg.limiter.read.Rate, "limiter-read-rps", utils.GetEnvFloat("LIMITER_READ_RPS", 10), "Rate limiter maximum requests per second for reads")
+	flag.IntVar(&cfg.limiter.read.Burst, "limiter-read-burst", utils.GetEnvInt("LIMITER_READ_BURST", 20), "Rate limiter maximum burst for reads")
+	flag.Float64Var(&cfg.limiter.auth.Rate, "limiter-auth-rps", utils.GetEnvFloat("LIMITER_AUTH_RPS", 0.2), "Rate limiter maximum requests per second for sign-in, sign-up and token endpoints")
+	flag.IntVar(&cfg.limiter.auth.Burst, "limiter-auth-burst", utils.GetEnvInt("LIMITER_AUTH_BURST", 5), "Rate limiter maximum burst for sign-in, sign-up and token endpoints")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", utils.GetEnvBool("LIMITER_ENABLED", true), "Enable rate limiter")
 
 	// SMTP
@@ -105,6 +143,27 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SMTP_SENDER"), "SMTP sender")
 
+	// Mail transport
+	flag.StringVar(&cfg.mail.transport, "mail-transport", utils.GetEnvString("MAIL_TRANSPORT", "smtp"), "Mail transport (smtp|file|memory)")
+	flag.StringVar(&cfg.mail.dir, "mail-dir", utils.GetEnvString("MAIL_DIR", "tmp/mail"), "Maildir that the file transport writes messages to")
+
+	// Auth cache
+	flag.IntVar(&cfg.authCache.size, "auth-cache-size", utils.GetEnvInt("AUTH_CACHE_SIZE", 10_000), "Maximum entries in each authentication cache (0 disables caching)")
+	flag.DurationVar(&cfg.authCache.ttl, "auth-cache-ttl", utils.GetEnvDuration("AUTH_CACHE_TTL", time.Minute), "Authentication cache entry lifetime")
+
+	// Pagination cursors
+	flag.StringVar(&cfg.cursor.secret, "cursor-secret", os.Getenv("CURSOR_SECRET"), "Secret used to sign pagination cursors (random per process if empty)")
+
+	// Metrics
+	flag.StringVar(&cfg.metrics.addr, "metrics-addr", os.Getenv("METRICS_ADDR"), "Separate listen address for /metrics, e.g. 127.0.0.1:9090 (served on the API port to admins if empty)")
+
+	// Accounts
+	flag.DurationVar(&cfg.accounts.deletionGrace, "account-deletion-grace", utils.GetEnvDuration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour), "Time before a requested account deletion is carried out, during which it can be cancelled")
+
+	// Tracing
+	flag.StringVar(&cfg.tracing.exporter, "trace-exporter", utils.GetEnvString("TRACE_EXPORTER", "none"), "Trace exporter (none|stdout|otlp)")
+	flag.Float64Var(&cfg.tracing.sampleRatio, "trace-sample-ratio", utils.GetEnvFloat("TRACE_SAMPLE_RATIO", 1), "Fraction of traces started by the API that are recorded")
+
 	// CORS
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
@@ -112,6 +171,7 @@ func main() {
 	})
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
+	checkTemplates := flag.Bool("check-templates", false, "Check that every locale defines all mail templates and exit")
 
 	flag.Parse()
 
@@ -120,7 +180,36 @@ func main() {
 		os.Exit(0)
 	}
 
-	db, err := openDB(cfg)
+	if *checkTemplates {
+		if err := mailer.CheckTemplates(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Mail templates:\t%s\n", strings.Join(mailer.Locales(), ", "))
+		os.Exit(0)
+	}
+
+	tp, shutdownTracing, err := openTracerProvider(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Spans still buffered by the exporter are flushed once the server has
+	// stopped and background work has finished.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("flushing traces failed", "error", err.Error())
+		}
+	}()
+
+	otel.SetTracerProvider(tp)
+
+	logger.Info("tracing configured", "exporter", cfg.tracing.exporter)
+
+	db, err := openDB(cfg, tp)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -130,28 +219,38 @@ func main() {
 
 	logger.Info("database connection pool established")
 
-	mailer, err := mailer.New(
-		cfg.smtp.host,
-		cfg.smtp.port,
-		cfg.smtp.username,
-		cfg.smtp.password,
-		cfg.smtp.sender)
-
+	transport, err := openMailTransport(cfg)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	expvar.NewString("version").Set(version)
-	expvar.Publish("database", expvar.Func(func() any { return db.Stats() }))
-	expvar.Publish("timestamp", expvar.Func(func() any { return time.Now().Unix() }))
-	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	logger.Info("mail transport configured", "transport", cfg.mail.transport)
+
+	// Captured mail is listed by GET /debug/mail in development.
+	mailCapture, _ := transport.(*mailer.MemoryTransport)
+
+	mailer := mailer.New(transport, cfg.smtp.sender)
+
+	cursorSecret := []byte(cfg.cursor.secret)
+	if len(cursorSecret) == 0 {
+		cursorSecret = []byte(rand.Text())
+		logger.Warn("no cursor secret configured, pagination cursors will not survive a restart")
+	}
+
+	authCache := newAuthCache(cfg.authCache.size, cfg.authCache.ttl)
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer,
+		config:      cfg,
+		logger:      logger,
+		models:      data.NewModels(db),
+		mailer:      mailer,
+		mailCapture: mailCapture,
+		authCache:   authCache,
+		limiter:     ratelimit.NewMemory(),
+		cursors:     filters.NewCursorCodec(cursorSecret),
+		meters:      newAppMetrics(db, mailer, authCache),
+		tracer:      tp.Tracer(tracerName),
 	}
 
 	err = app.serve()
@@ -161,13 +260,28 @@ func main() {
 	}
 }
 
-func openDB(cfg config) (*sql.DB, error) {
+func openMailTransport(cfg config) (mailer.Transport, error) {
+	switch cfg.mail.transport {
+	case "smtp":
+		return mailer.NewSMTPTransport(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password)
+	case "file":
+		return mailer.NewFileTransport(cfg.mail.dir)
+	case "memory":
+		return mailer.NewMemoryTransport(100), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.mail.transport)
+	}
+}
 
-	db, err := sql.Open("postgres", cfg.db.dsn)
+func openDB(cfg config, tp trace.TracerProvider) (*sql.DB, error) {
+
+	connector, err := pq.NewConnector(cfg.db.dsn)
 	if err != nil {
 		return nil, err
 	}
 
+	db := sql.OpenDB(sqltrace.Connector(connector, tp, "postgresql"))
+
 	db.SetMaxOpenConns(cfg.db.maxOpenConns)
 	db.SetMaxIdleConns(cfg.db.maxIdleConns)
 	db.SetConnMaxIdleTime(cfg.db.maxIdleTime)
@@ -184,7 +298,8 @@ func openDB(cfg config) (*sql.DB, error) {
 	return db, nil
 }
 
-func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, problemRateLimited, message)
 }
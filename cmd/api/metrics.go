@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cinemesis/internal/mailer"
+	"cinemesis/internal/metrics"
+	"database/sql"
+	"net/http"
+	"runtime"
+)
+
+// appMetrics holds the instruments updated while serving requests. Values that
+// are tracked elsewhere, such as the database pool statistics, are read at
+// scrape time instead.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests         *metrics.CounterVec
+	requestDuration  *metrics.HistogramVec
+	requestsInFlight *metrics.Gauge
+	rateLimited      *metrics.CounterVec
+	outboxPending    *metrics.Gauge
+	outboxDead       *metrics.Gauge
+}
+
+func newAppMetrics(db *sql.DB, mailer *mailer.Mailer, authCache *authCache) *appMetrics {
+	r := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry: r,
+		requests: r.NewCounterVec("http_requests_total",
+			"HTTP requests served, by route pattern, method and status.", "route", "method", "status"),
+		requestDuration: r.NewHistogramVec("http_request_duration_seconds",
+			"Time taken to serve HTTP requests, by route pattern, method and status.", metrics.DefaultBuckets, "route", "method", "status"),
+		requestsInFlight: r.NewGauge("http_requests_in_flight",
+			"HTTP requests currently being served."),
+		rateLimited: r.NewCounterVec("http_rate_limited_total",
+			"Requests rejected by the rate limiter, by class.", "class"),
+		outboxPending: r.NewGauge("email_outbox_pending",
+			"Emails waiting in the outbox to be sent or retried."),
+		outboxDead: r.NewGauge("email_outbox_dead",
+			"Emails the outbox gave up on."),
+	}
+
+	r.NewGaugeFunc("app_build_info", "Always 1, labelled with the running version.",
+		func() float64 { return 1 }, "version", version)
+	r.NewGaugeFunc("go_goroutines", "Goroutines that currently exist.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+
+	r.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	r.NewGaugeFunc("db_open_connections", "Established connections, both in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	r.NewGaugeFunc("db_in_use_connections", "Connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	r.NewGaugeFunc("db_idle_connections", "Idle connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	r.NewCounterFunc("db_wait_count_total", "Connections waited for.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	r.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	r.NewCounterFunc("db_closed_connections_total", "Connections closed by the pool, by reason.",
+		func() float64 { return float64(db.Stats().MaxIdleClosed) }, "reason", "max_idle")
+	r.NewCounterFunc("db_closed_connections_total", "Connections closed by the pool, by reason.",
+		func() float64 { return float64(db.Stats().MaxIdleTimeClosed) }, "reason", "max_idle_time")
+	r.NewCounterFunc("db_closed_connections_total", "Connections closed by the pool, by reason.",
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) }, "reason", "max_lifetime")
+
+	r.NewCounterFunc("mailer_sends_total", "Emails the mailer tried to send, by result.",
+		func() float64 { return float64(mailer.Stats().Sent) }, "result", "success")
+	r.NewCounterFunc("mailer_sends_total", "Emails the mailer tried to send, by result.",
+		func() float64 { return float64(mailer.Stats().Failed) }, "result", "failure")
+
+	for _, name := range []string{"users", "permissions"} {
+		r.NewCounterFunc("auth_cache_hits_total", "Authentication cache hits, by cache.",
+			func() float64 { return float64(authCache.stats()[name].Hits) }, "cache", name)
+		r.NewCounterFunc("auth_cache_misses_total", "Authentication cache misses, by cache.",
+			func() float64 { return float64(authCache.stats()[name].Misses) }, "cache", name)
+		r.NewGaugeFunc("auth_cache_entries", "Entries held by the authentication cache, by cache.",
+			func() float64 { return float64(authCache.stats()[name].Entries) }, "cache", name)
+	}
+
+	return m
+}
+
+// @Summary      Prometheus metrics
+// @Description  Serves request, database, mailer and email outbox metrics in the Prometheus text format. Only routed here when no separate metrics listener is configured.
+// @Tags         Metrics
+// @Security     BearerAuth
+// @Produce      plain
+// @Success      200  {string}  string
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Router       /metrics [get]
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	app.meters.registry.Handler().ServeHTTP(w, r)
+}
+
+// setRoutePattern records the matched route pattern on the metricsResponseWriter
+// wrapping w, so request metrics are labelled by pattern rather than by path.
+func setRoutePattern(w http.ResponseWriter, pattern string) {
+	if mw := findMetricsResponseWriter(w); mw != nil {
+		mw.route = pattern
+	}
+}
+
+// setRequestUser records the authenticated user on the metricsResponseWriter
+// wrapping w, for the access log.
+func setRequestUser(w http.ResponseWriter, userID int64) {
+	if mw := findMetricsResponseWriter(w); mw != nil {
+		mw.userID = userID
+	}
+}
+
+func findMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	for {
+		switch rw := w.(type) {
+		case *metricsResponseWriter:
+			return rw
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -2,20 +2,37 @@ package main
 
 import (
 	"cinemesis/internal/data"
+	"cinemesis/internal/ratelimit"
+	"cinemesis/internal/requestid"
 	"cinemesis/internal/validator"
 	"errors"
-	"expvar"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/tomasen/realip"
-	"golang.org/x/time/rate"
 )
 
+// requestID gives every request an ID, taken from the X-Request-ID header when
+// the client or a proxy in front set a usable one, and generated otherwise. It
+// is echoed in the response and carried in the request context into logs and
+// the emails the request queues.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+
+		r = r.WithContext(requestid.NewContext(r.Context(), id))
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -28,55 +45,131 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// Rate limit classes, each with its own configured limit. Every client has a
+// separate allowance per class, so reading doesn't use up signing in.
+const (
+	limitRead  = "read"
+	limitWrite = "write"
+	limitAuth  = "auth"
+)
+
+// limitClass sorts a request into a rate limit class. Endpoints that check
+// passwords or tokens sent by the client, or that create accounts, are the
+// strictest, as they are the ones worth guessing at.
+func limitClass(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/tokens/"),
+		r.Method == http.MethodPost && r.URL.Path == "/v1/users",
+		r.Method == http.MethodPut && (r.URL.Path == "/v1/users/activated" || r.URL.Path == "/v1/users/email"):
+		return limitAuth
+	case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		return limitRead
+	default:
+		return limitWrite
+	}
+}
+
+func (app *application) limitFor(class string) ratelimit.Limit {
+	switch class {
+	case limitRead:
+		return app.config.limiter.read
+	case limitAuth:
+		return app.config.limiter.auth
+	default:
+		return app.config.limiter.write
+	}
+}
+
+// rateLimit limits each client per class of request. Authenticated clients are
+// limited by user, however many addresses they come from, and anonymous ones by
+// IP. It has to run after authenticate to know the user.
 func (app *application) rateLimit(next http.Handler) http.Handler {
 	if !app.config.limiter.enabled {
 		return next
 	}
 
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := limitClass(r)
+
+		key := class + ":ip:" + realip.FromRequest(r)
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			key = class + ":user:" + strconv.FormatInt(user.ID, 10)
+		}
+
+		if app.allow(w, r, class, key) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow counts the request against key's allowance in the class, setting the
+// RateLimit headers. It reports false, having sent a 429, when the allowance is
+// used up.
+func (app *application) allow(w http.ResponseWriter, r *http.Request, class, key string) bool {
+	res, err := app.limiter.Allow(r.Context(), key, app.limitFor(class))
+	if err != nil {
+		// A shared store being down shouldn't take the API down with it.
+		app.logger.Error("rate limiter unavailable", "error", err.Error())
+		return true
 	}
 
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
 
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
+	if !res.Allowed {
+		app.meters.rateLimited.With(class).Inc()
+		app.rateLimitExceededResponse(w, r, res.RetryAfter)
+		return false
+	}
 
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
+	return true
+}
 
-			mu.Unlock()
-		}
-	}()
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := realip.FromRequest(r)
-		mu.Lock()
+// tokenFailureKey is the key bearer tokens that fail to authenticate count
+// against: the auth allowance of the client's address, as guessing at tokens is
+// guessing at credentials like signing in is.
+func tokenFailureKey(r *http.Request) string {
+	return limitAuth + ":ip:" + realip.FromRequest(r)
+}
 
-		if _, found := clients[ip]; !found {
-			clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
-		}
+// checkTokenFailures reports whether the client's address may still present a
+// bearer token, sending 429 if its failed tokens have used up the allowance.
+// It is checked before the token is looked up, so guesses past the limit cost
+// nothing; tokens that authenticate don't count against it.
+func (app *application) checkTokenFailures(w http.ResponseWriter, r *http.Request) bool {
+	if !app.config.limiter.enabled {
+		return true
+	}
 
-		clients[ip].lastSeen = time.Now()
+	res, err := app.limiter.Peek(r.Context(), tokenFailureKey(r), app.limitFor(limitAuth))
+	if err != nil {
+		app.logger.Error("rate limiter unavailable", "error", err.Error())
+		return true
+	}
 
-		if !clients[ip].limiter.Allow() {
-			mu.Unlock()
-			app.rateLimitExceededResponse(w, r)
-			return
+	if !res.Allowed {
+		app.meters.rateLimited.With(limitAuth).Inc()
+		app.rateLimitExceededResponse(w, r, res.RetryAfter)
+		return false
+	}
+
+	return true
+}
+
+// rejectToken counts a bearer token that failed to authenticate against the
+// client's address, then rejects it.
+func (app *application) rejectToken(w http.ResponseWriter, r *http.Request) {
+	if app.config.limiter.enabled {
+		_, err := app.limiter.Allow(r.Context(), tokenFailureKey(r), app.limitFor(limitAuth))
+		if err != nil {
+			app.logger.Error("rate limiter unavailable", "error", err.Error())
 		}
+	}
 
-		mu.Unlock()
-		next.ServeHTTP(w, r)
-	})
+	app.invalidAuthenticationTokenResponse(w, r)
 }
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -89,31 +182,38 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if !app.checkTokenFailures(w, r) {
+			return
+		}
+
 		headerParts := strings.Split(authorizationHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.rejectToken(w, r)
 			return
 		}
 
 		token := headerParts[1]
 		v := validator.New()
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
+			app.rejectToken(w, r)
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.userForToken(r.Context(), token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
-				app.invalidAuthenticationTokenResponse(w, r)
+				app.rejectToken(w, r)
 			default:
 				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
 
+		setRequestUser(w, user.ID)
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -142,6 +242,8 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 	return app.requireAuthenticatedUser(fn)
 }
 
+// requirePermission only lets the request through if the user holds the given
+// permission code (or admin), either granted directly or through one of their roles.
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -150,7 +252,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 			return
 		}
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.permissionsForUser(r.Context(), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -198,6 +300,9 @@ type metricsResponseWriter struct {
 	wrapped       http.ResponseWriter
 	statusCode    int
 	headerWritten bool
+	bytes         int
+	route         string
+	userID        int64
 }
 
 func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
@@ -218,27 +323,43 @@ func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
 }
 func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
 	mw.headerWritten = true
-	return mw.wrapped.Write(b)
+	n, err := mw.wrapped.Write(b)
+	mw.bytes += n
+	return n, err
 }
 func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
 	return mw.wrapped
 }
-func (app *application) metrics(next http.Handler) http.Handler {
-	var (
-		totalRequestsReceived           = expvar.NewInt("total_requests_received")
-		totalResponsesSent              = expvar.NewInt("total_responses_sent")
-		totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
 
-		totalResponsesSentByStatus = expvar.NewMap("total_responses_sent_by_status")
-	)
+// metrics records every request against the route pattern it matched, which
+// the router sets through setRoutePattern, and writes one access log line for
+// it. Requests that never reach a route, such as rate limited ones or 404s, are
+// recorded with an empty route.
+func (app *application) metrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		totalRequestsReceived.Add(1)
+		app.meters.requestsInFlight.Inc()
+		defer app.meters.requestsInFlight.Dec()
+
 		mw := newMetricsResponseWriter(w)
 		next.ServeHTTP(mw, r)
-		totalResponsesSent.Add(1)
-		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
-		duration := time.Since(start).Microseconds()
-		totalProcessingTimeMicroseconds.Add(duration)
+
+		duration := time.Since(start)
+
+		status := strconv.Itoa(mw.statusCode)
+		app.meters.requests.With(mw.route, r.Method, status).Inc()
+		app.meters.requestDuration.With(mw.route, r.Method, status).Observe(duration.Seconds())
+
+		app.logger.Info("request",
+			"request_id", requestid.FromContext(r.Context()),
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"route", mw.route,
+			"status", mw.statusCode,
+			"bytes", mw.bytes,
+			"duration_ms", float64(duration.Microseconds())/1000,
+			"user_id", mw.userID,
+			"ip", realip.FromRequest(r),
+		)
 	})
 }
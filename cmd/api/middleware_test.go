@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"cinemesis/internal/data"
+	"cinemesis/internal/ratelimit"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedTokensAreRateLimited(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	authCache := newAuthCache(0, 0)
+	app := &application{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		models:    data.Models{Users: data.UserModel{DB: db}},
+		authCache: authCache,
+		limiter:   ratelimit.NewMemory(),
+		meters:    newAppMetrics(db, nil, authCache),
+	}
+	app.config.limiter.enabled = true
+	app.config.limiter.auth = ratelimit.Limit{Rate: 0.001, Burst: 2}
+	app.config.limiter.read = ratelimit.Limit{Rate: 0.001, Burst: 100}
+
+	handler := app.authenticate(app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	get := func(authorization string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("Basic Zm9vOmJhcg=="))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users`)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+
+	// Once the address is out of failed tokens, tokens are no longer looked up.
+	assert.Equal(t, http.StatusTooManyRequests, get("Bearer ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Anonymous reads have their own allowance.
+	assert.Equal(t, http.StatusOK, get(""))
+}
@@ -34,7 +34,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	genresNames := input.GenreNames
 	v := validator.New()
 	if data.ValidateGenre(v, &genresNames); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -45,7 +45,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -87,7 +87,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, fmt.Errorf("failed to write response: %w", err))
 	}
@@ -99,18 +99,35 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int  true  "Movie ID"
+// @Param        id             path      int     true   "Movie ID"
+// @Param        fields         query     string  false  "Comma-separated movie fields to return (e.g. id,title,year); all by default"
+// @Param        include        query     string  false  "Comma-separated relations to embed: genres, credits, top_reviews (default all; empty for none)"
+// @Param        If-None-Match  header    string  false  "ETag from an earlier response; 304 if unchanged"
 // @Success      200  {object}  data.Movie
+// @Header       200  {string}  ETag  "Entity tag of the movie"
+// @Success      304  "Not modified"
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/movies/{id} [get]
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+	if app.idParamIs(r, "export") {
+		app.exportMoviesHandler(w, r)
+		return
+	}
+
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
 
+	v := validator.New()
+	fieldset := filters.ParseMovieFieldsetFromQuery(r.URL.Query())
+	if filters.ValidateFieldset(v, fieldset); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
@@ -125,20 +142,50 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	genres, err := app.models.Genres.GetGenresByMovieID(ctx, movie.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+	if fieldset.Includes("genres") {
+		genres, err := app.models.Genres.GetGenresByMovieID(ctx, movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		movie.Genres = genres
+	}
+
+	if fieldset.Includes("credits") {
+		credits, err := app.models.Credits.GetForMovie(ctx, movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		movie.Credits = credits
 	}
-	movie.Genres = genres
 
-	reviews, err := app.models.Reviews.GetTopMovieReviews(ctx, id, 5)
+	if fieldset.Has("in_watchlist") || fieldset.Has("watched") {
+		err = app.loadMovieFlags(ctx, r, movie)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{}
+
+	if fieldset.Includes("top_reviews") {
+		reviews, err := app.models.Reviews.GetTopMovieReviews(ctx, id, 5)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["reviews"] = reviews
+	}
+
+	env["movie"], err = sparseOne(movie, fieldset)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie, "reviews": reviews}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(movie.Version), env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -149,37 +196,46 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 // @Tags         Movies
 // @Security     BearerAuth
 // @Accept       json
-// @Produce      json
+// @Produce      json,text/csv,xml,application/msgpack
 // @Param        title      query     string   false  "Filter by movie title"
 // @Param        genres     query     []string false  "Comma-separated list of genre names (e.g. genres=Action,Drama)"
+// @Param        actor      query     string   false  "Only movies with this person in the cast (ID or full name)"
+// @Param        director   query     string   false  "Only movies directed by this person (ID or full name)"
 // @Param        page       query     int      false  "Page number (default is 1)"
 // @Param        page_size  query     int      false  "Page size (default is 20)"
-// @Param        sort       query     string   false  "Sort by field (id, title, year, runtime), use '-' for descending (e.g. -title)"
+// @Param        min_rating query     number   false  "Only movies with at least this average rating (0-10)"
+// @Param        sort       query     string   false  "Sort by field (id, title, year, runtime, rating, weighted_rating), use '-' for descending (e.g. -weighted_rating)"
+// @Param        cursor         query  string  false  "Use cursor pagination; empty for the first page, then next_cursor or prev_cursor from the metadata"
+// @Param        include_total  query  bool    false  "Include total_records in cursor mode"
+// @Param        fields         query  string  false  "Comma-separated movie fields to return (e.g. id,title,year); all by default"
+// @Param        include        query  string  false  "Comma-separated relations to embed: genres (default genres; empty for none)"
 // @Success      200        {object}  map[string]interface{}  "movies: []Movie, metadata: Metadata"
 // @Failure      400        {object}  ErrorResponse
 // @Failure      404        {object}  ErrorResponse
+// @Failure      406        {object}  ErrorResponse
 // @Failure      500        {object}  ErrorResponse
 // @Router       /v1/movies [get]
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
-	filters := filters.ParseMovieFiltersFromQuery(r.URL.Query(), v)
+	movieFilters := filters.ParseMovieFiltersFromQuery(r.URL.Query(), v)
+	movieFilters.DecodeCursor(app.cursors, v)
 
-	filters.ValidateMovieFilters(v, filters)
+	movieFilters.ValidateMovieFilters(v, movieFilters)
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
-	genreIDs, err := app.models.Genres.GetIDsByNames(ctx, filters.Genres)
+	genreIDs, err := app.models.Genres.GetIDsByNames(ctx, movieFilters.Genres)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	movies, total_records, err := app.models.Movies.GetFiltered(ctx, genreIDs, filters)
+	movies, total_records, err := app.models.Movies.GetFiltered(ctx, genreIDs, movieFilters)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -190,15 +246,39 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Genres.LoadGenresForMovies(ctx, movies)
+	var metadata Metadata
+	if movieFilters.CursorMode {
+		var next, prev *filters.Cursor
+		movies, next, prev = filters.TrimCursorPage(movieFilters.PageFilters, movieFilters.CursorSort(), movies,
+			func(m *data.Movie) (string, int64) { return m.SortKey(movieFilters.SortColumn()), m.ID })
+		metadata = app.calculateCursorMetadata(total_records, movieFilters.PageSize, next, prev)
+	} else {
+		metadata = calculateMetadata(total_records, movieFilters.Page, movieFilters.PageSize)
+	}
+
+	if movieFilters.Includes("genres") {
+		err = app.models.Genres.LoadGenresForMovies(ctx, movies)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if movieFilters.Has("in_watchlist") || movieFilters.Has("watched") {
+		err = app.loadMovieFlags(ctx, r, movies...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	out, err := sparse(movies, movieFilters.Fieldset)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	metadata := calculateMetadata(total_records, filters.Page, filters.PageSize)
-
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": out, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -212,9 +292,13 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 // @Produce      json
 // @Param        id     path      int        true  "Movie ID"
 // @Param        movie  body      data.MovieInput true  "Updated movie data"
+// @Param        If-Match  header  string  false  "ETag of the version being edited; 412 if the movie has changed since"
 // @Success      200    {object}  data.Movie
+// @Header       200    {string}  ETag  "Entity tag of the updated movie"
 // @Failure      400    {object}  ErrorResponse
 // @Failure      404    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      412    {object}  ErrorResponse
 // @Failure      500    {object}  ErrorResponse
 // @Router       /v1/movies/{id} [patch]
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -238,6 +322,10 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !app.checkIfMatch(w, r, int64(movie.Version)) {
+		return
+	}
+
 	var input struct {
 		Title      *string       `json:"title"`
 		Year       *int32        `json:"year"`
@@ -263,7 +351,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -278,7 +366,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		genresNames := *input.GenreNames
 		v := validator.New()
 		if data.ValidateGenre(v, &genresNames); !v.Valid() {
-			app.failedValidationResponse(w, r, v.Errors)
+			app.failedValidationResponse(w, r, v)
 			return
 		}
 
@@ -307,7 +395,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(movie.Version), envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -319,9 +407,11 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int  true  "Movie ID"
+// @Param        id        path      int     true   "Movie ID"
+// @Param        If-Match  header    string  false  "ETag of the version being deleted; 412 if the movie has changed since"
 // @Success      200  {object}  map[string]string
 // @Failure      404  {object}  ErrorResponse
+// @Failure      412  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/movies/{id} [delete]
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
@@ -331,20 +421,35 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
-	err = app.models.Movies.Delete(ctx, id)
+	// With If-Match the delete is made on the condition that the movie is
+	// still at the version checked, so a change in between isn't lost.
+	if r.Header.Get("If-Match") != "" {
+		var movie *data.Movie
+		movie, err = app.models.Movies.Get(ctx, id)
+		if err == nil {
+			if !app.checkIfMatch(w, r, int64(movie.Version)) {
+				return
+			}
+			err = app.models.Movies.DeleteVersion(ctx, id, movie.Version)
+		}
+	} else {
+		err = app.models.Movies.Delete(ctx, id)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
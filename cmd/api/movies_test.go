@@ -577,9 +577,10 @@ func TestRateLimitExceededResponse(t *testing.T) {
 		req.Header.Set("Authorization", "Bearer valid_token")
 		w := httptest.NewRecorder()
 
-		app.rateLimitExceededResponse(w, req)
+		app.rateLimitExceededResponse(w, req, 1500*time.Millisecond)
 
 		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "2", w.Header().Get("Retry-After"))
 		var resp envelope
 		err := json.NewDecoder(w.Body).Decode(&resp)
 		assert.NoError(t, err)
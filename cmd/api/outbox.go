@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/mailer"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	// outboxLease must comfortably exceed the time one send can take, or a slow
+	// send could be claimed and delivered a second time. Emails are claimed one
+	// at a time, so the lease never has to cover more than one send.
+	outboxLease       = time.Minute
+	outboxMaxAttempts = 10
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 6 * time.Hour
+)
+
+// runOutbox delivers emails from the outbox until ctx is cancelled. Several
+// instances may run against the same database; claims use SKIP LOCKED, so each
+// email is handed to one of them at a time.
+func (app *application) runOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		app.drainOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainOutbox sends due emails one by one until none are left. Each is claimed
+// just before it is sent, so its lease starts with its own send rather than
+// with the first of a batch. An email that is being sent when ctx is cancelled
+// is still finished and recorded.
+func (app *application) drainOutbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		email, err := app.claimOutbox()
+		if err != nil {
+			app.logger.Error("failed to claim outbox email", "error", err.Error())
+			break
+		}
+		if email == nil {
+			break
+		}
+
+		app.deliverOutboxEmail(email)
+	}
+
+	app.updateOutboxDepth()
+}
+
+// claimOutbox claims the next due email, returning nil if there is none.
+func (app *application) claimOutbox() (*data.OutboxEmail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	emails, err := app.models.Outbox.Claim(ctx, 1, outboxLease)
+	if err != nil || len(emails) == 0 {
+		return nil, err
+	}
+	return emails[0], nil
+}
+
+func (app *application) deliverOutboxEmail(email *data.OutboxEmail) {
+	sendErr := app.mailer.Send(email.Recipient, email.Locale, email.Template, email.Data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var err error
+	switch {
+	case sendErr == nil:
+		app.logger.Info("email sent", "id", email.ID, "template", email.Template, "request_id", email.RequestID)
+		err = app.models.Outbox.MarkSent(ctx, email.ID)
+	case errors.Is(sendErr, mailer.ErrTemplate) || email.Attempts >= outboxMaxAttempts:
+		app.logger.Error("giving up on email", "id", email.ID, "template", email.Template, "request_id", email.RequestID, "attempts", email.Attempts, "error", sendErr.Error())
+		err = app.models.Outbox.MarkDead(ctx, email.ID, sendErr.Error())
+	default:
+		retryAt := time.Now().Add(outboxBackoff(email.Attempts))
+		app.logger.Warn("email delivery failed", "id", email.ID, "template", email.Template, "request_id", email.RequestID, "attempts", email.Attempts, "retry_at", retryAt, "error", sendErr.Error())
+		err = app.models.Outbox.Retry(ctx, email.ID, retryAt, sendErr.Error())
+	}
+
+	// If recording the outcome fails, the lease runs out and the email is sent
+	// again: delivery is at least once.
+	if err != nil {
+		app.logger.Error("failed to update outbox email", "id", email.ID, "request_id", email.RequestID, "error", err.Error())
+	}
+}
+
+func (app *application) updateOutboxDepth() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	depth, err := app.models.Outbox.Depth(ctx)
+	if err != nil {
+		app.logger.Error("failed to read outbox depth", "error", err.Error())
+		return
+	}
+
+	app.meters.outboxPending.Set(depth.Pending)
+	app.meters.outboxDead.Set(depth.Dead)
+}
+
+// outboxBackoff is the delay before retrying after the given number of
+// attempts: exponential from outboxBaseBackoff, capped at outboxMaxBackoff, with
+// up to 20% jitter so failures from one outage don't retry in lockstep.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, outboxMaxBackoff)
+
+	return backoff + rand.N(backoff/5+1)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/filters"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// @Summary      Create a person
+// @Description  Adds an actor, director or other crew member
+// @Tags         People
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        person  body      data.PersonInput  true  "Person JSON"
+// @Success      201     {object}  data.Person
+// @Failure      400     {object}  ErrorResponse
+// @Failure      422     {object}  ErrorResponse
+// @Failure      500     {object}  ErrorResponse
+// @Router       /v1/people [post]
+func (app *application) createPersonHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.PersonInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	person := &data.Person{
+		Name:      input.Name,
+		BirthYear: input.BirthYear,
+		Biography: input.Biography,
+	}
+
+	v := validator.New()
+	if data.ValidatePerson(v, person); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.People.Insert(ctx, person)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"person": person}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Get a person by ID
+// @Description  Returns the person with the specified ID
+// @Tags         People
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Person ID"
+// @Success      200  {object}  data.Person
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/people/{id} [get]
+func (app *application) showPersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	person, err := app.models.People.Get(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"person": person}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      List people
+// @Description  Returns a filtered list of people with optional sorting and pagination
+// @Tags         People
+// @Security     BearerAuth
+// @Produce      json
+// @Param        name       query     string  false  "Filter by name"
+// @Param        page       query     int     false  "Page number (default is 1)"
+// @Param        page_size  query     int     false  "Page size (default is 20)"
+// @Param        sort       query     string  false  "Sort by field (id, name), use '-' for descending"
+// @Success      200        {object}  map[string]interface{}  "people: []Person, metadata: Metadata"
+// @Failure      422        {object}  ErrorResponse
+// @Failure      500        {object}  ErrorResponse
+// @Router       /v1/people [get]
+func (app *application) listPeopleHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	peopleFilters := filters.ParsePeopleFiltersFromQuery(r.URL.Query(), v)
+
+	peopleFilters.ValidatePeopleFilters(v, peopleFilters)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	people, totalRecords, err := app.models.People.GetFiltered(ctx, peopleFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	metadata := calculateMetadata(totalRecords, peopleFilters.Page, peopleFilters.PageSize)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"people": people, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update a person
+// @Description  Updates the person with the specified ID
+// @Tags         People
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int               true  "Person ID"
+// @Param        person  body      data.PersonInput  true  "Fields to update"
+// @Success      200     {object}  data.Person
+// @Failure      400     {object}  ErrorResponse
+// @Failure      404     {object}  ErrorResponse
+// @Failure      409     {object}  ErrorResponse
+// @Failure      422     {object}  ErrorResponse
+// @Failure      500     {object}  ErrorResponse
+// @Router       /v1/people/{id} [patch]
+func (app *application) updatePersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	person, err := app.models.People.Get(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		BirthYear *int32  `json:"birth_year"`
+		Biography *string `json:"biography"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+	if input.BirthYear != nil {
+		person.BirthYear = *input.BirthYear
+	}
+	if input.Biography != nil {
+		person.Biography = *input.Biography
+	}
+
+	v := validator.New()
+	if data.ValidatePerson(v, person); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.People.Update(ctx, person)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"person": person}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete a person
+// @Description  Deletes the person with the specified ID along with their credits
+// @Tags         People
+// @Security     BearerAuth
+// @Param        id   path  int  true  "Person ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/people/{id} [delete]
+func (app *application) deletePersonHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	err = app.models.People.Delete(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Get a person's filmography
+// @Description  Returns every movie the person is credited on, newest first
+// @Tags         People
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Person ID"
+// @Success      200  {object}  map[string]interface{}  "person: Person, movies: []FilmographyEntry"
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/people/{id}/movies [get]
+func (app *application) listPersonMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	person, err := app.models.People.Get(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movies, err := app.models.Credits.GetForPerson(ctx, person.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"person": person, "movies": movies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"cinemesis/internal/requestid"
+	"cinemesis/internal/validator"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// problemTypeBase prefixes the slug of every problem type. The resulting URIs
+// identify the kind of error and are part of the API; they are not meant to be
+// fetched.
+const problemTypeBase = "urn:cinemesis:problem:"
+
+// problemType is a kind of error, reported as the type and title of an RFC 9457
+// problem details response.
+type problemType struct {
+	slug  string
+	title string
+}
+
+var (
+	problemBadRequest           = problemType{"bad-request", "Bad request"}
+	problemNotFound             = problemType{"not-found", "Resource not found"}
+	problemMethodNotAllowed     = problemType{"method-not-allowed", "Method not allowed"}
+	problemValidationFailed     = problemType{"validation-failed", "Validation failed"}
+	problemEditConflict         = problemType{"edit-conflict", "Edit conflict"}
+	problemPreconditionFailed   = problemType{"precondition-failed", "Precondition failed"}
+	problemInvalidCredentials   = problemType{"invalid-credentials", "Invalid credentials"}
+	problemTooManyAttempts      = problemType{"too-many-attempts", "Too many attempts"}
+	problemRateLimited          = problemType{"rate-limited", "Rate limit exceeded"}
+	problemInvalidToken         = problemType{"invalid-token", "Invalid authentication token"}
+	problemInvalidRefreshToken  = problemType{"invalid-refresh-token", "Invalid refresh token"}
+	problemAuthRequired         = problemType{"authentication-required", "Authentication required"}
+	problemInactiveAccount      = problemType{"inactive-account", "Account not activated"}
+	problemNotPermitted         = problemType{"not-permitted", "Not permitted"}
+	problemNotAcceptable        = problemType{"not-acceptable", "Not acceptable"}
+	problemUnsupportedMediaType = problemType{"unsupported-media-type", "Unsupported media type"}
+	problemServerError          = problemType{"server-error", "Internal server error"}
+)
+
+func (t problemType) uri() string {
+	return problemTypeBase + t.slug
+}
+
+// Problem is an RFC 9457 problem details response, sent instead of
+// ErrorResponse to clients that accept application/problem+json.
+type Problem struct {
+	Type      string         `json:"type" example:"urn:cinemesis:problem:validation-failed"`
+	Title     string         `json:"title" example:"Validation failed"`
+	Status    int            `json:"status" example:"422"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance" example:"/v1/movies"`
+	RequestID string         `json:"request_id,omitempty"`
+	Errors    []ProblemField `json:"errors,omitempty"`
+}
+
+// ProblemField is one invalid field of a validation-failed problem.
+type ProblemField struct {
+	Field   string `json:"field" example:"genres[2]"`
+	Pointer string `json:"pointer" example:"/genres/2"`
+	Code    string `json:"code" example:"required"`
+	Message string `json:"message" example:"must be provided"`
+}
+
+// wantsProblem reports whether the client asked for problem details, by
+// listing application/problem+json in its Accept header.
+func wantsProblem(r *http.Request) bool {
+	for accept := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || mediaType != "application/problem+json" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// newProblem describes an error for the request. A string message becomes the
+// detail and a validator's errors become the errors list, sorted by field and
+// with every error of each field.
+func newProblem(r *http.Request, status int, t problemType, message any) Problem {
+	p := Problem{
+		Type:      t.uri(),
+		Title:     t.title,
+		Status:    status,
+		Instance:  r.URL.Path,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+
+	switch m := message.(type) {
+	case string:
+		p.Detail = m
+	case *validator.Validator:
+		p.Detail = "the request has invalid fields, see errors"
+		for _, field := range slices.Sorted(maps.Keys(m.Fields)) {
+			for _, fe := range m.Fields[field] {
+				p.Errors = append(p.Errors, ProblemField{
+					Field:   field,
+					Pointer: validator.Pointer(field),
+					Code:    fe.Code,
+					Message: fe.Message,
+				})
+			}
+		}
+	}
+
+	return p
+}
+
+func writeProblem(w http.ResponseWriter, p Problem, pretty bool) error {
+	js, err := marshalJSON(p, pretty)
+	if err != nil {
+		return err
+	}
+
+	writeBody(w, p.Status, "application/problem+json", js, nil)
+
+	return nil
+}
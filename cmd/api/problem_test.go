@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cinemesis/internal/validator"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWantsProblem(t *testing.T) {
+	tests := map[string]bool{
+		"":                         false,
+		"application/json":         false,
+		"application/problem+json": true,
+		"application/json, application/problem+json;q=0.9": true,
+		"application/problem+json;q=0":                     false,
+		"*/*":                                              false,
+	}
+
+	for accept, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, want, wantsProblem(r), accept)
+	}
+}
+
+func TestFailedValidationResponse(t *testing.T) {
+	app := &application{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	v := validator.New()
+	v.Check(false, "title", validator.CodeRequired, "must be provided")
+	v.Check(false, "runtime", validator.CodeRequired, "must be provided")
+	v.Check(false, "runtime", validator.CodeOutOfRange, "must be a positive integer")
+	v.Check(false, validator.Index("genres", 1), validator.CodeRequired, "must not contain empty values")
+
+	t.Run("Legacy envelope", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.failedValidationResponse(w, httptest.NewRequest(http.MethodPost, "/v1/movies", nil), v)
+
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var body struct {
+			Status string            `json:"status"`
+			Code   int               `json:"code"`
+			Error  map[string]string `json:"error"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+		assert.Equal(t, "unprocessable_entity", body.Status)
+		assert.Equal(t, map[string]string{
+			"title":     "must be provided",
+			"runtime":   "must be provided",
+			"genres[1]": "must not contain empty values",
+		}, body.Error)
+	})
+
+	t.Run("Problem details", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+		r.Header.Set("Accept", "application/problem+json")
+
+		w := httptest.NewRecorder()
+		app.failedValidationResponse(w, r, v)
+
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+		var p Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+		assert.Equal(t, "urn:cinemesis:problem:validation-failed", p.Type)
+		assert.Equal(t, "Validation failed", p.Title)
+		assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+		assert.Equal(t, "/v1/movies", p.Instance)
+		assert.Equal(t, []ProblemField{
+			{Field: "genres[1]", Pointer: "/genres/1", Code: validator.CodeRequired, Message: "must not contain empty values"},
+			{Field: "runtime", Pointer: "/runtime", Code: validator.CodeRequired, Message: "must be provided"},
+			{Field: "runtime", Pointer: "/runtime", Code: validator.CodeOutOfRange, Message: "must be a positive integer"},
+			{Field: "title", Pointer: "/title", Code: validator.CodeRequired, Message: "must be provided"},
+		}, p.Errors)
+	})
+}
+
+func TestProblemDetail(t *testing.T) {
+	app := &application{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/abc", nil)
+	r.Header.Set("Accept", "application/problem+json")
+
+	w := httptest.NewRecorder()
+	app.badRequestResponse(w, r, errors.New("invalid id parameter"))
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var p Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, "urn:cinemesis:problem:bad-request", p.Type)
+	assert.Equal(t, "invalid id parameter", p.Detail)
+	assert.Empty(t, p.Errors)
+}
@@ -12,41 +12,51 @@ import (
 )
 
 // @Summary      Create a new review
-// @Description  Creates a new review and stores it in the database
+// @Description  Creates a new review authored by the authenticated user
 // @Tags         Reviews
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        review  body      data.Review  true  "Review JSON"
+// @Param        review  body      data.ReviewInput  true  "Review JSON"
 // @Success      201    {object}  data.Review
 // @Failure      400    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
 // @Failure      500    {object}  ErrorResponse
 // @Router       /v1/reviews [post]
 func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
-	var reviewInput data.Review
+	var input data.ReviewInput
 
-	err := app.readJSON(w, r, &reviewInput)
+	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	user := app.contextGetUser(r)
+
+	review := &data.Review{
+		UserID:  user.ID,
+		MovieID: input.MovieID,
+		Text:    input.Text,
+		Rating:  input.Rating,
+	}
+
 	v := validator.New()
-	if data.ValidateReview(v, &reviewInput); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	err = app.models.Reviews.Insert(&reviewInput)
+	err = app.models.Reviews.Insert(r.Context(), review)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/review/%d", reviewInput.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/reviews/%d", review.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"review": reviewInput}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"review": review}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -59,7 +69,10 @@ func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Reque
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "The id of the review to retrieve"
+// @Param        If-None-Match  header  string  false  "ETag from an earlier response; 304 if unchanged"
 // @Success      200  {object}  data.Review
+// @Header       200  {string}  ETag  "Entity tag of the review"
+// @Success      304  "Not modified"
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
@@ -90,7 +103,7 @@ func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(review.Version), envelope{"review": review}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -101,7 +114,7 @@ func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request
 // @Tags         Reviews
 // @Security     BearerAuth
 // @Accept       json
-// @Produce      json
+// @Produce      json,text/csv,xml,application/msgpack
 // @Param        id         path      int     true   "Movie ID"
 // @Param        rating     query     string  false  "Sort by rating (presence of parameter enables sorting)"
 // @Param        upvotes    query     string  false  "Sort by upvotes (presence of parameter enables sorting)"
@@ -109,9 +122,13 @@ func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request
 // @Param        desc       query     string  false  "Sort in descending order (presence of parameter enables DESC)"
 // @Param        page       query     int     false  "Page number (default is 1)"
 // @Param        page_size  query     int     false  "Page size (default is 20)"
+// @Param        cursor         query  string  false  "Use cursor pagination; empty for the first page, then next_cursor or prev_cursor from the metadata"
+// @Param        include_total  query  bool    false  "Include total_records in cursor mode"
+// @Param        fields         query  string  false  "Comma-separated review fields to return (e.g. id,rating,text); all by default"
 // @Success      200        {object}  map[string]interface{}  "reviews: []ReviewWithUser, metadata: Metadata"
 // @Failure      400        {object}  ErrorResponse
 // @Failure      404        {object}  ErrorResponse
+// @Failure      406        {object}  ErrorResponse
 // @Failure      500        {object}  ErrorResponse
 // @Router       /v1/movies/{id}/reviews [get]
 func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.Request) {
@@ -123,11 +140,12 @@ func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.R
 
 	v := validator.New()
 	reviewFilters := filters.ParseReviewFiltersFromQuery(r.URL.Query(), v)
+	reviewFilters.DecodeCursor(app.cursors, v)
 	reviewFilters.MovieID = movieID
 
 	reviewFilters.ValidateReviewFilters(v, reviewFilters)
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -150,9 +168,23 @@ func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	metadata := calculateMetadata(totalRecords, reviewFilters.Page, reviewFilters.PageSize)
+	var metadata Metadata
+	if reviewFilters.CursorMode {
+		var next, prev *filters.Cursor
+		reviews, next, prev = filters.TrimCursorPage(reviewFilters.PageFilters, reviewFilters.CursorSort(), reviews,
+			func(rv *data.ReviewWithUser) (string, int64) { return rv.SortKey(reviewFilters.SortBy), rv.ID })
+		metadata = app.calculateCursorMetadata(totalRecords, reviewFilters.PageSize, next, prev)
+	} else {
+		metadata = calculateMetadata(totalRecords, reviewFilters.Page, reviewFilters.PageSize)
+	}
+
+	out, err := sparse(reviews, reviewFilters.Fieldset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": out, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -163,21 +195,25 @@ func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.R
 // @Tags         Reviews
 // @Security     BearerAuth
 // @Accept       json
-// @Produce      json
-// @Param        id         path      int     true   "User ID"
+// @Produce      json,text/csv,xml,application/msgpack
+// @Param        id         path      string  true   "User ID, or me for the authenticated user"
 // @Param        rating     query     string  false  "Sort by rating"
 // @Param        upvotes    query     string  false  "Sort by upvotes"
 // @Param        date       query     string  false  "Sort by date"
 // @Param        desc       query     string  false  "Sort in descending order"
 // @Param        page       query     int     false  "Page number (default is 1)"
 // @Param        page_size  query     int     false  "Page size (default is 20)"
+// @Param        cursor         query  string  false  "Use cursor pagination; empty for the first page, then next_cursor or prev_cursor from the metadata"
+// @Param        include_total  query  bool    false  "Include total_records in cursor mode"
+// @Param        fields         query  string  false  "Comma-separated review fields to return (e.g. id,rating,text); all by default"
 // @Success      200        {object}  map[string]interface{}  "reviews: []Reviews, metadata: Metadata"
 // @Failure      400        {object}  ErrorResponse
 // @Failure      404        {object}  ErrorResponse
+// @Failure      406        {object}  ErrorResponse
 // @Failure      500        {object}  ErrorResponse
 // @Router       /v1/users/{id}/reviews [get]
 func (app *application) listUserReviewsHandler(w http.ResponseWriter, r *http.Request) {
-	userReviewsID, err := app.readIDParam(r)
+	userReviewsID, err := app.readUserIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
@@ -185,11 +221,12 @@ func (app *application) listUserReviewsHandler(w http.ResponseWriter, r *http.Re
 
 	v := validator.New()
 	reviewFilters := filters.ParseReviewFiltersFromQuery(r.URL.Query(), v)
+	reviewFilters.DecodeCursor(app.cursors, v)
 	reviewFilters.UserID = userReviewsID
 
 	reviewFilters.ValidateReviewFilters(v, reviewFilters)
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
@@ -212,9 +249,23 @@ func (app *application) listUserReviewsHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	metadata := calculateMetadata(totalRecords, reviewFilters.Page, reviewFilters.PageSize)
+	var metadata Metadata
+	if reviewFilters.CursorMode {
+		var next, prev *filters.Cursor
+		reviews, next, prev = filters.TrimCursorPage(reviewFilters.PageFilters, reviewFilters.CursorSort(), reviews,
+			func(rv *data.ReviewWithUser) (string, int64) { return rv.SortKey(reviewFilters.SortBy), rv.ID })
+		metadata = app.calculateCursorMetadata(totalRecords, reviewFilters.PageSize, next, prev)
+	} else {
+		metadata = calculateMetadata(totalRecords, reviewFilters.Page, reviewFilters.PageSize)
+	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	out, err := sparse(reviews, reviewFilters.Fieldset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": out, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -272,7 +323,7 @@ func (app *application) voteForReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "vote successful"}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "vote successful"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -283,11 +334,12 @@ func (app *application) voteForReview(w http.ResponseWriter, r *http.Request) {
 // @Tags         Reviews
 // @Security     BearerAuth
 // @Accept       json
-// @Produce      json
+// @Produce      json,text/csv,xml,application/msgpack
 // @Param        id   path      int  true  "Movie ID"
 // @Success      200  {object}  map[string]interface{}  "reviews: []ReviewWithUser"
 // @Failure      400  {object}  ErrorResponse
 // @Failure      404  {object}  ErrorResponse
+// @Failure      406  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
 // @Router       /v1/movies/{id}/reviews/top [get]
 func (app *application) listMovieTopReviewsHandler(w http.ResponseWriter, r *http.Request) {
@@ -311,7 +363,7 @@ func (app *application) listMovieTopReviewsHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"reviews": reviews}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -319,19 +371,24 @@ func (app *application) listMovieTopReviewsHandler(w http.ResponseWriter, r *htt
 
 // @Summary      Update a review
 // @Description  Updates the text and/or rating of a review with the specified ID.
+// @Description  Only the author or a user with the reviews:moderate permission may update it.
 // @Tags         Reviews
 // @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        id     path      int     true  "Review ID"
-// @Param        review body      data.Review  true  "Updated review data"
+// @Param        review body      data.ReviewInput  true  "Updated review data"
+// @Param        If-Match  header  string  false  "ETag of the version being edited; 412 if the review has changed since"
 // @Success      200    {object}  data.Review
+// @Header       200    {string}  ETag  "Entity tag of the updated review"
 // @Failure      400    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
 // @Failure      404    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      412    {object}  ErrorResponse
 // @Failure      500    {object}  ErrorResponse
 // @Router       /v1/reviews/{id} [patch]
 func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
-
 	reviewID, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
@@ -341,11 +398,30 @@ func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Reque
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
-	ReviewWithUser, err := app.models.Reviews.Get(ctx, reviewID, nil)
+	reviewWithUser, err := app.models.Reviews.Get(ctx, reviewID, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := app.canModifyReview(r.Context(), app.contextGetUser(r), &reviewWithUser.Review)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if !app.checkIfMatch(w, r, int64(reviewWithUser.Version)) {
+		return
+	}
 
 	var input struct {
 		Text   *string `json:"text"`
@@ -363,7 +439,7 @@ func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	review := ReviewWithUser.Review
+	review := reviewWithUser.Review
 	if input.Text != nil {
 		review.Text = *input.Text
 	}
@@ -373,19 +449,105 @@ func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Reque
 
 	v := validator.New()
 	if data.ValidateReview(v, &review); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	err = app.models.Reviews.Update(ctx, reviewID, &review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	review.Edited = true
+
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(review.Version), envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Delete a review
+// @Description  Deletes the review with the specified ID.
+// @Description  Only the author or a user with the reviews:moderate permission may delete it.
+// @Tags         Reviews
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "Review ID"
+// @Param        If-Match  header  string  false  "ETag of the version being deleted; 412 if the review has changed since"
+// @Success      204  {object}  nil
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      412  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/reviews/{id} [delete]
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	review, err := app.models.Reviews.Get(ctx, reviewID, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := app.canModifyReview(r.Context(), app.contextGetUser(r), &review.Review)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if !app.checkIfMatch(w, r, int64(review.Version)) {
+		return
+	}
+
+	err = app.models.Reviews.DeleteVersion(ctx, reviewID, review.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// canModifyReview reports whether the user may edit or delete the review: either
+// they wrote it, or they hold the reviews:moderate (or admin) permission.
+func (app *application) canModifyReview(ctx context.Context, user *data.User, review *data.Review) (bool, error) {
+	if review.UserID == user.ID {
+		return true, nil
+	}
+
+	permissions, err := app.permissionsForUser(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include("admin") || permissions.Include("reviews:moderate"), nil
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"cinemesis/internal/data"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReviewTestRequest(app *application, method, target string, body []byte, user *data.User) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	params := httprouter.Params{{Key: "id", Value: "1"}}
+	req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, params))
+	return app.contextSetUser(req, user)
+}
+
+var reviewCreatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func expectReviewGet(mock sqlmock.Sqlmock, authorID int64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`0 AS user_vote FROM reviews r JOIN users u ON r.user_id = u.id WHERE r.id = $1`) + "$").
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "movie_id", "text", "rating", "upvotes", "downvotes", "created_at", "edited", "version", "user_name", "total_votes", "user_vote"}).
+			AddRow(1, authorID, 1, "A thoroughly decent film", 7, 0, 0, reviewCreatedAt, false, 2, "Author", 0, 0))
+}
+
+func TestReviewOwnership(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	app := &application{
+		config: config{env: "testing"},
+		logger: logger,
+		models: data.Models{
+			Reviews:     data.ReviewModel{DB: db},
+			Permissions: data.PermissionModel{DB: db},
+		},
+		authCache: newAuthCache(0, 0),
+	}
+
+	author := &data.User{ID: 1, Activated: true}
+	stranger := &data.User{ID: 2, Activated: true}
+	moderator := &data.User{ID: 3, Activated: true}
+
+	t.Run("Create uses authenticated user", func(t *testing.T) {
+		body, _ := json.Marshal(data.ReviewInput{MovieID: 1, Text: "A thoroughly decent film", Rating: 7})
+		req := newReviewTestRequest(app, http.MethodPost, "/v1/reviews", body, author)
+		w := httptest.NewRecorder()
+
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO reviews (user_id, movie_id, text, rating, edited)`)).
+			WithArgs(int64(1), int64(1), "A thoroughly decent film", uint8(7), false).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+		app.createReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/v1/reviews/1", w.Header().Get("Location"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Create rejects user_id in body", func(t *testing.T) {
+		body := []byte(`{"user_id": 2, "movie_id": 1, "text": "A thoroughly decent film", "rating": 7}`)
+		req := newReviewTestRequest(app, http.MethodPost, "/v1/reviews", body, author)
+		w := httptest.NewRecorder()
+
+		app.createReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Update by stranger is forbidden", func(t *testing.T) {
+		body := []byte(`{"rating": 1}`)
+		req := newReviewTestRequest(app, http.MethodPatch, "/v1/reviews/1", body, stranger)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions.code`)).
+			WithArgs(stranger.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("reviews:write"))
+
+		app.updateReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update by author returns review", func(t *testing.T) {
+		body := []byte(`{"rating": 9}`)
+		req := newReviewTestRequest(app, http.MethodPatch, "/v1/reviews/1", body, author)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE reviews`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).AddRow(1, reviewCreatedAt, 3))
+
+		app.updateReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp envelope
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		assert.NoError(t, err)
+		review, ok := resp["review"].(map[string]any)
+		assert.True(t, ok)
+		assert.Equal(t, float64(9), review["rating"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Delete by moderator", func(t *testing.T) {
+		req := newReviewTestRequest(app, http.MethodDelete, "/v1/reviews/1", nil, moderator)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions.code`)).
+			WithArgs(moderator.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("reviews:write").AddRow("reviews:moderate"))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM reviews WHERE id = $1 AND version = $2`)).
+			WithArgs(int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app.deleteReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Delete by stranger is forbidden", func(t *testing.T) {
+		req := newReviewTestRequest(app, http.MethodDelete, "/v1/reviews/1", nil, stranger)
+		w := httptest.NewRecorder()
+
+		expectReviewGet(mock, author.ID)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions.code`)).
+			WithArgs(stranger.ID).
+			WillReturnRows(sqlmock.NewRows([]string{"code"}))
+
+		app.deleteReviewHandler(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
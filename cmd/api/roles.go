@@ -0,0 +1,307 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/validator"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary      List roles
+// @Description  Returns every role with the permission codes it bundles
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string][]data.Role
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/roles [get]
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      List permissions
+// @Description  Returns every permission code known to the API
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string][]string
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/permissions [get]
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Show a user's access
+// @Description  Returns the roles, directly granted permissions and effective permissions of a user
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/{id}/permissions [get]
+func (app *application) showUserAccessHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	direct, err := app.models.Permissions.GetDirectForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	effective, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"user_id":               user.ID,
+		"roles":                 roles,
+		"permissions":           direct,
+		"effective_permissions": effective,
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Grant a role
+// @Description  Assigns a role to a user
+// @Tags         Admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int             true  "User ID"
+// @Param        input  body      data.RoleInput  true  "Role name"
+// @Success      200    {object}  map[string]string
+// @Failure      400    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      404    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/{id}/roles [post]
+func (app *application) grantUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.RoleInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Role != "", "role", validator.CodeRequired, "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Roles.AddForUser(r.Context(), user.ID, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("role", validator.CodeNotFound, "unknown role")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.authCache.invalidatePermissions(user.ID)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "role granted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Revoke a role
+// @Description  Removes a role from a user
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id    path      int     true  "User ID"
+// @Param        role  path      string  true  "Role name"
+// @Success      204   {object}  nil
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /v1/users/{id}/roles/{role} [delete]
+func (app *application) revokeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	role := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	err := app.models.Roles.RemoveForUser(r.Context(), user.ID, role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.authCache.invalidatePermissions(user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Grant a permission
+// @Description  Grants a single permission to a user, independent of their roles
+// @Tags         Admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                   true  "User ID"
+// @Param        input  body      data.PermissionInput  true  "Permission code"
+// @Success      200    {object}  map[string]string
+// @Failure      400    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      404    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/{id}/permissions [post]
+func (app *application) grantUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.PermissionInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Permission != "", "permission", validator.CodeRequired, "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.Permissions.GrantForUser(r.Context(), user.ID, input.Permission)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("permission", validator.CodeNotFound, "unknown permission")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.authCache.invalidatePermissions(user.ID)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "permission granted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Revoke a permission
+// @Description  Removes a directly granted permission from a user
+// @Tags         Admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id    path      int     true  "User ID"
+// @Param        code  path      string  true  "Permission code"
+// @Success      204   {object}  nil
+// @Failure      403   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Router       /v1/users/{id}/permissions/{code} [delete]
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	err := app.models.Permissions.RemoveForUser(r.Context(), user.ID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.authCache.invalidatePermissions(user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readUserForAdmin loads the user addressed by the URL of an admin route. It
+// writes the error response itself and reports whether the handler may continue.
+func (app *application) readUserForAdmin(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readUserIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	_ "cinemesis/docs"
-	"expvar"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -14,40 +13,111 @@ func (app *application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/docs/*filepath", httpSwagger.WrapHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-
-	router.HandlerFunc(http.MethodPost, "/v1/genres/create", app.requirePermission("genres:write", app.createGenreHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/genres/movie/:id", app.requirePermission("genres:read", app.getMovieGenresHandler))
-	router.HandlerFunc(http.MethodPut, "/v1/genres/update/movie/:id", app.requirePermission("genres:write", app.replaceMovieGenresHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/genres/attach/:id", app.requirePermission("genres:write", app.addGenresToMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("genres:read", app.getAllGenresHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/genres/get/:id", app.requirePermission("genres:read", app.showGenreHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/genres/update/:id", app.requirePermission("genres:write", app.updateGenreHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/genres/delete/:id", app.requirePermission("genres:write", app.deleteGenreHandler))
-
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
-
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("reviews:read", app.listMovieReviewsHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/top", app.requirePermission("reviews:read", app.listMovieTopReviewsHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/reviews", app.requirePermission("reviews:write", app.createReviewHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id", app.requirePermission("reviews:read", app.showReviewHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/reviews/:id/", app.requirePermission("reviews:write", app.updateReviewHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/vote", app.requirePermission("reviews:write", app.voteForReview))
-	router.HandlerFunc(http.MethodGet, "/v1/users/:id/reviews", app.requirePermission("reviews:read", app.listUserReviewsHandler))
-
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/update", app.updateUserPasswordHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/reset", app.createPasswordResetTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthTokenHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
-
-	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
-
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	// handle registers h and records the route pattern for request metrics,
+	// since httprouter doesn't expose the pattern it matched.
+	handle := func(method, pattern string, h http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+			setRoutePattern(w, pattern)
+			h(w, r)
+		})
+	}
+
+	handle(http.MethodGet, "/docs/*filepath", httpSwagger.WrapHandler)
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+
+	handle(http.MethodPost, "/v1/genres/create", app.requirePermission("genres:write", app.createGenreHandler))
+	handle(http.MethodGet, "/v1/genres/movie/:id", app.requirePermission("genres:read", app.getMovieGenresHandler))
+	handle(http.MethodPut, "/v1/genres/update/movie/:id", app.requirePermission("genres:write", app.replaceMovieGenresHandler))
+	handle(http.MethodPatch, "/v1/genres/attach/:id", app.requirePermission("genres:write", app.addGenresToMovieHandler))
+	handle(http.MethodGet, "/v1/genres", app.requirePermission("genres:read", app.getAllGenresHandler))
+	handle(http.MethodGet, "/v1/genres/get/:id", app.requirePermission("genres:read", app.showGenreHandler))
+	handle(http.MethodPatch, "/v1/genres/update/:id", app.requirePermission("genres:write", app.updateGenreHandler))
+	handle(http.MethodDelete, "/v1/genres/delete/:id", app.requirePermission("genres:write", app.deleteGenreHandler))
+
+	handle(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	handle(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
+	handle(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	handle(http.MethodPost, "/v1/movies/:id", app.requirePermission("movies:write", app.importMoviesHandler))
+	handle(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
+	handle(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+
+	handle(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission("movies:read", app.listMovieCreditsHandler))
+	handle(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.createMovieCreditHandler))
+	handle(http.MethodDelete, "/v1/movies/:id/credits/:credit", app.requirePermission("movies:write", app.deleteMovieCreditHandler))
+
+	handle(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.listPeopleHandler))
+	handle(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.createPersonHandler))
+	handle(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.showPersonHandler))
+	handle(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.updatePersonHandler))
+	handle(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.deletePersonHandler))
+	handle(http.MethodGet, "/v1/people/:id/movies", app.requirePermission("movies:read", app.listPersonMoviesHandler))
+
+	handle(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("reviews:read", app.listMovieReviewsHandler))
+	handle(http.MethodGet, "/v1/movies/:id/reviews/top", app.requirePermission("reviews:read", app.listMovieTopReviewsHandler))
+	handle(http.MethodPost, "/v1/reviews", app.requirePermission("reviews:write", app.createReviewHandler))
+	handle(http.MethodGet, "/v1/reviews/:id", app.requirePermission("reviews:read", app.showReviewHandler))
+	handle(http.MethodPatch, "/v1/reviews/:id", app.requirePermission("reviews:write", app.updateReviewHandler))
+	handle(http.MethodDelete, "/v1/reviews/:id", app.requirePermission("reviews:write", app.deleteReviewHandler))
+	handle(http.MethodPost, "/v1/reviews/:id/vote", app.requirePermission("reviews:write", app.voteForReview))
+	handle(http.MethodGet, "/v1/users/:id/reviews", app.requirePermission("reviews:read", app.listUserReviewsHandler))
+
+	handle(http.MethodPost, "/v1/users", app.registerUserHandler)
+	handle(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	handle(http.MethodPatch, "/v1/users/:id", app.requireActivatedUser(app.updateUserHandler))
+	handle(http.MethodDelete, "/v1/users/:id", app.requireAuthenticatedUser(app.deleteAccountHandler))
+	handle(http.MethodDelete, "/v1/users/:id/deletion", app.requireAuthenticatedUser(app.cancelAccountDeletionHandler))
+	handle(http.MethodGet, "/v1/users/:id/export", app.requireActivatedUser(app.requestDataExportHandler))
+	handle(http.MethodGet, "/v1/exports/:token", app.downloadDataExportHandler)
+	handle(http.MethodPost, "/v1/users/:id/totp", app.requireActivatedUser(app.enrolTOTPHandler))
+	handle(http.MethodPost, "/v1/users/:id/totp/confirm", app.requireActivatedUser(app.confirmTOTPHandler))
+	handle(http.MethodDelete, "/v1/users/:id/totp", app.requireAuthenticatedUser(app.disableTOTPHandler))
+	handle(http.MethodPost, "/v1/tokens/update", app.updateUserPasswordHandler)
+	handle(http.MethodPost, "/v1/tokens/reset", app.createPasswordResetTokenHandler)
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthTokenHandler)
+	handle(http.MethodPost, "/v1/tokens/2fa", app.createTwoFactorAuthTokenHandler)
+	handle(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthTokenHandler))
+	handle(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthTokenHandler)
+	handle(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	handle(http.MethodGet, "/v1/users/:id/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	handle(http.MethodDelete, "/v1/users/:id/sessions", app.requireAuthenticatedUser(app.deleteSessionsHandler))
+	handle(http.MethodDelete, "/v1/users/:id/sessions/:session", app.requireAuthenticatedUser(app.deleteSessionHandler))
+
+	handle(http.MethodGet, "/v1/users/:id/watchlist", app.requireAuthenticatedUser(app.listWatchlistHandler))
+	handle(http.MethodPost, "/v1/users/:id/watchlist", app.requireAuthenticatedUser(app.addToWatchlistHandler))
+	handle(http.MethodDelete, "/v1/users/:id/watchlist/:movie", app.requireAuthenticatedUser(app.removeFromWatchlistHandler))
+	handle(http.MethodGet, "/v1/users/:id/diary", app.requireAuthenticatedUser(app.listDiaryHandler))
+	handle(http.MethodPost, "/v1/users/:id/diary", app.requireAuthenticatedUser(app.createDiaryEntryHandler))
+	handle(http.MethodGet, "/v1/users/:id/diary/:entry", app.requireAuthenticatedUser(app.showDiaryEntryHandler))
+	handle(http.MethodPatch, "/v1/users/:id/diary/:entry", app.requireAuthenticatedUser(app.updateDiaryEntryHandler))
+	handle(http.MethodDelete, "/v1/users/:id/diary/:entry", app.requireAuthenticatedUser(app.deleteDiaryEntryHandler))
+	handle(http.MethodGet, "/v1/users/:id/lists", app.requireAuthenticatedUser(app.listUserListsHandler))
+	handle(http.MethodPost, "/v1/users/:id/lists", app.requireAuthenticatedUser(app.createListHandler))
+	handle(http.MethodGet, "/v1/users/:id/lists/:list", app.requireAuthenticatedUser(app.showListHandler))
+	handle(http.MethodPatch, "/v1/users/:id/lists/:list", app.requireAuthenticatedUser(app.updateListHandler))
+	handle(http.MethodDelete, "/v1/users/:id/lists/:list", app.requireAuthenticatedUser(app.deleteListHandler))
+	handle(http.MethodPost, "/v1/users/:id/lists/:list/movies", app.requireAuthenticatedUser(app.addListItemHandler))
+	handle(http.MethodDelete, "/v1/users/:id/lists/:list/movies/:movie", app.requireAuthenticatedUser(app.removeListItemHandler))
+
+	handle(http.MethodGet, "/v1/roles", app.requirePermission("admin", app.listRolesHandler))
+	handle(http.MethodGet, "/v1/permissions", app.requirePermission("admin", app.listPermissionsHandler))
+	handle(http.MethodGet, "/v1/users/:id/permissions", app.requirePermission("admin", app.showUserAccessHandler))
+	handle(http.MethodPost, "/v1/users/:id/permissions", app.requirePermission("admin", app.grantUserPermissionHandler))
+	handle(http.MethodDelete, "/v1/users/:id/permissions/:code", app.requirePermission("admin", app.revokeUserPermissionHandler))
+	handle(http.MethodPost, "/v1/users/:id/roles", app.requirePermission("admin", app.grantUserRoleHandler))
+	handle(http.MethodDelete, "/v1/users/:id/roles/:role", app.requirePermission("admin", app.revokeUserRoleHandler))
+	handle(http.MethodDelete, "/v1/users/:id/lockout", app.requirePermission("admin", app.unlockUserHandler))
+	handle(http.MethodGet, "/v1/lockouts", app.requirePermission("admin", app.listLockoutsHandler))
+	handle(http.MethodDelete, "/v1/lockouts/ips/:ip", app.requirePermission("admin", app.unlockIPHandler))
+
+	if app.config.env == "development" && app.mailCapture != nil {
+		handle(http.MethodGet, "/debug/mail", app.listCapturedMailHandler)
+	}
+
+	if app.config.metrics.addr == "" {
+		handle(http.MethodGet, "/metrics", app.requirePermission("admin", app.metricsHandler))
+	}
+
+	return app.requestID(app.metrics(app.trace(app.recoverPanic(app.enableCORS(app.authenticate(app.rateLimit(router)))))))
 }
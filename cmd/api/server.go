@@ -22,6 +22,47 @@ func (app *application) serve() error {
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	// With a metrics address configured, /metrics is served on its own listener
+	// without authentication, so it should only be reachable by the scraper.
+	var metricsSrv *http.Server
+	if app.config.metrics.addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", app.meters.registry.Handler())
+
+		metricsSrv = &http.Server{
+			Addr:         app.config.metrics.addr,
+			Handler:      mux,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+		}
+
+		go func() {
+			app.logger.Info("starting metrics server", "addr", metricsSrv.Addr)
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.Error("metrics server failed", "error", err.Error())
+			}
+		}()
+	}
+
+	// The outbox and account workers are tracked by app.wg, and stopped once
+	// the server no longer accepts requests that could give them work.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.runOutbox(workerCtx)
+	}()
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.runAccountJobs(workerCtx)
+	}()
+
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -36,11 +77,17 @@ func (app *application) serve() error {
 
 		// Call Shutdown() on the server like before, but now we only send on the
 		// shutdownError channel if it returns an error.
+		if metricsSrv != nil {
+			metricsSrv.Shutdown(ctx)
+		}
+
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
 		}
 
+		stopWorkers()
+
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 		// Call Wait() to block until our WaitGroup counter is zero --- essentially
 		// blocking until the background goroutines have finished. Then we return nil on
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary      List sessions
+// @Description  Lists the active login sessions of the authenticated user
+// @Tags         Sessions
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  map[string][]data.Session
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/sessions [get]
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := app.models.Tokens.GetSessionsForUser(r.Context(), userID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Revoke other sessions
+// @Description  Revokes every session of the authenticated user except the current one
+// @Tags         Sessions
+// @Security     BearerAuth
+// @Produce      json
+// @Success      204  {object}  nil
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/users/me/sessions [delete]
+func (app *application) deleteSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tokens.DeleteOtherSessionsForUser(r.Context(), userID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.authCache.invalidateUserTokens(userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Revoke a session
+// @Description  Revokes a single session of the authenticated user
+// @Tags         Sessions
+// @Security     BearerAuth
+// @Produce      json
+// @Param        session  path      string  true  "Session ID"
+// @Success      204      {object}  nil
+// @Failure      401      {object}  ErrorResponse
+// @Failure      403      {object}  ErrorResponse
+// @Failure      404      {object}  ErrorResponse
+// @Failure      500      {object}  ErrorResponse
+// @Router       /v1/users/me/sessions/{session} [delete]
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID := httprouter.ParamsFromContext(r.Context()).ByName("session")
+
+	err := app.models.Tokens.DeleteSession(r.Context(), userID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.authCache.invalidateUserTokens(userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireSelf resolves the user ID in the URL and makes sure it belongs to the
+// authenticated user. It writes the error response itself and reports whether
+// the handler may continue.
+func (app *application) requireSelf(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := app.readUserIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0, false
+	}
+
+	if userID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return 0, false
+	}
+
+	return userID, true
+}
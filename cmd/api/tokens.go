@@ -3,20 +3,31 @@ package main
 import (
 	"cinemesis/internal/data"
 	"cinemesis/internal/validator"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/tomasen/realip"
+)
+
+const (
+	authTokenTTL    = 24 * time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
 )
 
-// @Summary      Authenticate user and return token
-// @Description  Validates credentials and returns an authentication token
+// @Summary      Authenticate user and return tokens
+// @Description  Validates credentials and returns an authentication token and a refresh token. For users with two-factor authentication, it returns a two_factor_token to complete the login at /v1/tokens/2fa instead.
 // @Tags         Tokens
 // @Accept       json
 // @Produce      json
 // @Param        input  body  data.AuthInput  true  "Email and Password"
-// @Success      201          {object}  data.Token
+// @Success      200          {object}  map[string]data.Token
+// @Success      201          {object}  map[string]data.Token
 // @Failure      400          {object}  ErrorResponse
 // @Failure      401          {object}  ErrorResponse
+// @Failure      429          {object}  ErrorResponse
 // @Failure      500          {object}  ErrorResponse
 // @Router       /v1/tokens/authentication [post]
 func (app *application) createAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -34,106 +45,214 @@ func (app *application) createAuthTokenHandler(w http.ResponseWriter, r *http.Re
 	data.ValidatePasswordPlaintext(v, input.Password)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	ip := realip.FromRequest(r)
+
+	wait, err := app.signInRetryAfter(r.Context(), input.Email, ip)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
-		default:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait > 0 {
+		app.tooManyAttemptsResponse(w, r, wait)
+		return
+	}
+
+	// An unknown email fails the same way, and takes as long, as a wrong
+	// password.
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		data.MatchesNoUser(input.Password)
+		user = nil
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match := false
+	if user != nil {
+		match, err = user.Password.Matches(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !match {
+		err = app.signInFailed(r.Context(), input.Email, ip, user)
+		if err != nil {
 			app.serverErrorResponse(w, r, err)
+			return
 		}
+		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	match, err := user.Password.Matches(input.Password)
+	// With two-factor authentication on, the password only earns a
+	// short-lived token to be exchanged along with a code at /v1/tokens/2fa.
+	twoFactor, err := app.twoFactorEnabled(r.Context(), user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if !match {
-		app.invalidCredentialsResponse(w, r)
+	if twoFactor {
+		token, err := app.models.Tokens.New(r.Context(), user.ID, twoFactorTokenTTL, data.ScopeTwoFactor)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeResponse(w, r, http.StatusOK, envelope{"two_factor_required": true, "two_factor_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.signInSucceeded(r.Context(), user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	authToken, refreshToken, err := app.models.Tokens.NewSession(r.Context(), user.ID, r.UserAgent(), authTokenTTL, refreshTokenTTL)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"auth_token": token}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"auth_token": authToken, "refresh_token": refreshToken}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-// @Summary      Create password reset token
-// @Description  Sends a password reset token to the user's email
+// @Summary      Refresh authentication token
+// @Description  Exchanges a refresh token for a new authentication and refresh token pair.
+// @Description  Each refresh token can be used once; reusing one revokes the whole session.
 // @Tags         Tokens
 // @Accept       json
 // @Produce      json
-// @Param        input  body      data.EmailInput  true  "User Email"
-// @Success      202    {object}  map[string]string
+// @Param        input  body      data.RefreshInput  true  "Refresh token"
+// @Success      201    {object}  map[string]data.Token
 // @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
 // @Failure      422    {object}  ErrorResponse
 // @Failure      500    {object}  ErrorResponse
-// @Router       /v1/tokens/password-reset [post]
-func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
-	var input data.EmailInput
+// @Router       /v1/tokens/refresh [post]
+func (app *application) refreshAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.RefreshInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+
 	v := validator.New()
-	if data.ValidateEmail(v, input.Email); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	authToken, refreshToken, err := app.models.Tokens.Rotate(r.Context(), input.RefreshToken, authTokenTTL, refreshTokenTTL)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("email", "no matching email address found")
-			app.failedValidationResponse(w, r, v.Errors)
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrTokenReused):
+			app.logger.Warn("refresh token reuse detected, session revoked", "ip", realip.FromRequest(r))
+			app.authCache.invalidateAllTokens()
+			app.invalidRefreshTokenResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	if !user.Activated {
-		v.AddError("email", "user account must be activated")
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	// Rotation deleted the session's previous authentication token.
+	app.authCache.invalidateUserTokens(authToken.UserID)
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"auth_token": authToken, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
+}
 
-	token, err := app.models.Tokens.New(user.ID, 180*time.Minute, data.ScopePasswordReset)
+// @Summary      Log out
+// @Description  Revokes the authentication token used for this request together with its refresh token
+// @Tags         Tokens
+// @Security     BearerAuth
+// @Produce      json
+// @Success      204  {object}  nil
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /v1/tokens/authentication [delete]
+func (app *application) deleteAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Tokens.DeleteSessionForToken(r.Context(), app.contextGetToken(r))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
-		data := map[string]any{
-			"passwordResetToken": token.PlainText,
-		}
+	app.authCache.invalidateToken(app.contextGetToken(r))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Create password reset token
+// @Description  Sends a password reset token to the user's email
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.EmailInput  true  "User Email"
+// @Success      202    {object}  map[string]string
+// @Failure      400    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      429    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/tokens/password-reset [post]
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.EmailInput
 
-		err := app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if !app.allowMailRequest(w, r, input.Email) {
+		return
+	}
+
+	// The response is the same whether or not the address has an activated
+	// account, so it can't be used to find out.
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case user.Activated:
+		err = app.sendTokenEmail(r.Context(), user, 180*time.Minute, data.ScopePasswordReset, "token_password_reset.tmpl", "passwordResetToken")
 		if err != nil {
-			app.logger.Error(err.Error())
+			app.serverErrorResponse(w, r, err)
+			return
 		}
-	})
+	}
 
-	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
-	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	env := envelope{"message": "if an activated account uses this email address, an email will be sent to it containing password reset instructions"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -148,6 +267,7 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 // @Success      202    {object}  map[string]string  "message: email sent"
 // @Failure      400    {object}  ErrorResponse
 // @Failure      422    {object}  ErrorResponse
+// @Failure      429    {object}  ErrorResponse
 // @Failure      500    {object}  ErrorResponse
 // @Router       /v1/tokens/activation [post]
 func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -160,47 +280,81 @@ func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *h
 	}
 	v := validator.New()
 	if data.ValidateEmail(v, input.Email); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("email", "no matching email address found")
-			app.failedValidationResponse(w, r, v.Errors)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+	if !app.allowMailRequest(w, r, input.Email) {
 		return
 	}
 
-	if user.Activated {
-		v.AddError("email", "user has already been activated")
-		app.failedValidationResponse(w, r, v.Errors)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
 		return
+	case !user.Activated:
+		err = app.sendTokenEmail(r.Context(), user, 3*24*time.Hour, data.ScopeActivation, "token_activation.tmpl", "activationToken")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	env := envelope{"message": "if an account waiting for activation uses this email address, an email will be sent to it containing activation instructions"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
+}
 
-	app.background(func() {
-		data := map[string]any{
-			"activationToken": token.PlainText,
-		}
-		err := app.mailer.Send(user.Email, "token_activation.tmpl", data)
-		if err != nil {
-			app.logger.Error(err.Error())
-		}
-	})
+// allowMailRequest counts a request to email an address and holds it back if
+// the address has had too many. It writes the error response itself and
+// reports whether the handler may continue.
+func (app *application) allowMailRequest(w http.ResponseWriter, r *http.Request, email string) bool {
+	subject := data.LockoutSubject(email)
+
+	wait, err := app.retryAfter(r.Context(), mailLockout, subject)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if wait > 0 {
+		app.tooManyAttemptsResponse(w, r, wait)
+		return false
+	}
 
-	env := envelope{"message": "an email will be sent to you containing activation instructions"}
-	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	_, err = app.recordFailure(r.Context(), mailLockout, subject)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// sendTokenEmail issues a token for the user and queues it for delivery in one
+// transaction, so a token is never issued without its email or vice versa.
+func (app *application) sendTokenEmail(ctx context.Context, user *data.User, ttl time.Duration, scope, template, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := app.models.Tokens.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	token, err := app.models.Tokens.NewTx(ctx, tx, user.ID, ttl, scope)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Outbox.Enqueue(ctx, tx, user.Email, user.Locale, template, map[string]any{key: token.PlainText})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"cinemesis/internal/data"
+	"cinemesis/internal/totp"
+	"cinemesis/internal/validator"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tomasen/realip"
+)
+
+const (
+	totpIssuer        = "Cinemesis"
+	twoFactorTokenTTL = 5 * time.Minute
+)
+
+// @Summary      Start two-factor enrolment
+// @Description  Generates a TOTP secret for the authenticated user and returns it with an otpauth URI for authenticator apps. Two-factor authentication is only turned on once a first code is confirmed.
+// @Tags         Users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.PasswordInput  true  "Current password"
+// @Success      201    {object}  map[string]string
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/totp [post]
+func (app *application) enrolTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.PasswordInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.requireCurrentPassword(w, r, userID, input.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	secret := totp.NewSecret()
+
+	err = app.models.TOTP.Provision(r.Context(), user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPEnabled):
+			v := validator.New()
+			v.AddError("totp", validator.CodeInvalidState, "two-factor authentication is already enabled")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"totp": map[string]string{
+		"secret": totp.EncodeSecret(secret),
+		"uri":    totp.URI(totpIssuer, user.Email, secret),
+	}}
+
+	err = app.writeResponse(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Confirm two-factor enrolment
+// @Description  Turns on two-factor authentication with a first code from the authenticator app, and returns the one-time recovery codes. Other sessions are signed out.
+// @Tags         Users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.CodeInput  true  "Code from the authenticator app"
+// @Success      200    {object}  map[string][]string
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/totp/confirm [post]
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.CodeInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	enrolment, err := app.models.TOTP.Get(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("totp", validator.CodeInvalidState, "must be set up first")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if enrolment.Enabled() {
+		v.AddError("totp", validator.CodeInvalidState, "two-factor authentication is already enabled")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, strings.TrimSpace(input.Code), time.Now())
+	if !ok {
+		v.AddError("code", validator.CodeIncorrect, "is incorrect")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	codes, err := app.models.TOTP.Confirm(r.Context(), userID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPEnabled):
+			v.AddError("totp", validator.CodeInvalidState, "two-factor authentication is already enabled")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Sessions signed in with only a password don't get to skip the new
+	// second factor.
+	err = app.models.Tokens.DeleteOtherSessionsForUser(r.Context(), userID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.authCache.invalidateUserTokens(userID)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Disable two-factor authentication
+// @Description  Turns off two-factor authentication, given the password and a code from the authenticator app or a recovery code
+// @Tags         Users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.DisableTOTPInput  true  "Current password and code"
+// @Success      204    {object}  nil
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me/totp [delete]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.DisableTOTPInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	_, ok = app.requireCurrentPassword(w, r, userID, input.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	match, err := app.checkSecondFactor(r.Context(), userID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("code", validator.CodeIncorrect, "is incorrect")
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.models.TOTP.Disable(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Complete a two-factor login
+// @Description  Exchanges the token returned by a password login for an authentication token and a refresh token, given a code from the authenticator app or a recovery code
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.TwoFactorInput  true  "Two-factor token and code"
+// @Success      201    {object}  map[string]data.Token
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      429    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/tokens/2fa [post]
+func (app *application) createTwoFactorAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.TwoFactorInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if data.ValidateCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeTwoFactor, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ip := realip.FromRequest(r)
+
+	wait, err := app.signInRetryAfter(r.Context(), user.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait > 0 {
+		app.tooManyAttemptsResponse(w, r, wait)
+		return
+	}
+
+	match, err := app.checkSecondFactor(r.Context(), user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		err = app.signInFailed(r.Context(), user.Email, ip, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.signInSucceeded(r.Context(), user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authToken, refreshToken, err := app.models.Tokens.NewSession(r.Context(), user.ID, r.UserAgent(), authTokenTTL, refreshTokenTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"auth_token": authToken, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// twoFactorEnabled reports whether logging in as the user takes a code as well
+// as the password.
+func (app *application) twoFactorEnabled(ctx context.Context, userID int64) (bool, error) {
+	enrolment, err := app.models.TOTP.Get(ctx, userID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return enrolment.Enabled(), nil
+}
+
+// checkSecondFactor reports whether code is a current authenticator code or an
+// unused recovery code of the user. Either is used up by a successful check.
+func (app *application) checkSecondFactor(ctx context.Context, userID int64, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if !totp.IsCode(code) {
+		return app.models.TOTP.UseRecoveryCode(ctx, userID, code)
+	}
+
+	enrolment, err := app.models.TOTP.Get(ctx, userID)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	if !enrolment.Enabled() {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return app.models.TOTP.UseStep(ctx, userID, step)
+}
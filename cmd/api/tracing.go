@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cinemesis/internal/requestid"
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "cinemesis/cmd/api"
+
+// openTracerProvider returns the tracer provider for the configured exporter.
+// With none configured nothing is recorded, at next to no cost. The OTLP
+// exporter takes its endpoint and headers from the standard OTEL_EXPORTER_OTLP_*
+// environment variables.
+func openTracerProvider(cfg config) (trace.TracerProvider, func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.tracing.exporter {
+	case "none":
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.tracing.exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.tracing.sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "cinemesis"),
+			attribute.String("service.version", version),
+			attribute.String("deployment.environment.name", cfg.env),
+		)),
+	)
+
+	return tp, tp.Shutdown, nil
+}
+
+// trace records a server span for every request, continuing a trace started by
+// the caller if the request carries a traceparent header. The span is named
+// after the route pattern the router matched, so requests for different
+// movies share a name, and database spans recorded while serving the request
+// are its children.
+func (app *application) trace(next http.Handler) http.Handler {
+	propagator := propagation.TraceContext{}
+
+	tracer := app.tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("request_id", requestid.FromContext(r.Context())),
+			),
+		)
+		defer span.End()
+
+		mw := findMetricsResponseWriter(w)
+		if mw == nil {
+			mw = newMetricsResponseWriter(w)
+			w = mw
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if mw.route != "" {
+			span.SetName(r.Method + " " + mw.route)
+			span.SetAttributes(attribute.String("http.route", mw.route))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", mw.statusCode))
+		if mw.userID != 0 {
+			span.SetAttributes(attribute.Int64("user.id", mw.userID))
+		}
+		if mw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(mw.statusCode))
+		}
+	})
+}
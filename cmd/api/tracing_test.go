@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"cinemesis/internal/data"
+	"cinemesis/internal/sqltrace"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type mockConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c mockConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c mockConnector) Driver() driver.Driver                        { return c.drv }
+
+func TestTraceMiddleware(t *testing.T) {
+	mockDB, mock, err := sqlmock.NewWithDSN(t.Name())
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	db := sql.OpenDB(sqltrace.Connector(mockConnector{dsn: t.Name(), drv: mockDB.Driver()}, tp, "postgresql"))
+	defer db.Close()
+
+	app := &application{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		models: data.Models{Permissions: data.PermissionModel{DB: db}},
+		tracer: tp.Tracer(tracerName),
+	}
+
+	handler := app.trace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setRoutePattern(w, "/v1/movies/:id")
+		if _, err := app.models.Permissions.GetAllForUser(r.Context(), 1); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("Names span by route with query as child", func(t *testing.T) {
+		exporter.Reset()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions.code`)).
+			WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("movies:read"))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/movies/42", nil))
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 2)
+		query, server := spans[0], spans[1]
+
+		assert.Equal(t, "GET /v1/movies/:id", server.Name)
+		assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+		assert.Contains(t, server.Attributes, attribute.String("http.route", "/v1/movies/:id"))
+		assert.Contains(t, server.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+		assert.False(t, server.Parent.IsValid())
+
+		assert.Equal(t, "SELECT", query.Name)
+		assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+		assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+		assert.Equal(t, server.SpanContext.TraceID(), query.SpanContext.TraceID())
+	})
+
+	t.Run("Continues incoming trace and marks server errors", func(t *testing.T) {
+		exporter.Reset()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT permissions.code`)).
+			WillReturnError(sql.ErrConnDone)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/movies/42", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 2)
+		query, server := spans[0], spans[1]
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+		assert.True(t, server.Parent.IsRemote())
+		assert.Equal(t, codes.Error, server.Status.Code)
+		assert.Equal(t, codes.Error, query.Status.Code)
+	})
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"cinemesis/internal/data"
+	"cinemesis/internal/mailer"
 	"cinemesis/internal/validator"
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -32,6 +37,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false,
+		Locale:    mailer.MatchLocale(r.Header.Get("Accept-Language")),
 	}
 
 	err = user.Password.Set(input.Password)
@@ -42,47 +48,59 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	v := validator.New()
 
 	if data.ValidateUser(v, user); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	tx, err := app.models.Users.DB.BeginTx(ctx, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to begin transaction: %w", err))
+		return
+	}
+	defer tx.Rollback()
+
+	err = app.models.Users.InsertTx(ctx, tx, user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email address already exists")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddError("email", validator.CodeAlreadyExists, "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	err = app.models.Roles.AddForUserTx(ctx, tx, user.ID, data.RoleViewer)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.NewTx(ctx, tx, user.ID, 3*24*time.Hour, data.ScopeActivation)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	app.background(func() {
-		data := map[string]any{
-			"activationToken": token.PlainText,
-			"userID":          user.ID,
-		}
-
-		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logger.Error(err.Error())
-		}
+	err = app.models.Outbox.Enqueue(ctx, tx, user.Email, user.Locale, "user_welcome.tmpl", map[string]any{
+		"activationToken": token.PlainText,
+		"userID":          user.ID,
 	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to commit transaction: %w", err))
+		return
+	}
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeVersionedResponse(w, r, http.StatusAccepted, int64(user.Version), envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -110,16 +128,16 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	v := validator.New()
 	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddError("token", validator.CodeInvalid, "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -128,7 +146,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -139,13 +157,15 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	app.authCache.invalidateUser(user.ID)
+
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(user.Version), envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -177,16 +197,16 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
 
 	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopePasswordReset, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired password reset token")
-			app.failedValidationResponse(w, r, v.Errors)
+			v.AddError("token", validator.CodeInvalid, "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -199,7 +219,7 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -210,15 +230,291 @@ func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopePasswordReset, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.authCache.invalidateUser(user.ID)
+
 	env := envelope{"message": "your password was successfully reset"}
 
-	err = app.writeJSON(w, http.StatusOK, env, nil)
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// @Summary      Update own account
+// @Description  Changes the authenticated user's name, password or email. The current password is required. A new email address only replaces the current one once confirmed through PUT /v1/users/email; a confirmation is sent to the new address and a notice to the old one.
+// @Tags         Users
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      data.UpdateUserInput  true  "Fields to change and current password"
+// @Param        If-Match  header  string  false  "ETag of the version being edited; 412 if the account has changed since"
+// @Success      200    {object}  data.User
+// @Header       200    {string}  ETag  "Entity tag of the updated user"
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      412    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/me [patch]
+func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.requireSelf(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.UpdateUserInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, ok := app.requireCurrentPassword(w, r, userID, input.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if !app.checkIfMatch(w, r, int64(user.Version)) {
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	if input.Password != nil {
+		err = user.Password.Set(*input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Addresses are unique regardless of case, so changing only the case
+	// keeps the same mailbox and needs no confirmation.
+	var newEmail string
+	if input.Email != nil {
+		if strings.EqualFold(*input.Email, user.Email) {
+			user.Email = *input.Email
+		} else {
+			newEmail = *input.Email
+			data.ValidateEmail(v, newEmail)
+		}
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	if newEmail != "" {
+		_, err = app.models.Users.GetByEmail(r.Context(), newEmail)
+		switch {
+		case err == nil:
+			v.AddError("email", validator.CodeAlreadyExists, "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	tx, err := app.models.Users.DB.BeginTx(ctx, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to begin transaction: %w", err))
+		return
+	}
+	defer tx.Rollback()
+
+	err = app.models.Users.UpdateTx(ctx, tx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", validator.CodeAlreadyExists, "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if newEmail != "" {
+		err = app.requestEmailChange(ctx, tx, user, newEmail)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to commit transaction: %w", err))
+		return
+	}
+
+	// A new password signs out every other session, in case the old one
+	// was compromised.
+	if input.Password != nil {
+		err = app.models.Tokens.DeleteOtherSessionsForUser(ctx, user.ID, app.contextGetToken(r))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.authCache.invalidateUser(user.ID)
+
+	env := envelope{"user": user}
+	if newEmail != "" {
+		env["pending_email"] = newEmail
+	}
+
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(user.Version), env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requireCurrentPassword loads the user and checks the password they gave to
+// confirm a sensitive change. It writes the error response itself and reports
+// whether the handler may continue.
+func (app *application) requireCurrentPassword(w http.ResponseWriter, r *http.Request, userID int64, currentPassword string) (*data.User, bool) {
+	v := validator.New()
+	if v.Check(currentPassword != "", "current_password", validator.CodeRequired, "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	match, err := user.Password.Matches(currentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !match {
+		v.AddError("current_password", validator.CodeIncorrect, "is incorrect")
+		app.failedValidationResponse(w, r, v)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// requestEmailChange issues an email change token for newEmail and queues the
+// confirmation to the new address and the notice to the current one, as part
+// of tx.
+func (app *application) requestEmailChange(ctx context.Context, tx *sql.Tx, user *data.User, newEmail string) error {
+	token, err := app.models.Tokens.NewEmailChangeTx(ctx, tx, user.ID, 24*time.Hour, newEmail)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Outbox.Enqueue(ctx, tx, newEmail, user.Locale, "email_change_confirm.tmpl", map[string]any{
+		"emailChangeToken": token.PlainText,
+		"newEmail":         newEmail,
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.models.Outbox.Enqueue(ctx, tx, user.Email, user.Locale, "email_change_notice.tmpl", map[string]any{
+		"newEmail": newEmail,
+	})
+}
+
+// @Summary      Confirm email change
+// @Description  Replaces the user's email address with the one an email change token was sent to
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        token  body      data.TokenInput  true  "Email change token"
+// @Success      200    {object}  data.User
+// @Failure      400    {object}  ErrorResponse
+// @Failure      409    {object}  ErrorResponse
+// @Failure      422    {object}  ErrorResponse
+// @Failure      500    {object}  ErrorResponse
+// @Router       /v1/users/email [put]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.TokenInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	user, newEmail, err := app.models.Users.GetForEmailChangeToken(r.Context(), input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", validator.CodeInvalid, "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Email = newEmail
+
+	err = app.models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", validator.CodeAlreadyExists, "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Password reset tokens went to the old address, so they go too.
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopePasswordReset} {
+		err = app.models.Tokens.DeleteAllForUser(r.Context(), scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.authCache.invalidateUser(user.ID)
+
+	err = app.writeVersionedResponse(w, r, http.StatusOK, int64(user.Version), envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
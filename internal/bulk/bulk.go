@@ -0,0 +1,50 @@
+// Package bulk reads and writes movies in the file formats used for catalogue
+// imports and exports.
+package bulk
+
+import (
+	"errors"
+	"mime"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	// FormatJSON is a single JSON document holding an array of movies, either at
+	// the top level or under "results" as in TMDB responses. It is import only.
+	FormatJSON = "json"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// FormatFromContentType maps a request Content-Type to an import format. It
+// returns an empty string for media types it does not know.
+func FormatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return FormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatNDJSON
+	case "application/json":
+		return FormatJSON
+	default:
+		return ""
+	}
+}
+
+// ContentType is the media type an export in the given format is served as.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,161 @@
+package bulk
+
+import (
+	"bytes"
+	"cinemesis/internal/data"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, format, input string) []Record {
+	t.Helper()
+
+	r, err := NewReader(format, strings.NewReader(input))
+	require.NoError(t, err)
+
+	var records []Record
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	assert.Equal(t, FormatCSV, FormatFromContentType("text/csv; charset=utf-8"))
+	assert.Equal(t, FormatNDJSON, FormatFromContentType("application/x-ndjson"))
+	assert.Equal(t, FormatJSON, FormatFromContentType("application/json"))
+	assert.Equal(t, "", FormatFromContentType("text/plain"))
+	assert.Equal(t, "", FormatFromContentType(""))
+}
+
+func TestCSVReader(t *testing.T) {
+	input := "Genres,Title,Year,Runtime,Rating\n" +
+		"Animation|Adventure,Moana,2016,107 mins,7.6\n" +
+		"Drama,Broken,abc,12\n" +
+		"\"Sci-Fi\",Arrival,2016,116\n"
+
+	records := readAll(t, FormatCSV, input)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, 1, records[0].Row)
+	assert.Nil(t, records[0].Errors)
+	assert.Equal(t, data.MovieInput{
+		Title:      "Moana",
+		Year:       2016,
+		Runtime:    107,
+		GenreNames: []string{"Animation", "Adventure"},
+	}, records[0].Movie)
+
+	assert.Equal(t, 2, records[1].Row)
+	assert.Equal(t, map[string]string{"year": "must be an integer value"}, records[1].Errors)
+
+	assert.Equal(t, "Arrival", records[2].Movie.Title)
+	assert.Equal(t, data.Runtime(116), records[2].Movie.Runtime)
+}
+
+func TestCSVReader_RequiresTitleColumn(t *testing.T) {
+	_, err := NewReader(FormatCSV, strings.NewReader("name,year\nMoana,2016\n"))
+	assert.Error(t, err)
+
+	_, err = NewReader(FormatCSV, strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestNDJSONReader(t *testing.T) {
+	input := `{"title":"Moana","year":2016,"runtime":"107 mins","genres":["Animation"]}
+
+{"title":"Black Panther","year":2018,"runtime":134,"genres":[{"id":3,"name":"Action"}],"version":2}
+{"title":
+{"title":"Bad","year":"2018","runtime":90}
+{"title":"Worse","year":2018,"runtime":"long"}
+`
+
+	records := readAll(t, FormatNDJSON, input)
+	require.Len(t, records, 5)
+
+	assert.Equal(t, data.MovieInput{Title: "Moana", Year: 2016, Runtime: 107, GenreNames: []string{"Animation"}}, records[0].Movie)
+	assert.Equal(t, 2, records[1].Row)
+	assert.Equal(t, data.MovieInput{Title: "Black Panther", Year: 2018, Runtime: 134, GenreNames: []string{"Action"}}, records[1].Movie)
+	assert.Equal(t, map[string]string{"record": "badly-formed JSON"}, records[2].Errors)
+	assert.Equal(t, map[string]string{"year": "incorrect JSON type"}, records[3].Errors)
+	assert.Equal(t, map[string]string{"runtime": "invalid runtime format"}, records[4].Errors)
+}
+
+func TestJSONReader_TMDBResults(t *testing.T) {
+	input := `{"page":1,"results":[
+		{"title":"Arrival","release_date":"2016-11-11","runtime":116,"genres":[{"id":18,"name":"Drama"}]},
+		{"title":"Untitled","release_date":"","runtime":null}
+	],"total_pages":1}`
+
+	records := readAll(t, FormatJSON, input)
+	require.Len(t, records, 2)
+
+	assert.Equal(t, data.MovieInput{Title: "Arrival", Year: 2016, Runtime: 116, GenreNames: []string{"Drama"}}, records[0].Movie)
+	assert.Nil(t, records[1].Errors)
+	assert.Equal(t, int32(0), records[1].Movie.Year)
+	assert.Equal(t, data.Runtime(0), records[1].Movie.Runtime)
+}
+
+func TestJSONReader_Array(t *testing.T) {
+	records := readAll(t, FormatJSON, `[{"title":"Moana","year":2016,"runtime":107}]`)
+	require.Len(t, records, 1)
+	assert.Equal(t, "Moana", records[0].Movie.Title)
+
+	_, err := NewReader(FormatJSON, strings.NewReader(`{"page":1}`))
+	assert.Error(t, err)
+
+	_, err = NewReader(FormatJSON, strings.NewReader(`"movies"`))
+	assert.Error(t, err)
+}
+
+func TestNewReader_UnsupportedFormat(t *testing.T) {
+	_, err := NewReader("xml", strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestWriters_RoundTrip(t *testing.T) {
+	movie := &data.Movie{
+		ID:            7,
+		Title:         "Moana, Again",
+		Year:          2016,
+		Runtime:       107,
+		Genres:        []data.Genre{{ID: 1, Name: "Animation"}, {ID: 2, Name: "Adventure"}},
+		AverageRating: 7.5,
+		RatingCount:   2,
+	}
+	want := data.MovieInput{Title: "Moana, Again", Year: 2016, Runtime: 107, GenreNames: []string{"Animation", "Adventure"}}
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter(format, &buf)
+			require.NoError(t, err)
+			require.NoError(t, w.Write(movie))
+			require.NoError(t, w.Flush())
+
+			records := readAll(t, format, buf.String())
+			require.Len(t, records, 1)
+			assert.Nil(t, records[0].Errors)
+			assert.Equal(t, want, records[0].Movie)
+		})
+	}
+}
+
+func TestCSVWriter_Header(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(FormatCSV, &buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+
+	assert.Equal(t, "id,title,year,runtime,genres,average_rating,rating_count\n", buf.String())
+}
@@ -0,0 +1,316 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"cinemesis/internal/data"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxLineSize bounds a single NDJSON line.
+const maxLineSize = 1 << 20
+
+// Record is one movie read from an import. Row counts records from 1, skipping
+// the CSV header and blank NDJSON lines. Errors is set when the record itself
+// could not be decoded; it is keyed like validator errors so both kinds can be
+// reported the same way.
+type Record struct {
+	Row    int
+	Movie  data.MovieInput
+	Errors map[string]string
+}
+
+type Reader interface {
+	// Read returns the next record, or io.EOF once the input is exhausted. Any
+	// other error means the input cannot be read any further.
+	Read() (Record, error)
+}
+
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	case FormatJSON:
+		return newJSONReader(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// csvReader reads movies from CSV with a header row. The title, year, runtime
+// and genres columns are recognised in any order, other columns are ignored.
+// Genres are separated by "|".
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	row     int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("CSV input must start with a header row")
+		}
+		return nil, fmt.Errorf("CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV header must include a title column")
+	}
+
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Read() (Record, error) {
+	fields, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			c.row++
+			return Record{Row: c.row, Errors: map[string]string{"record": parseErr.Err.Error()}}, nil
+		}
+		return Record{}, err
+	}
+
+	c.row++
+	record := Record{Row: c.row}
+	errs := make(map[string]string)
+
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	record.Movie.Title = field("title")
+
+	if s := field("year"); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			errs["year"] = "must be an integer value"
+		}
+		record.Movie.Year = int32(year)
+	}
+
+	if s := field("runtime"); s != "" {
+		runtime, err := data.ParseRuntime(s)
+		if err != nil {
+			errs["runtime"] = err.Error()
+		}
+		record.Movie.Runtime = runtime
+	}
+
+	if s := field("genres"); s != "" {
+		for genre := range strings.SplitSeq(s, "|") {
+			record.Movie.GenreNames = append(record.Movie.GenreNames, strings.TrimSpace(genre))
+		}
+	}
+
+	if len(errs) > 0 {
+		record.Errors = errs
+	}
+
+	return record, nil
+}
+
+// ndjsonReader reads one JSON movie per line.
+type ndjsonReader struct {
+	s   *bufio.Scanner
+	row int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &ndjsonReader{s: s}
+}
+
+func (n *ndjsonReader) Read() (Record, error) {
+	for n.s.Scan() {
+		line := bytes.TrimSpace(n.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		n.row++
+		movie, errs := decodeMovie(line)
+		return Record{Row: n.row, Movie: movie, Errors: errs}, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return Record{}, fmt.Errorf("line %d is longer than %d bytes", n.row+1, maxLineSize)
+		}
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
+
+// jsonReader streams the elements of a JSON array of movies. The array is
+// either the whole document or the "results" member of an object.
+type jsonReader struct {
+	dec  *json.Decoder
+	row  int
+	done bool
+}
+
+func newJSONReader(r io.Reader) (*jsonReader, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("body contains badly-formed JSON: %w", err)
+	}
+
+	switch tok {
+	case json.Delim('['):
+	case json.Delim('{'):
+		if err := seekResults(dec); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("body must be a JSON array of movies or an object with a results array")
+	}
+
+	return &jsonReader{dec: dec}, nil
+}
+
+// seekResults advances dec past the opening bracket of the "results" array,
+// skipping any members that come before it.
+func seekResults(dec *json.Decoder) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("body contains badly-formed JSON: %w", err)
+		}
+
+		if key, _ := tok.(string); key == "results" {
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("body contains badly-formed JSON: %w", err)
+			}
+			if tok != json.Delim('[') {
+				return errors.New("results must be a JSON array")
+			}
+			return nil
+		}
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return fmt.Errorf("body contains badly-formed JSON: %w", err)
+		}
+	}
+
+	return errors.New("body must contain a results array")
+}
+
+func (j *jsonReader) Read() (Record, error) {
+	if j.done || !j.dec.More() {
+		j.done = true
+		return Record{}, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := j.dec.Decode(&raw); err != nil {
+		return Record{}, fmt.Errorf("body contains badly-formed JSON after row %d: %w", j.row, err)
+	}
+
+	j.row++
+	movie, errs := decodeMovie(raw)
+	return Record{Row: j.row, Movie: movie, Errors: errs}, nil
+}
+
+// jsonMovie is the shape accepted for JSON and NDJSON imports. It takes our own
+// export format as well as TMDB-style objects: runtime may be a number or
+// "N mins", genres may be names or {"name": ...} objects, and the year may be
+// given through release_date instead.
+type jsonMovie struct {
+	Title       string       `json:"title"`
+	Year        int32        `json:"year"`
+	ReleaseDate string       `json:"release_date"`
+	Runtime     data.Runtime `json:"runtime"`
+	Genres      []genreName  `json:"genres"`
+}
+
+type genreName string
+
+func (g *genreName) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*g = genreName(name)
+		return nil
+	}
+
+	var genre struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &genre); err != nil {
+		return err
+	}
+
+	*g = genreName(genre.Name)
+	return nil
+}
+
+func decodeMovie(raw []byte) (data.MovieInput, map[string]string) {
+	var m jsonMovie
+
+	err := json.Unmarshal(raw, &m)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return data.MovieInput{}, map[string]string{"record": "badly-formed JSON"}
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			return data.MovieInput{}, map[string]string{"runtime": err.Error()}
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			return data.MovieInput{}, map[string]string{unmarshalTypeError.Field: "incorrect JSON type"}
+		default:
+			return data.MovieInput{}, map[string]string{"record": "must be a JSON object describing a movie"}
+		}
+	}
+
+	input := data.MovieInput{
+		Title:   strings.TrimSpace(m.Title),
+		Year:    m.Year,
+		Runtime: m.Runtime,
+	}
+
+	if input.Year == 0 && len(m.ReleaseDate) >= 4 {
+		year, err := strconv.ParseInt(m.ReleaseDate[:4], 10, 32)
+		if err != nil {
+			return input, map[string]string{"release_date": "must start with a four digit year"}
+		}
+		input.Year = int32(year)
+	}
+
+	for _, genre := range m.Genres {
+		input.GenreNames = append(input.GenreNames, strings.TrimSpace(string(genre)))
+	}
+
+	return input, nil
+}
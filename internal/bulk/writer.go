@@ -0,0 +1,83 @@
+package bulk
+
+import (
+	"bufio"
+	"cinemesis/internal/data"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer encodes movies for an export. Output is buffered until Flush.
+type Writer interface {
+	Write(movie *data.Movie) error
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+var csvHeader = []string{"id", "title", "year", "runtime", "genres", "average_rating", "rating_count"}
+
+// csvWriter writes the columns the CSV importer understands, plus the ID and
+// rating summary, which the importer ignores.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	return &csvWriter{w: cw}
+}
+
+func (c *csvWriter) Write(movie *data.Movie) error {
+	genres := make([]string, len(movie.Genres))
+	for i, genre := range movie.Genres {
+		genres[i] = genre.Name
+	}
+
+	return c.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Runtime), 10),
+		strings.Join(genres, "|"),
+		strconv.FormatFloat(movie.AverageRating, 'f', -1, 64),
+		strconv.FormatInt(int64(movie.RatingCount), 10),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ndjsonWriter writes each movie as it appears in the JSON API, one per line.
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (n *ndjsonWriter) Write(movie *data.Movie) error {
+	return n.enc.Encode(movie)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buf.Flush()
+}
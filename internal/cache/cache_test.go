@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_GetSet(t *testing.T) {
+	c := New[string, int](10, time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("a", 1)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func TestCache_Expiry(t *testing.T) {
+	c := New[string, int](10, 10*time.Millisecond)
+
+	c.Set("a", 1)
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+}
+
+func TestCache_Delete(t *testing.T) {
+	c := New[string, int](10, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Delete("a")
+	c.DeleteFunc(func(_ string, v int) bool { return v == 2 })
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+
+	c.Clear()
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestCache_Disabled(t *testing.T) {
+	c := New[string, int](0, 0)
+
+	c.Set("a", 1)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
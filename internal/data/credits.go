@@ -0,0 +1,196 @@
+package data
+
+import (
+	"cinemesis/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	CreditCast            = "cast"
+	CreditDirector        = "director"
+	CreditWriter          = "writer"
+	CreditProducer        = "producer"
+	CreditComposer        = "composer"
+	CreditCinematographer = "cinematographer"
+	CreditEditor          = "editor"
+)
+
+var CreditRoles = []string{
+	CreditCast,
+	CreditDirector,
+	CreditWriter,
+	CreditProducer,
+	CreditComposer,
+	CreditCinematographer,
+	CreditEditor,
+}
+
+var (
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+// Credit links a person to a movie in a given role. Character is only set for
+// cast credits; BillingOrder ranks credits of the same role, lowest first.
+type Credit struct {
+	ID           int64  `json:"id"`
+	PersonID     int64  `json:"person_id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+type CreditInput struct {
+	PersonID     int64  `json:"person_id"`
+	Role         string `json:"role"`
+	Character    string `json:"character"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+// FilmographyEntry is a credit seen from the person's side.
+type FilmographyEntry struct {
+	CreditID     int64  `json:"credit_id"`
+	MovieID      int64  `json:"movie_id"`
+	Title        string `json:"title"`
+	Year         int32  `json:"year,omitzero"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", validator.CodeRequired, "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, CreditRoles...), "role", validator.CodeNotAllowed, "invalid credit role")
+	v.Check(credit.Role == CreditCast || credit.Character == "", "character", validator.CodeNotAllowed, "is only allowed for cast credits")
+	v.Check(len(credit.Character) <= 500, "character", validator.CodeTooLong, "must not be more than 500 bytes long")
+	v.Check(credit.BillingOrder >= 0, "billing_order", validator.CodeOutOfRange, "must not be negative")
+}
+
+func (m CreditModel) Insert(ctx context.Context, movieID int64, credit *Credit) error {
+	query := `
+        INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id`
+
+	args := []any{movieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_credits_unique_idx"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForMovie returns the movie's credits with the cast first, each role in
+// billing order.
+func (m CreditModel) GetForMovie(ctx context.Context, movieID int64) ([]Credit, error) {
+	query := `
+        SELECT c.id, c.person_id, p.name, c.role, c.character, c.billing_order
+        FROM movie_credits c
+        INNER JOIN people p ON p.id = c.person_id
+        WHERE c.movie_id = $1
+        ORDER BY c.role <> 'cast', c.role, c.billing_order, p.name`
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []Credit{}
+	for rows.Next() {
+		var credit Credit
+		err := rows.Scan(
+			&credit.ID,
+			&credit.PersonID,
+			&credit.Name,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, credit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// GetForPerson returns the person's filmography, newest movies first.
+func (m CreditModel) GetForPerson(ctx context.Context, personID int64) ([]FilmographyEntry, error) {
+	query := `
+        SELECT c.id, m.id, m.title, m.year, c.role, c.character, c.billing_order
+        FROM movie_credits c
+        INNER JOIN movies m ON m.id = c.movie_id
+        WHERE c.person_id = $1
+        ORDER BY m.year DESC, m.title, c.role`
+
+	rows, err := m.DB.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []FilmographyEntry{}
+	for rows.Next() {
+		var entry FilmographyEntry
+		err := rows.Scan(
+			&entry.CreditID,
+			&entry.MovieID,
+			&entry.Title,
+			&entry.Year,
+			&entry.Role,
+			&entry.Character,
+			&entry.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (m CreditModel) Delete(ctx context.Context, movieID, creditID int64) error {
+	query := `
+        DELETE FROM movie_credits
+        WHERE id = $1 AND movie_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, creditID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"cinemesis/internal/validator"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCredit(t *testing.T) {
+	tests := []struct {
+		name   string
+		credit *Credit
+		errors map[string]string
+	}{
+		{
+			name:   "Cast credit with character",
+			credit: &Credit{PersonID: 1, Role: CreditCast, Character: "Cléo"},
+		},
+		{
+			name:   "Director",
+			credit: &Credit{PersonID: 1, Role: CreditDirector},
+		},
+		{
+			name:   "Unknown role",
+			credit: &Credit{PersonID: 1, Role: "catering"},
+			errors: map[string]string{"role": "invalid credit role"},
+		},
+		{
+			name:   "Character on a crew credit",
+			credit: &Credit{PersonID: 1, Role: CreditWriter, Character: "Cléo"},
+			errors: map[string]string{"character": "is only allowed for cast credits"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateCredit(v, tt.credit)
+
+			if tt.errors == nil {
+				assert.True(t, v.Valid())
+				return
+			}
+			assert.Equal(t, tt.errors, v.Errors)
+		})
+	}
+}
+
+func TestCreditModel_Insert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := CreditModel{DB: db}
+	query := regexp.QuoteMeta(`INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)`)
+
+	t.Run("Success", func(t *testing.T) {
+		credit := &Credit{PersonID: 2, Role: CreditCast, Character: "Cléo", BillingOrder: 1}
+
+		mock.ExpectQuery(query).
+			WithArgs(int64(1), int64(2), CreditCast, "Cléo", int32(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+
+		err := m.Insert(context.Background(), 1, credit)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), credit.ID)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		credit := &Credit{PersonID: 2, Role: CreditDirector}
+
+		mock.ExpectQuery(query).
+			WithArgs(int64(1), int64(2), CreditDirector, "", int32(0)).
+			WillReturnError(errors.New(`pq: duplicate key value violates unique constraint "movie_credits_unique_idx"`))
+
+		err := m.Insert(context.Background(), 1, credit)
+		assert.ErrorIs(t, err, ErrDuplicateCredit)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCreditModel_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := CreditModel{DB: db}
+	query := regexp.QuoteMeta(`DELETE FROM movie_credits WHERE id = $1 AND movie_id = $2`)
+
+	mock.ExpectExec(query).
+		WithArgs(int64(5), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = m.Delete(context.Background(), 1, 5)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"cinemesis/internal/validator"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	// DeletionAnonymize scrubs the account but keeps its reviews and votes,
+	// attributed to a deleted user, so ratings and vote counts are unchanged.
+	DeletionAnonymize = "anonymize"
+	// DeletionDelete removes the account along with everything it wrote.
+	DeletionDelete = "delete"
+)
+
+// AccountDeletion is a pending request to delete a user's account.
+type AccountDeletion struct {
+	Mode         string    `json:"mode"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+type DeleteAccountInput struct {
+	Mode            string `json:"mode"`
+	CurrentPassword string `json:"current_password"`
+}
+
+func ValidateDeletionMode(v *validator.Validator, mode string) {
+	v.Check(validator.PermittedValue(mode, DeletionAnonymize, DeletionDelete), "mode", validator.CodeNotAllowed, "must be anonymize or delete")
+}
+
+// anonymizedTables hold data that is only about the user, and is removed when
+// an account is anonymized. Everything else referencing users is kept.
+var anonymizedTables = []string{"tokens", "users_permissions", "users_roles", "watchlist", "diary_entries", "lists", "data_exports", "user_totp", "recovery_codes"}
+
+// ScheduleDeletion marks the user's account for deletion at the given time, as
+// part of tx. Asking again while a deletion is pending only changes its mode;
+// the date it was first scheduled for stays.
+func (m UserModel) ScheduleDeletion(ctx context.Context, tx *sql.Tx, userID int64, mode string, at time.Time) (*AccountDeletion, error) {
+	query := `
+        UPDATE users
+        SET deletion_mode = $2, deletion_scheduled_for = COALESCE(deletion_scheduled_for, $3)
+        WHERE id = $1 AND deleted_at IS NULL
+        RETURNING deletion_mode, deletion_scheduled_for`
+
+	var deletion AccountDeletion
+	err := tx.QueryRowContext(ctx, query, userID, mode, at).Scan(&deletion.Mode, &deletion.ScheduledFor)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &deletion, nil
+}
+
+// CancelDeletion withdraws the user's pending deletion, returning
+// ErrRecordNotFound if there is none.
+func (m UserModel) CancelDeletion(ctx context.Context, userID int64) error {
+	query := `
+        UPDATE users
+        SET deletion_mode = NULL, deletion_scheduled_for = NULL
+        WHERE id = $1 AND deletion_scheduled_for IS NOT NULL`
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeNextDue carries out one deletion whose grace period is over and returns
+// the user ID and mode, or ErrRecordNotFound when none is due. Like the outbox,
+// it can run on several instances at once.
+//
+// Hard deletes rely on the ON DELETE CASCADE rules, with the
+// users_release_review_votes trigger taking the user's votes off the vote
+// counts of other users' reviews first, and the reviews_movie_rating trigger
+// updating the ratings of movies the user reviewed.
+func (m UserModel) PurgeNextDue(ctx context.Context) (int64, string, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT id, email, deletion_mode
+        FROM users
+        WHERE deletion_scheduled_for <= NOW()
+        ORDER BY deletion_scheduled_for, id
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED`
+
+	var userID int64
+	var email, mode string
+
+	err = tx.QueryRowContext(ctx, query).Scan(&userID, &email, &mode)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, "", ErrRecordNotFound
+		default:
+			return 0, "", err
+		}
+	}
+
+	switch mode {
+	case DeletionDelete:
+		_, err = tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	default:
+		err = anonymizeUser(ctx, tx, userID)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The outbox is the only other place the address is kept.
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_outbox WHERE LOWER(recipient) = LOWER($1)`, email)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return userID, mode, nil
+}
+
+func anonymizeUser(ctx context.Context, tx *sql.Tx, userID int64) error {
+	for _, table := range anonymizedTables {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A hash of a password nobody knows, rather than an empty one, so signing
+	// in as the deleted user fails like any wrong password does.
+	var p password
+	err := p.Set(rand.Text())
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE users
+        SET name = 'Deleted user', email = 'deleted-' || id || '@users.invalid', password_hash = $2,
+            activated = false, deletion_mode = NULL, deletion_scheduled_for = NULL,
+            deleted_at = NOW(), version = version + 1
+        WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, query, userID, p.hash)
+	return err
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserModel_ScheduleDeletion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := UserModel{DB: db}
+	at := time.Now().Add(14 * 24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE users`)).
+		WithArgs(int64(7), DeletionDelete, at).
+		WillReturnRows(sqlmock.NewRows([]string{"deletion_mode", "deletion_scheduled_for"}).AddRow(DeletionDelete, at))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	deletion, err := m.ScheduleDeletion(context.Background(), tx, 7, DeletionDelete, at)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, DeletionDelete, deletion.Mode)
+	assert.Equal(t, at, deletion.ScheduledFor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserModel_CancelDeletion_NoneScheduled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := UserModel{DB: db}
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users`)).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = m.CancelDeletion(context.Background(), 7)
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserModel_PurgeNextDue_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := UserModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, deletion_mode`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "deletion_mode"}).AddRow(7, "alice@example.com", DeletionDelete))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = $1`)).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM email_outbox`)).
+		WithArgs("alice@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	userID, mode, err := m.PurgeNextDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+	assert.Equal(t, DeletionDelete, mode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserModel_PurgeNextDue_Anonymize(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := UserModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, deletion_mode`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "deletion_mode"}).AddRow(7, "alice@example.com", DeletionAnonymize))
+	for _, table := range anonymizedTables {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM ` + table + ` WHERE user_id = $1`)).
+			WithArgs(int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`SET name = 'Deleted user'`)).
+		WithArgs(int64(7), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM email_outbox`)).
+		WithArgs("alice@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	userID, mode, err := m.PurgeNextDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+	assert.Equal(t, DeletionAnonymize, mode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserModel_PurgeNextDue_NoneDue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := UserModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, deletion_mode`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "deletion_mode"}))
+	mock.ExpectRollback()
+
+	_, _, err = m.PurgeNextDue(context.Background())
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
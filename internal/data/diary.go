@@ -0,0 +1,193 @@
+package data
+
+import (
+	"cinemesis/internal/filters"
+	"cinemesis/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DateLayout is the format of calendar dates such as DiaryEntry.WatchedOn.
+const DateLayout = "2006-01-02"
+
+// DiaryEntry records one viewing of a movie. Rating is optional and, unlike a
+// review rating, private to the user; zero means no rating.
+type DiaryEntry struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year,omitzero"`
+	WatchedOn string    `json:"watched_on"`
+	Rewatch   bool      `json:"rewatch"`
+	Rating    uint8     `json:"rating,omitzero"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"-"`
+	Version   int32     `json:"version"`
+}
+
+type DiaryEntryInput struct {
+	MovieID   int64  `json:"movie_id"`
+	WatchedOn string `json:"watched_on"`
+	Rewatch   bool   `json:"rewatch"`
+	Rating    uint8  `json:"rating"`
+	Notes     string `json:"notes"`
+}
+
+type DiaryModel struct {
+	DB *sql.DB
+}
+
+func ValidateDiaryEntry(v *validator.Validator, entry *DiaryEntry) {
+	v.Check(entry.MovieID > 0, "movie_id", validator.CodeRequired, "must be provided")
+	v.Check(entry.Rating <= 10, "rating", validator.CodeOutOfRange, "must be between 1 and 10")
+	v.Check(len(entry.Notes) <= 10_000, "notes", validator.CodeTooLong, "must not be more than 10000 bytes long")
+
+	watchedOn, err := time.Parse(DateLayout, entry.WatchedOn)
+	if err != nil {
+		v.AddError("watched_on", validator.CodeInvalidFormat, "must be a date in YYYY-MM-DD format")
+		return
+	}
+	v.Check(watchedOn.Year() >= 1888, "watched_on", validator.CodeOutOfRange, "must be after 1888")
+	// A day of slack, since the user's calendar day may already be tomorrow in UTC.
+	v.Check(watchedOn.Before(time.Now().AddDate(0, 0, 1)), "watched_on", validator.CodeOutOfRange, "must not be in the future")
+}
+
+func (m DiaryModel) Insert(ctx context.Context, userID int64, entry *DiaryEntry) error {
+	query := `
+        INSERT INTO diary_entries (user_id, movie_id, watched_on, rewatch, rating, notes)
+        VALUES ($1, $2, $3::date, $4, NULLIF($5, 0), $6)
+        RETURNING id, created_at, version`
+
+	args := []any{userID, entry.MovieID, entry.WatchedOn, entry.Rewatch, entry.Rating, entry.Notes}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt, &entry.Version)
+}
+
+// Get returns one of the user's diary entries. Entries of other users are
+// reported as not found.
+func (m DiaryModel) Get(ctx context.Context, userID, id int64) (*DiaryEntry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT d.id, d.movie_id, m.title, m.year, to_char(d.watched_on, 'YYYY-MM-DD'),
+            d.rewatch, COALESCE(d.rating, 0), d.notes, d.created_at, d.version
+        FROM diary_entries d
+        INNER JOIN movies m ON m.id = d.movie_id
+        WHERE d.id = $1 AND d.user_id = $2`
+
+	var entry DiaryEntry
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&entry.ID,
+		&entry.MovieID,
+		&entry.Title,
+		&entry.Year,
+		&entry.WatchedOn,
+		&entry.Rewatch,
+		&entry.Rating,
+		&entry.Notes,
+		&entry.CreatedAt,
+		&entry.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+func (m DiaryModel) GetAll(ctx context.Context, userID int64, df filters.DiaryFilters) ([]*DiaryEntry, int, error) {
+	query, args := filters.NewQueryBuilder().BuildDiaryQuery(userID, df)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*DiaryEntry{}
+	var totalRecords int
+
+	for rows.Next() {
+		var entry DiaryEntry
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.MovieID,
+			&entry.Title,
+			&entry.Year,
+			&entry.WatchedOn,
+			&entry.Rewatch,
+			&entry.Rating,
+			&entry.Notes,
+			&entry.CreatedAt,
+			&entry.Version,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, totalRecords, nil
+}
+
+func (m DiaryModel) Update(ctx context.Context, userID int64, entry *DiaryEntry) error {
+	query := `
+        UPDATE diary_entries
+        SET watched_on = $1::date, rewatch = $2, rating = NULLIF($3, 0), notes = $4, version = version + 1
+        WHERE id = $5 AND user_id = $6 AND version = $7
+        RETURNING version`
+
+	args := []any{entry.WatchedOn, entry.Rewatch, entry.Rating, entry.Notes, entry.ID, userID, entry.Version}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m DiaryModel) Delete(ctx context.Context, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM diary_entries
+        WHERE id = $1 AND user_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
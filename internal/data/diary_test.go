@@ -0,0 +1,55 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"cinemesis/internal/validator"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDiaryEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		entry  *DiaryEntry
+		errors map[string]string
+	}{
+		{
+			name:  "Valid",
+			entry: &DiaryEntry{MovieID: 1, WatchedOn: "2024-03-01", Rating: 8},
+		},
+		{
+			name:  "Without rating",
+			entry: &DiaryEntry{MovieID: 1, WatchedOn: "2024-03-01", Rewatch: true},
+		},
+		{
+			name:   "Bad date",
+			entry:  &DiaryEntry{MovieID: 1, WatchedOn: "01/03/2024"},
+			errors: map[string]string{"watched_on": "must be a date in YYYY-MM-DD format"},
+		},
+		{
+			name:   "Future date",
+			entry:  &DiaryEntry{MovieID: 1, WatchedOn: time.Now().AddDate(0, 0, 3).Format(DateLayout)},
+			errors: map[string]string{"watched_on": "must not be in the future"},
+		},
+		{
+			name:   "Rating out of range",
+			entry:  &DiaryEntry{MovieID: 1, WatchedOn: "2024-03-01", Rating: 11},
+			errors: map[string]string{"rating": "must be between 1 and 10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateDiaryEntry(v, tt.entry)
+
+			if tt.errors == nil {
+				assert.True(t, v.Valid())
+				return
+			}
+			assert.Equal(t, tt.errors, v.Errors)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+)
+
+// DataExport is a request for a copy of everything stored about a user. It is
+// built in the background and downloaded with a token mailed to the user.
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+// archiveQuery builds the archive of user $1 in a single statement, so every
+// section is read from the same snapshot. Password and token hashes and the
+// TOTP secret are left out.
+const archiveQuery = `
+        SELECT json_build_object(
+            'generated_at', NOW(),
+            'profile', (
+                SELECT json_build_object('id', id, 'created_at', created_at, 'name', name, 'email', email,
+                                         'activated', activated, 'locale', locale)
+                FROM users WHERE id = $1),
+            'roles', COALESCE((
+                SELECT json_agg(roles.name ORDER BY roles.name)
+                FROM roles INNER JOIN users_roles ON users_roles.role_id = roles.id
+                WHERE users_roles.user_id = $1), '[]'),
+            'permissions', COALESCE((
+                SELECT json_agg(code ORDER BY code) FROM (
+                    SELECT permissions.code
+                    FROM permissions
+                    INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+                    WHERE users_permissions.user_id = $1
+                    UNION
+                    SELECT permissions.code
+                    FROM permissions
+                    INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+                    INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+                    WHERE users_roles.user_id = $1) p), '[]'),
+            'reviews', COALESCE((
+                SELECT json_agg(json_build_object('id', id, 'movie_id', movie_id, 'created_at', created_at, 'rating', rating,
+                                                  'text', text, 'edited', edited, 'upvotes', upvotes, 'downvotes', downvotes) ORDER BY id)
+                FROM reviews WHERE user_id = $1), '[]'),
+            'votes', COALESCE((
+                SELECT json_agg(json_build_object('review_id', review_id, 'vote_type', vote_type) ORDER BY review_id)
+                FROM review_votes WHERE user_id = $1), '[]'),
+            'two_factor', (
+                SELECT json_build_object('confirmed_at', confirmed_at, 'recovery_codes_left', (
+                    SELECT count(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL))
+                FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL),
+            'tokens', COALESCE((
+                SELECT json_agg(json_build_object('scope', scope, 'session_id', session_id, 'user_agent', user_agent,
+                                                  'created_at', created_at, 'last_used_at', last_used_at, 'expiry', expiry) ORDER BY created_at)
+                FROM tokens WHERE user_id = $1), '[]'),
+            'watchlist', COALESCE((
+                SELECT json_agg(json_build_object('movie_id', movie_id, 'added_at', added_at) ORDER BY added_at)
+                FROM watchlist WHERE user_id = $1), '[]'),
+            'diary', COALESCE((
+                SELECT json_agg(json_build_object('id', id, 'movie_id', movie_id, 'watched_on', watched_on, 'rewatch', rewatch,
+                                                  'rating', rating, 'notes', notes) ORDER BY watched_on, id)
+                FROM diary_entries WHERE user_id = $1), '[]'),
+            'lists', COALESCE((
+                SELECT json_agg(json_build_object('id', l.id, 'name', l.name, 'description', l.description, 'public', l.public,
+                                                  'created_at', l.created_at, 'movies', COALESCE((
+                                                      SELECT json_agg(json_build_object('movie_id', movie_id, 'note', note) ORDER BY position)
+                                                      FROM list_items WHERE list_id = l.id), '[]')) ORDER BY l.id)
+                FROM lists l WHERE l.user_id = $1), '[]')
+        )`
+
+// Request returns the user's pending export, creating one if there is none.
+func (m ExportModel) Request(ctx context.Context, userID int64) (*DataExport, error) {
+	query := `
+        INSERT INTO data_exports (user_id)
+        VALUES ($1)
+        ON CONFLICT (user_id) WHERE status = 'pending' DO UPDATE SET user_id = EXCLUDED.user_id
+        RETURNING id, created_at, status`
+
+	export := DataExport{UserID: userID}
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&export.ID, &export.CreatedAt, &export.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// ClaimNext locks the oldest pending export for the rest of tx, skipping those
+// other workers hold. It returns ErrRecordNotFound when there is none.
+func (m ExportModel) ClaimNext(ctx context.Context, tx *sql.Tx) (*DataExport, error) {
+	query := `
+        SELECT id, user_id, created_at, status
+        FROM data_exports
+        WHERE status = 'pending'
+        ORDER BY id
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED`
+
+	var export DataExport
+	err := tx.QueryRowContext(ctx, query).Scan(&export.ID, &export.UserID, &export.CreatedAt, &export.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// Complete builds the archive of a claimed export as part of tx and makes it
+// downloadable for ttl. It returns the plaintext download token, which is only
+// stored hashed.
+func (m ExportModel) Complete(ctx context.Context, tx *sql.Tx, export *DataExport, ttl time.Duration) (string, error) {
+	plaintext := rand.Text()
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+        UPDATE data_exports
+        SET status = 'ready', archive = (` + archiveQuery + `), download_hash = $2,
+            completed_at = NOW(), expires_at = $3
+        WHERE id = $4
+        RETURNING status, completed_at, expires_at`
+
+	args := []any{export.UserID, hash[:], time.Now().Add(ttl), export.ID}
+
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&export.Status, &export.CompletedAt, &export.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// GetArchive returns the ID and archive of the unexpired export a download
+// token was issued for.
+func (m ExportModel) GetArchive(ctx context.Context, tokenPlaintext string) (int64, []byte, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT id, archive
+        FROM data_exports
+        WHERE download_hash = $1 AND status = 'ready' AND expires_at > NOW()`
+
+	var id int64
+	var archive []byte
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(&id, &archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, nil, ErrRecordNotFound
+		default:
+			return 0, nil, err
+		}
+	}
+
+	return id, archive, nil
+}
+
+// DeleteExpired removes exports past their expiry, archive and all.
+func (m ExportModel) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+        DELETE FROM data_exports
+        WHERE status = 'ready' AND expires_at <= NOW()`
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
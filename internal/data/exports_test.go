@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportModel_Request(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := ExportModel{DB: db}
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`ON CONFLICT (user_id) WHERE status = 'pending'`)).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "status"}).AddRow(3, now, ExportPending))
+
+	export, err := m.Request(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), export.ID)
+	assert.Equal(t, ExportPending, export.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportModel_Complete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := ExportModel{DB: db}
+	now := time.Now()
+	expires := now.Add(7 * 24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE data_exports`)).
+		WithArgs(int64(7), sqlmock.AnyArg(), sqlmock.AnyArg(), int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "completed_at", "expires_at"}).AddRow(ExportReady, now, expires))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	export := &DataExport{ID: 3, UserID: 7, Status: ExportPending}
+	token, err := m.Complete(context.Background(), tx, export, 7*24*time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.Len(t, token, 26)
+	assert.Equal(t, ExportReady, export.Status)
+	require.NotNil(t, export.ExpiresAt)
+	assert.Equal(t, expires, *export.ExpiresAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportModel_GetArchive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := ExportModel{DB: db}
+	token := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	hash := sha256.Sum256([]byte(token))
+
+	t.Run("Found", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, archive`)).
+			WithArgs(hash[:]).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "archive"}).AddRow(3, []byte(`{"profile":{"id":7}}`)))
+
+		id, archive, err := m.GetArchive(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), id)
+		assert.JSONEq(t, `{"profile":{"id":7}}`, string(archive))
+	})
+
+	t.Run("Expired or unknown", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, archive`)).
+			WithArgs(hash[:]).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "archive"}))
+
+		_, _, err := m.GetArchive(context.Background(), token)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -13,8 +13,9 @@ import (
 )
 
 type Genre struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Version int32  `json:"version,omitzero"`
 }
 
 type GenreInput struct {
@@ -22,28 +23,34 @@ type GenreInput struct {
 }
 
 func ValidateGenre(v *validator.Validator, genres *[]string) {
-	v.Check(genres != nil, "genres", "must be provided")
-	v.Check(len(*genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(*genres) <= 5, "genres", "must not contain more than 5 genres")
-	v.Check(validator.Unique(*genres), "genres", "must not contain duplicate values")
-	for _, genre := range *genres {
-		v.Check(len(strings.TrimSpace(genre)) > 0, "genres", "must not contain empty values")
-		v.Check(len(genre) <= 100, "genres", "must not be more than 100 bytes long")
+	if genres == nil {
+		v.AddError("genres", validator.CodeRequired, "must be provided")
+		return
 	}
+
+	v.Strings("genres", *genres,
+		validator.MinLen(1).Message("must contain at least 1 genre"),
+		validator.MaxLen(5).Message("must not contain more than 5 genres"),
+		validator.UniqueValues(),
+		validator.Each(
+			validator.NotBlank().Message("must not contain empty values"),
+			validator.MaxLen(100),
+		),
+	)
 }
 
 type GenreModel struct {
 	DB *sql.DB
 }
 
-func (g GenreModel) Insert(genreName string) (Genre, error) {
+func (g GenreModel) Insert(ctx context.Context, genreName string) (Genre, error) {
 	query := `
 		INSERT INTO genres (name)
 		SELECT $1
 		WHERE NOT EXISTS (SELECT 1 FROM genres WHERE name = $1)
 		RETURNING id, name`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var genre Genre
@@ -180,7 +187,7 @@ func (g GenreModel) Get(ctx context.Context, id int64) (*Genre, error) {
 	}
 
 	query := `
-		SELECT id, name
+		SELECT id, name, version
 		FROM genres
 		WHERE id = $1`
 
@@ -189,6 +196,7 @@ func (g GenreModel) Get(ctx context.Context, id int64) (*Genre, error) {
 	err := g.DB.QueryRowContext(ctx, query, id).Scan(
 		&genre.ID,
 		&genre.Name,
+		&genre.Version,
 	)
 
 	if err != nil {
@@ -287,15 +295,14 @@ func (g GenreModel) GetAll(ctx context.Context) ([]Genre, error) {
 	return genres, nil
 }
 
-func (g GenreModel) Update(ctx context.Context, id int64, newName string) error {
-	query := `UPDATE genres SET name = $1 WHERE id = $2 RETURNING id`
+func (g GenreModel) Update(ctx context.Context, genre *Genre) error {
+	query := `UPDATE genres SET name = $1, version = version + 1 WHERE id = $2 AND version = $3 RETURNING version`
 
-	var updatedID int64
-	err := g.DB.QueryRowContext(ctx, query, newName, id).Scan(&updatedID)
+	err := g.DB.QueryRowContext(ctx, query, genre.Name, genre.ID, genre.Version).Scan(&genre.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
+			return ErrEditConflict
 		default:
 			return err
 		}
@@ -328,3 +335,27 @@ func (g GenreModel) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+func (g GenreModel) DeleteVersion(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM genres WHERE id = $1 AND version = $2`
+
+	result, err := g.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -28,7 +28,7 @@ func TestGenreModel_Insert(t *testing.T) {
 			WithArgs(genreName).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, genreName))
 
-		genre, err := model.Insert(genreName)
+		genre, err := model.Insert(context.Background(), genreName)
 		require.NoError(t, err)
 		assert.Equal(t, expectedGenre, genre)
 	})
@@ -40,7 +40,7 @@ func TestGenreModel_Insert(t *testing.T) {
 			WithArgs(genreName).
 			WillReturnError(sql.ErrNoRows)
 
-		_, err := model.Insert(genreName)
+		_, err := model.Insert(context.Background(), genreName)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "duplicate genre name")
 	})
@@ -53,7 +53,7 @@ func TestGenreModel_Insert(t *testing.T) {
 			WithArgs(genreName).
 			WillReturnError(expectedErr)
 
-		_, err := model.Insert(genreName)
+		_, err := model.Insert(context.Background(), genreName)
 		assert.ErrorIs(t, err, expectedErr)
 	})
 }
@@ -229,12 +229,12 @@ func TestGenreModel_Get(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		genreID := int64(1)
-		expectedGenre := &Genre{ID: genreID, Name: "Action"}
+		expectedGenre := &Genre{ID: genreID, Name: "Action", Version: 2}
 
-		mock.ExpectQuery(`SELECT id, name FROM genres WHERE id = \$1`).
+		mock.ExpectQuery(`SELECT id, name, version FROM genres WHERE id = \$1`).
 			WithArgs(genreID).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
-				AddRow(genreID, "Action"))
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "version"}).
+				AddRow(genreID, "Action", 2))
 
 		genre, err := model.Get(ctx, genreID)
 		require.NoError(t, err)
@@ -244,7 +244,7 @@ func TestGenreModel_Get(t *testing.T) {
 	t.Run("NotFound", func(t *testing.T) {
 		genreID := int64(999)
 
-		mock.ExpectQuery(`SELECT id, name FROM genres WHERE id = \$1`).
+		mock.ExpectQuery(`SELECT id, name, version FROM genres WHERE id = \$1`).
 			WithArgs(genreID).
 			WillReturnError(sql.ErrNoRows)
 
@@ -261,7 +261,7 @@ func TestGenreModel_Get(t *testing.T) {
 		genreID := int64(1)
 		expectedErr := errors.New("database error")
 
-		mock.ExpectQuery(`SELECT id, name FROM genres WHERE id = \$1`).
+		mock.ExpectQuery(`SELECT id, name, version FROM genres WHERE id = \$1`).
 			WithArgs(genreID).
 			WillReturnError(expectedErr)
 
@@ -401,40 +401,40 @@ func TestGenreModel_Update(t *testing.T) {
 	ctx := context.Background()
 	model := GenreModel{DB: db}
 
+	const query = `UPDATE genres SET name = \$1, version = version \+ 1 WHERE id = \$2 AND version = \$3 RETURNING version`
+
 	t.Run("Success", func(t *testing.T) {
-		genreID := int64(1)
-		newName := "New Action"
+		genre := &Genre{ID: 1, Name: "New Action", Version: 2}
 
-		mock.ExpectQuery(`UPDATE genres SET name = \$1 WHERE id = \$2 RETURNING id`).
-			WithArgs(newName, genreID).
-			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(genreID))
+		mock.ExpectQuery(query).
+			WithArgs(genre.Name, genre.ID, int32(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
 
-		err := model.Update(ctx, genreID, newName)
+		err := model.Update(ctx, genre)
 		require.NoError(t, err)
+		assert.Equal(t, int32(3), genre.Version)
 	})
 
-	t.Run("NotFound", func(t *testing.T) {
-		genreID := int64(999)
-		newName := "New Action"
+	t.Run("EditConflict", func(t *testing.T) {
+		genre := &Genre{ID: 1, Name: "New Action", Version: 2}
 
-		mock.ExpectQuery(`UPDATE genres SET name = \$1 WHERE id = \$2 RETURNING id`).
-			WithArgs(newName, genreID).
+		mock.ExpectQuery(query).
+			WithArgs(genre.Name, genre.ID, int32(2)).
 			WillReturnError(sql.ErrNoRows)
 
-		err := model.Update(ctx, genreID, newName)
-		assert.ErrorIs(t, err, ErrRecordNotFound)
+		err := model.Update(ctx, genre)
+		assert.ErrorIs(t, err, ErrEditConflict)
 	})
 
 	t.Run("DatabaseError", func(t *testing.T) {
-		genreID := int64(1)
-		newName := "New Action"
+		genre := &Genre{ID: 1, Name: "New Action", Version: 2}
 		expectedErr := errors.New("database error")
 
-		mock.ExpectQuery(`UPDATE genres SET name = \$1 WHERE id = \$2 RETURNING id`).
-			WithArgs(newName, genreID).
+		mock.ExpectQuery(query).
+			WithArgs(genre.Name, genre.ID, int32(2)).
 			WillReturnError(expectedErr)
 
-		err := model.Update(ctx, genreID, newName)
+		err := model.Update(ctx, genre)
 		assert.ErrorIs(t, err, expectedErr)
 	})
 }
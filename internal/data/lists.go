@@ -0,0 +1,396 @@
+package data
+
+import (
+	"cinemesis/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateListItem = errors.New("movie already in list")
+	ErrInvalidListOrder  = errors.New("list order must contain every movie of the list exactly once")
+)
+
+// List is a user's named, ordered collection of movies. Private lists are only
+// visible to their owner. Items is only loaded for a single list.
+type List struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Public      bool       `json:"public"`
+	ItemCount   int32      `json:"item_count"`
+	Items       []ListItem `json:"items,omitempty"`
+	Version     int32      `json:"version"`
+}
+
+type ListInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+}
+
+// ListItem is a movie in a list. Positions start at 1 and have no gaps.
+type ListItem struct {
+	MovieID  int64     `json:"movie_id"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year,omitzero"`
+	Position int32     `json:"position"`
+	Note     string    `json:"note,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// ListItemInput adds a movie to a list. A zero Position appends it.
+type ListItemInput struct {
+	MovieID  int64  `json:"movie_id"`
+	Position int32  `json:"position"`
+	Note     string `json:"note"`
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.Check(len(list.Name) <= 200, "name", validator.CodeTooLong, "must not be more than 200 bytes long")
+	v.Check(len(list.Description) <= 10_000, "description", validator.CodeTooLong, "must not be more than 10000 bytes long")
+}
+
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(item.MovieID > 0, "movie_id", validator.CodeRequired, "must be provided")
+	v.Check(item.Position >= 0, "position", validator.CodeOutOfRange, "must not be negative")
+	v.Check(len(item.Note) <= 1000, "note", validator.CodeTooLong, "must not be more than 1000 bytes long")
+}
+
+func (m ListModel) Insert(ctx context.Context, list *List) error {
+	query := `
+        INSERT INTO lists (user_id, name, description, public)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, updated_at, version`
+
+	args := []any{list.UserID, list.Name, list.Description, list.Public}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+}
+
+func (m ListModel) Get(ctx context.Context, id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT l.id, l.user_id, l.created_at, l.updated_at, l.name, l.description, l.public,
+            (SELECT count(*) FROM list_items i WHERE i.list_id = l.id), l.version
+        FROM lists l
+        WHERE l.id = $1`
+
+	var list List
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.ID,
+		&list.UserID,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Name,
+		&list.Description,
+		&list.Public,
+		&list.ItemCount,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetForUser returns the user's lists, most recently updated first. Private
+// lists are left out unless includePrivate is set.
+func (m ListModel) GetForUser(ctx context.Context, userID int64, includePrivate bool) ([]*List, error) {
+	query := `
+        SELECT l.id, l.user_id, l.created_at, l.updated_at, l.name, l.description, l.public,
+            (SELECT count(*) FROM list_items i WHERE i.list_id = l.id), l.version
+        FROM lists l
+        WHERE l.user_id = $1 AND (l.public OR $2)
+        ORDER BY l.updated_at DESC, l.id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, includePrivate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(
+			&list.ID,
+			&list.UserID,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.Name,
+			&list.Description,
+			&list.Public,
+			&list.ItemCount,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (m ListModel) GetItems(ctx context.Context, listID int64) ([]ListItem, error) {
+	query := `
+        SELECT i.movie_id, m.title, m.year, i.position, i.note, i.added_at
+        FROM list_items i
+        INNER JOIN movies m ON m.id = i.movie_id
+        WHERE i.list_id = $1
+        ORDER BY i.position`
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ListItem{}
+	for rows.Next() {
+		var item ListItem
+		err := rows.Scan(
+			&item.MovieID,
+			&item.Title,
+			&item.Year,
+			&item.Position,
+			&item.Note,
+			&item.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Update saves the list's name, description and visibility. When order is not
+// nil it also renumbers the items to follow it; order must then hold every
+// movie of the list exactly once.
+func (m ListModel) Update(ctx context.Context, list *List, order []int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE lists
+        SET name = $1, description = $2, public = $3, updated_at = NOW(), version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING updated_at, version`
+
+	args := []any{list.Name, list.Description, list.Public, list.ID, list.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if order != nil {
+		err = reorderListItems(ctx, tx, list.ID, order)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func reorderListItems(ctx context.Context, tx *sql.Tx, listID int64, order []int64) error {
+	rows, err := tx.QueryContext(ctx, `SELECT movie_id FROM list_items WHERE list_id = $1`, listID)
+	if err != nil {
+		return err
+	}
+
+	var current []int64
+	for rows.Next() {
+		var movieID int64
+		if err := rows.Scan(&movieID); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, movieID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sorted := slices.Clone(order)
+	slices.Sort(sorted)
+	slices.Sort(current)
+	if !slices.Equal(sorted, current) {
+		return ErrInvalidListOrder
+	}
+
+	query := `
+        UPDATE list_items i
+        SET position = o.position
+        FROM unnest($2::bigint[]) WITH ORDINALITY AS o(movie_id, position)
+        WHERE i.list_id = $1 AND i.movie_id = o.movie_id`
+
+	_, err = tx.ExecContext(ctx, query, listID, pq.Array(order))
+	return err
+}
+
+// AddItem puts a movie into the list at item.Position, moving later items down,
+// or at the end when the position is zero or past the end.
+func (m ListModel) AddItem(ctx context.Context, listID int64, item *ListItem) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the list serialises concurrent changes to its positions.
+	_, err = tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return err
+	}
+
+	var last int32
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(position), 0) FROM list_items WHERE list_id = $1`, listID).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	if item.Position == 0 || item.Position > last {
+		item.Position = last + 1
+	} else {
+		_, err = tx.ExecContext(ctx, `
+            UPDATE list_items SET position = position + 1
+            WHERE list_id = $1 AND position >= $2`, listID, item.Position)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+        INSERT INTO list_items (list_id, movie_id, position, note)
+        VALUES ($1, $2, $3, $4)
+        RETURNING added_at`
+
+	err = tx.QueryRowContext(ctx, query, listID, item.MovieID, item.Position, item.Note).Scan(&item.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "list_items_pkey"`:
+			return ErrDuplicateListItem
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE lists SET updated_at = NOW() WHERE id = $1`, listID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveItem takes a movie out of the list and closes the gap it leaves.
+func (m ListModel) RemoveItem(ctx context.Context, listID, movieID int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return err
+	}
+
+	var position int32
+	err = tx.QueryRowContext(ctx, `
+        DELETE FROM list_items
+        WHERE list_id = $1 AND movie_id = $2
+        RETURNING position`, listID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE list_items SET position = position - 1
+        WHERE list_id = $1 AND position > $2`, listID, position)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE lists SET updated_at = NOW() WHERE id = $1`, listID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ListModel) Delete(ctx context.Context, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM lists
+        WHERE id = $1 AND user_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
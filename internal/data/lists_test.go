@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"cinemesis/internal/validator"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateList(t *testing.T) {
+	v := validator.New()
+	ValidateList(v, &List{Name: "Nouvelle Vague"})
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	ValidateList(v, &List{})
+	assert.Equal(t, map[string]string{"name": "must be provided"}, v.Errors)
+}
+
+func TestListModel_AddItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := ListModel{DB: db}
+
+	t.Run("Append", func(t *testing.T) {
+		item := &ListItem{MovieID: 5}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT id FROM lists WHERE id = $1 FOR UPDATE`)).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(position), 0) FROM list_items`)).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO list_items (list_id, movie_id, position, note)`)).
+			WithArgs(int64(1), int64(5), int32(4), "").
+			WillReturnRows(sqlmock.NewRows([]string{"added_at"}).AddRow(time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE lists SET updated_at = NOW()`)).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := m.AddItem(context.Background(), 1, item)
+		require.NoError(t, err)
+		assert.Equal(t, int32(4), item.Position)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		item := &ListItem{MovieID: 5, Position: 1}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT id FROM lists WHERE id = $1 FOR UPDATE`)).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(position), 0) FROM list_items`)).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(4))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE list_items SET position = position + 1`)).
+			WithArgs(int64(1), int32(1)).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO list_items (list_id, movie_id, position, note)`)).
+			WithArgs(int64(1), int64(5), int32(1), "").
+			WillReturnError(errors.New(`pq: duplicate key value violates unique constraint "list_items_pkey"`))
+		mock.ExpectRollback()
+
+		err := m.AddItem(context.Background(), 1, item)
+		assert.ErrorIs(t, err, ErrDuplicateListItem)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListModel_UpdateRejectsIncompleteOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := ListModel{DB: db}
+	list := &List{ID: 1, Name: "Favourites", Version: 2}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE lists`)).
+		WithArgs("Favourites", "", false, int64(1), int32(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at", "version"}).AddRow(time.Now(), 3))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT movie_id FROM list_items WHERE list_id = $1`)).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"movie_id"}).AddRow(5).AddRow(6))
+	mock.ExpectRollback()
+
+	err = m.Update(context.Background(), list, []int64{6})
+	assert.ErrorIs(t, err, ErrInvalidListOrder)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// LockoutEmail counts failed sign-ins for an email address.
+	LockoutEmail = "email"
+	// LockoutIP counts failed sign-ins from a client IP.
+	LockoutIP = "ip"
+	// LockoutMail counts requests to send password reset and activation
+	// emails to an address.
+	LockoutMail = "mail"
+)
+
+// AuthFailures tracks failed attempts for one email address or IP.
+type AuthFailures struct {
+	Kind          string     `json:"kind"`
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// Locked reports whether attempts are refused outright at t.
+func (f *AuthFailures) Locked(t time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(t)
+}
+
+// LockoutSubject is how an email address is keyed, matching the
+// case-insensitive uniqueness of user emails.
+func LockoutSubject(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type LockoutModel struct {
+	DB *sql.DB
+}
+
+func (m LockoutModel) Get(ctx context.Context, kind, subject string) (*AuthFailures, error) {
+	query := `
+        SELECT kind, subject, failures, last_failure_at, locked_until
+        FROM auth_failures
+        WHERE kind = $1 AND subject = $2`
+
+	var f AuthFailures
+	err := m.DB.QueryRowContext(ctx, query, kind, subject).Scan(&f.Kind, &f.Subject, &f.Failures, &f.LastFailureAt, &f.LockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &f, nil
+}
+
+// RecordFailure counts a failed attempt. Failures are forgotten once none has
+// happened for window, so the count starts over.
+func (m LockoutModel) RecordFailure(ctx context.Context, kind, subject string, window time.Duration) (*AuthFailures, error) {
+	query := `
+        INSERT INTO auth_failures (kind, subject, failures, last_failure_at)
+        VALUES ($1, $2, 1, NOW())
+        ON CONFLICT (kind, subject) DO UPDATE
+        SET failures = CASE
+                WHEN auth_failures.last_failure_at < NOW() - $3 * interval '1 millisecond' THEN 1
+                ELSE auth_failures.failures + 1
+            END,
+            last_failure_at = NOW()
+        RETURNING kind, subject, failures, last_failure_at, locked_until`
+
+	var f AuthFailures
+	err := m.DB.QueryRowContext(ctx, query, kind, subject, window.Milliseconds()).Scan(&f.Kind, &f.Subject, &f.Failures, &f.LastFailureAt, &f.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// Lock refuses attempts until the given time and starts the failure count over
+// for when it ends. It reports false if a lock was already in force, so only
+// one caller acts on a new lockout.
+func (m LockoutModel) Lock(ctx context.Context, kind, subject string, until time.Time) (bool, error) {
+	query := `
+        UPDATE auth_failures
+        SET locked_until = $3, failures = 0
+        WHERE kind = $1 AND subject = $2 AND (locked_until IS NULL OR locked_until <= NOW())`
+
+	result, err := m.DB.ExecContext(ctx, query, kind, subject, until)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Clear forgets the failures and lifts any lock, returning ErrRecordNotFound if
+// there was nothing to clear.
+func (m LockoutModel) Clear(ctx context.Context, kind, subject string) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM auth_failures WHERE kind = $1 AND subject = $2`, kind, subject)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetLocked lists the addresses and IPs that are locked out, soonest unlocked
+// first.
+func (m LockoutModel) GetLocked(ctx context.Context) ([]*AuthFailures, error) {
+	query := `
+        SELECT kind, subject, failures, last_failure_at, locked_until
+        FROM auth_failures
+        WHERE locked_until > NOW()
+        ORDER BY locked_until, kind, subject`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []*AuthFailures{}
+
+	for rows.Next() {
+		var f AuthFailures
+
+		err := rows.Scan(&f.Kind, &f.Subject, &f.Failures, &f.LastFailureAt, &f.LockedUntil)
+		if err != nil {
+			return nil, err
+		}
+
+		lockouts = append(lockouts, &f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lockouts, nil
+}
+
+// DeleteStale removes rows with no failure for window and no lock in force.
+func (m LockoutModel) DeleteStale(ctx context.Context, window time.Duration) (int64, error) {
+	query := `
+        DELETE FROM auth_failures
+        WHERE last_failure_at < NOW() - $1 * interval '1 millisecond'
+        AND (locked_until IS NULL OR locked_until <= NOW())`
+
+	result, err := m.DB.ExecContext(ctx, query, window.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutModel_RecordFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := LockoutModel{DB: db}
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"kind", "subject", "failures", "last_failure_at", "locked_until"}).
+		AddRow(LockoutEmail, "alice@example.com", 4, now, nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO auth_failures (kind, subject, failures, last_failure_at)`)).
+		WithArgs(LockoutEmail, "alice@example.com", time.Hour.Milliseconds()).
+		WillReturnRows(rows)
+
+	f, err := m.RecordFailure(context.Background(), LockoutEmail, "alice@example.com", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 4, f.Failures)
+	assert.False(t, f.Locked(now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockoutModel_Lock_AlreadyLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := LockoutModel{DB: db}
+	until := time.Now().Add(15 * time.Minute)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_failures`)).
+		WithArgs(LockoutIP, "203.0.113.7", until).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	locked, err := m.Lock(context.Background(), LockoutIP, "203.0.113.7", until)
+	require.NoError(t, err)
+	assert.False(t, locked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockoutModel_Clear_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := LockoutModel{DB: db}
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM auth_failures WHERE kind = $1 AND subject = $2`)).
+		WithArgs(LockoutEmail, "bob@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = m.Clear(context.Background(), LockoutEmail, "bob@example.com")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockoutSubject(t *testing.T) {
+	assert.Equal(t, "alice@example.com", LockoutSubject("  Alice@Example.COM "))
+}
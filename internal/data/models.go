@@ -17,6 +17,16 @@ type Models struct {
 	Tokens      TokenModel
 	Users       UserModel
 	Permissions PermissionModel
+	Roles       RoleModel
+	People      PersonModel
+	Credits     CreditModel
+	Watchlist   WatchlistModel
+	Diary       DiaryModel
+	Lists       ListModel
+	Outbox      OutboxModel
+	Exports     ExportModel
+	TOTP        TOTPModel
+	Lockouts    LockoutModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -27,5 +37,15 @@ func NewModels(db *sql.DB) Models {
 		Tokens:      TokenModel{DB: db},
 		Users:       UserModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Roles:       RoleModel{DB: db},
+		People:      PersonModel{DB: db},
+		Credits:     CreditModel{DB: db},
+		Watchlist:   WatchlistModel{DB: db},
+		Diary:       DiaryModel{DB: db},
+		Lists:       ListModel{DB: db},
+		Outbox:      OutboxModel{DB: db},
+		Exports:     ExportModel{DB: db},
+		TOTP:        TOTPModel{DB: db},
+		Lockouts:    LockoutModel{DB: db},
 	}
 }
@@ -6,18 +6,84 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strconv"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+// Movie rating aggregates are maintained by the reviews_movie_rating trigger on
+// every review insert, update and delete. RatingHistogram[i] counts the reviews
+// rating the movie i+1. InWatchlist and Watched are only set for an
+// authenticated user and are otherwise left out of the JSON.
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitzero"`
-	Runtime   Runtime   `json:"runtime,omitzero"`
-	Genres    []Genre   `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID              int64     `json:"id"`
+	CreatedAt       time.Time `json:"-"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Title           string    `json:"title"`
+	Year            int32     `json:"year,omitzero"`
+	Runtime         Runtime   `json:"runtime,omitzero"`
+	Genres          []Genre   `json:"genres,omitempty"`
+	Credits         []Credit  `json:"credits,omitempty"`
+	AverageRating   float64   `json:"average_rating"`
+	WeightedRating  float64   `json:"weighted_rating"`
+	RatingCount     int32     `json:"rating_count"`
+	RatingHistogram []int32   `json:"rating_histogram,omitempty"`
+	InWatchlist     *bool     `json:"in_watchlist,omitempty"`
+	Watched         *bool     `json:"watched,omitempty"`
+	Version         int32     `json:"version"`
+}
+
+// SortKey returns the value of the given sort column in the text form carried
+// by pagination cursors.
+func (m *Movie) SortKey(column string) string {
+	switch column {
+	case "title":
+		return m.Title
+	case "year":
+		return strconv.FormatInt(int64(m.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(m.Runtime), 10)
+	case "rating":
+		return strconv.FormatFloat(m.AverageRating, 'g', -1, 64)
+	case "weighted_rating":
+		return strconv.FormatFloat(m.WeightedRating, 'g', -1, 64)
+	default:
+		return strconv.FormatInt(m.ID, 10)
+	}
+}
+
+// scanTargets returns where each of the movie columns a listing selected is
+// scanned into.
+func (m *Movie) scanTargets(columns []string) []any {
+	targets := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			targets[i] = &m.ID
+		case "created_at":
+			targets[i] = &m.CreatedAt
+		case "updated_at":
+			targets[i] = &m.UpdatedAt
+		case "title":
+			targets[i] = &m.Title
+		case "year":
+			targets[i] = &m.Year
+		case "runtime":
+			targets[i] = &m.Runtime
+		case "version":
+			targets[i] = &m.Version
+		case "rating_count":
+			targets[i] = &m.RatingCount
+		case "average_rating":
+			targets[i] = &m.AverageRating
+		case "weighted_rating":
+			targets[i] = &m.WeightedRating
+		case "rating_histogram":
+			targets[i] = pq.Array(&m.RatingHistogram)
+		}
+	}
+	return targets
 }
 
 type MovieInput struct {
@@ -32,13 +98,19 @@ type MovieModel struct {
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
-	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
-	v.Check(movie.Runtime != 0, "runtime", "must be provided")
-	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
+	v.String("title", movie.Title,
+		validator.Required(),
+		validator.MaxLen(500),
+	)
+	v.Int("year", int64(movie.Year),
+		validator.Required(),
+		validator.Min(1888).Message("must be greater than 1888"),
+		validator.Max(int64(time.Now().Year())).Message("must not be in the future"),
+	)
+	v.Int("runtime", int64(movie.Runtime),
+		validator.Required(),
+		validator.Min(1).Message("must be a positive integer"),
+	)
 }
 
 func (m MovieModel) Insert(ctx context.Context, tx *sql.Tx, movie *Movie) error {
@@ -58,9 +130,11 @@ func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 	}
 
 	query := `
-	SELECT id, created_at, updated_at, title, year, runtime, version
-	FROM movies
-	WHERE id = $1`
+	SELECT m.id, m.created_at, m.updated_at, m.title, m.year, m.runtime, m.version,
+	       m.rating_count, m.average_rating, ` + filters.WeightedRatingExpr + `, m.rating_histogram
+	FROM movies m
+	` + filters.RatingMeanJoin + `
+	WHERE m.id = $1`
 
 	var movie Movie
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -71,6 +145,10 @@ func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 		&movie.Year,
 		&movie.Runtime,
 		&movie.Version,
+		&movie.RatingCount,
+		&movie.AverageRating,
+		&movie.WeightedRating,
+		pq.Array(&movie.RatingHistogram),
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -87,10 +165,15 @@ func (m MovieModel) GetFiltered(ctx context.Context, genreIDs []int64, mf filter
 	query, args := filters.NewMovieQueryBuilder().
 		WithTitle(mf.Title).
 		WithGenres(genreIDs).
+		WithActor(mf.Actor).
+		WithDirector(mf.Director).
 		WithYearRange(mf.MinYear, mf.MaxYear).
 		WithRuntimeRange(mf.MinRuntime, mf.MaxRuntime).
+		WithMinRating(mf.MinRating).
 		Build(mf)
 
+	columns := mf.Columns()
+
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, 0, err
@@ -103,16 +186,7 @@ func (m MovieModel) GetFiltered(ctx context.Context, genreIDs []int64, mf filter
 	for rows.Next() {
 		var movie Movie
 
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.UpdatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			&movie.Version,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, movie.scanTargets(columns)...)...)
 		if err != nil {
 			return nil, 0, ErrRecordNotFound
 		}
@@ -151,6 +225,18 @@ func (m MovieModel) Update(ctx context.Context, tx *sql.Tx, movie *Movie) error
 	return nil
 }
 
+// RefreshRatingMean recomputes the catalogue-wide mean rating read by
+// filters.RatingMeanJoin.
+func (m MovieModel) RefreshRatingMean(ctx context.Context) error {
+	query := `
+        UPDATE rating_stats
+        SET mean = (SELECT COALESCE(sum(rating_sum)::double precision / NULLIF(sum(rating_count), 0), 0) FROM movies),
+            refreshed_at = NOW()`
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
+
 func (m MovieModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
@@ -176,3 +262,27 @@ func (m MovieModel) Delete(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+func (m MovieModel) DeleteVersion(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM movies WHERE id = $1 AND version = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -172,30 +172,28 @@ func TestMovieModelGet(t *testing.T) {
 	defer db.Close()
 
 	m := MovieModel{DB: db}
+	getQuery := regexp.QuoteMeta(`m.rating_count, m.average_rating, ` + filters.WeightedRatingExpr + `, m.rating_histogram FROM movies m ` + filters.RatingMeanJoin + ` WHERE m.id = $1`)
 
 	t.Run("Successful get", func(t *testing.T) {
-		mock.ExpectQuery(`
-	SELECT id, created_at, updated_at, title, year, runtime, version
-	FROM movies
-	WHERE id = \$1`).
+		mock.ExpectQuery(getQuery).
 			WithArgs(int64(1)).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "title", "year", "runtime", "version"}).
-				AddRow(1, time.Now(), time.Now(), "Test Movie", 2020, 120, 1))
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "title", "year", "runtime", "version", "rating_count", "average_rating", "weighted_rating", "rating_histogram"}).
+				AddRow(1, time.Now(), time.Now(), "Test Movie", 2020, 120, 1, 2, 7.5, 6.9, "{0,0,0,0,0,0,1,1,0,0}"))
 
 		movie, err := m.Get(context.Background(), 1)
 		assert.NoError(t, err)
 		assert.Equal(t, "Test Movie", movie.Title)
 		assert.Equal(t, int32(2020), movie.Year)
 		assert.Equal(t, Runtime(120), movie.Runtime)
+		assert.Equal(t, int32(2), movie.RatingCount)
+		assert.Equal(t, 7.5, movie.AverageRating)
+		assert.Equal(t, []int32{0, 0, 0, 0, 0, 0, 1, 1, 0, 0}, movie.RatingHistogram)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("Not found", func(t *testing.T) {
-		mock.ExpectQuery(`
-	SELECT id, created_at, updated_at, title, year, runtime, version
-	FROM movies
-	WHERE id = \$1`).
+		mock.ExpectQuery(getQuery).
 			WithArgs(int64(999)).
 			WillReturnError(sql.ErrNoRows)
 
@@ -249,8 +247,8 @@ func TestMovieModelGetFiltered(t *testing.T) {
 
 		mock.ExpectQuery(escapedQuery).
 			WithArgs(driverArgs...).
-			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version"}).
-				AddRow(1, 1, fixedCreatedAt, fixedUpdatedAt, "Test Movie", 2020, 120, 1))
+			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version", "rating_count", "average_rating", "weighted_rating", "rating_histogram"}).
+				AddRow(1, 1, fixedCreatedAt, fixedUpdatedAt, "Test Movie", 2020, 120, 1, 0, 0.0, 6.5, "{0,0,0,0,0,0,0,0,0,0}"))
 
 		movies, total, err := m.GetFiltered(context.Background(), genreIDs, mf)
 
@@ -291,8 +289,8 @@ func TestMovieModelGetFiltered(t *testing.T) {
 
 		mock.ExpectQuery(escapedQuery).
 			WithArgs(driverArgs...).
-			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version"}).
-				AddRow(1, 1, fixedCreatedAt, fixedUpdatedAt, "Test Movie", 2020, 120, 1))
+			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version", "rating_count", "average_rating", "weighted_rating", "rating_histogram"}).
+				AddRow(1, 1, fixedCreatedAt, fixedUpdatedAt, "Test Movie", 2020, 120, 1, 0, 0.0, 6.5, "{0,0,0,0,0,0,0,0,0,0}"))
 
 		movies, total, err := m.GetFiltered(context.Background(), genreIDs, mf)
 
@@ -329,7 +327,7 @@ func TestMovieModelGetFiltered(t *testing.T) {
 
 		mock.ExpectQuery(escapedQuery).
 			WithArgs(driverArgs...).
-			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version"}))
+			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version", "rating_count", "average_rating", "weighted_rating", "rating_histogram"}))
 
 		movies, total, err := m.GetFiltered(context.Background(), genreIDs, mf)
 
@@ -402,8 +400,8 @@ func TestMovieModelGetFiltered(t *testing.T) {
 
 		mock.ExpectQuery(escapedQuery).
 			WithArgs(driverArgs...).
-			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version"}).
-				AddRow(1, 1, fixedCreatedAt, fixedUpdatedAt, "Test Movie", 2020, 120, "invalid_version"))
+			WillReturnRows(sqlmock.NewRows([]string{"total_records", "id", "created_at", "updated_at", "title", "year", "runtime", "version", "rating_count", "average_rating", "weighted_rating", "rating_histogram"}).
+				AddRow(1, 1, fixedCreatedAt, fixedUpdatedAt, "Test Movie", 2020, 120, "invalid_version", 0, 0.0, 6.5, "{0,0,0,0,0,0,0,0,0,0}"))
 
 		movies, total, err := m.GetFiltered(context.Background(), genreIDs, mf)
 
@@ -500,4 +498,15 @@ func TestMovieModelDelete(t *testing.T) {
 
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("Changed since the version", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM movies WHERE id = $1 AND version = $2`)).
+			WithArgs(int64(1), int32(3)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := m.DeleteVersion(context.Background(), 1, 3)
+		assert.Equal(t, ErrEditConflict, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
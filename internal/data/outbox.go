@@ -0,0 +1,144 @@
+package data
+
+import (
+	"bytes"
+	"cinemesis/internal/requestid"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// OutboxEmail is a message waiting in the email outbox. Data is passed to the
+// mailer template as is. RequestID is that of the request which queued it, so
+// delivery failures can be traced back to it.
+type OutboxEmail struct {
+	ID        int64
+	Recipient string
+	Locale    string
+	Template  string
+	Data      map[string]any
+	Attempts  int
+	RequestID string
+}
+
+type OutboxDepth struct {
+	Pending int64
+	Dead    int64
+}
+
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+// Enqueue adds an email to the outbox as part of tx, so it is only sent if the
+// change it describes commits. The request ID in ctx, if any, is kept with it.
+func (m OutboxModel) Enqueue(ctx context.Context, tx *sql.Tx, recipient, locale, template string, data map[string]any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO email_outbox (recipient, locale, template, data, request_id)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.ExecContext(ctx, query, recipient, locale, template, payload, requestid.FromContext(ctx))
+	return err
+}
+
+// Claim takes up to limit due emails and pushes their next attempt back by
+// lease, so other workers skip them while they are being sent. An email whose
+// worker dies before reporting back is picked up again once the lease runs out.
+func (m OutboxModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEmail, error) {
+	query := `
+        UPDATE email_outbox
+        SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * interval '1 millisecond'
+        WHERE id IN (
+            SELECT id FROM email_outbox
+            WHERE status = 'pending' AND next_attempt_at <= NOW()
+            ORDER BY next_attempt_at, id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, recipient, locale, template, data, attempts, request_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []*OutboxEmail{}
+
+	for rows.Next() {
+		var email OutboxEmail
+		var payload []byte
+
+		err := rows.Scan(&email.ID, &email.Recipient, &email.Locale, &email.Template, &payload, &email.Attempts, &email.RequestID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Keep numbers as json.Number so IDs render in templates as they
+		// were enqueued rather than as floats.
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		if err := dec.Decode(&email.Data); err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// MarkSent records a delivered email. Its data is cleared, since it usually
+// holds plaintext tokens that have no business outliving the send.
+func (m OutboxModel) MarkSent(ctx context.Context, id int64) error {
+	query := `
+        UPDATE email_outbox
+        SET status = 'sent', sent_at = NOW(), data = '{}', last_error = ''
+        WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Retry schedules another attempt at a failed email.
+func (m OutboxModel) Retry(ctx context.Context, id int64, retryAt time.Time, lastErr string) error {
+	query := `
+        UPDATE email_outbox
+        SET next_attempt_at = $2, last_error = $3
+        WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, retryAt, lastErr)
+	return err
+}
+
+// MarkDead gives up on an email, leaving it in the outbox for inspection.
+func (m OutboxModel) MarkDead(ctx context.Context, id int64, lastErr string) error {
+	query := `
+        UPDATE email_outbox
+        SET status = 'dead', last_error = $2
+        WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id, lastErr)
+	return err
+}
+
+func (m OutboxModel) Depth(ctx context.Context) (OutboxDepth, error) {
+	query := `
+        SELECT count(*) FILTER (WHERE status = 'pending'), count(*) FILTER (WHERE status = 'dead')
+        FROM email_outbox
+        WHERE status <> 'sent'`
+
+	var depth OutboxDepth
+	err := m.DB.QueryRowContext(ctx, query).Scan(&depth.Pending, &depth.Dead)
+	return depth, err
+}
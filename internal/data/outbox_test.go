@@ -0,0 +1,68 @@
+package data
+
+import (
+	"cinemesis/internal/requestid"
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxModel_Enqueue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := OutboxModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO email_outbox (recipient, locale, template, data, request_id)`)).
+		WithArgs("alice@example.com", "ru", "user_welcome.tmpl", []byte(`{"activationToken":"TOKEN","userID":7}`), "req-1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+
+	err = m.Enqueue(ctx, tx, "alice@example.com", "ru", "user_welcome.tmpl", map[string]any{
+		"activationToken": "TOKEN",
+		"userID":          int64(7),
+	})
+	assert.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxModel_Claim(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := OutboxModel{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE email_outbox SET attempts = attempts + 1`)).
+		WithArgs(20, int64(60000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recipient", "locale", "template", "data", "attempts", "request_id"}).
+			AddRow(3, "alice@example.com", "ru", "user_welcome.tmpl", []byte(`{"activationToken":"TOKEN","userID":12345678}`), 2, "req-1"))
+
+	emails, err := m.Claim(context.Background(), 20, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+
+	assert.Equal(t, int64(3), emails[0].ID)
+	assert.Equal(t, 2, emails[0].Attempts)
+	assert.Equal(t, "ru", emails[0].Locale)
+	assert.Equal(t, "req-1", emails[0].RequestID)
+	assert.Equal(t, "TOKEN", emails[0].Data["activationToken"])
+	assert.Equal(t, json.Number("12345678"), emails[0].Data["userID"])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
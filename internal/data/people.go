@@ -0,0 +1,163 @@
+package data
+
+import (
+	"cinemesis/internal/filters"
+	"cinemesis/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	BirthYear int32     `json:"birth_year,omitzero"`
+	Biography string    `json:"biography,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+type PersonInput struct {
+	Name      string `json:"name"`
+	BirthYear int32  `json:"birth_year"`
+	Biography string `json:"biography"`
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", validator.CodeRequired, "must be provided")
+	v.Check(len(person.Name) <= 500, "name", validator.CodeTooLong, "must not be more than 500 bytes long")
+	v.Check(person.BirthYear == 0 || person.BirthYear >= 1800, "birth_year", validator.CodeOutOfRange, "must be greater than 1800")
+	v.Check(person.BirthYear <= int32(time.Now().Year()), "birth_year", validator.CodeOutOfRange, "must not be in the future")
+	v.Check(len(person.Biography) <= 10_000, "biography", validator.CodeTooLong, "must not be more than 10000 bytes long")
+}
+
+func (m PersonModel) Insert(ctx context.Context, person *Person) error {
+	query := `
+        INSERT INTO people (name, birth_year, biography)
+        VALUES ($1, NULLIF($2, 0), $3)
+        RETURNING id, created_at, version`
+
+	args := []any{person.Name, person.BirthYear, person.Biography}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) Get(ctx context.Context, id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, name, COALESCE(birth_year, 0), biography, version
+        FROM people
+        WHERE id = $1`
+
+	var person Person
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.BirthYear,
+		&person.Biography,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m PersonModel) GetFiltered(ctx context.Context, pf filters.PeopleFilters) ([]*Person, int, error) {
+	query, args := filters.NewQueryBuilder().BuildPeopleQuery(pf)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	people := []*Person{}
+	var totalRecords int
+
+	for rows.Next() {
+		var person Person
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.BirthYear,
+			&person.Biography,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		people = append(people, &person)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return people, totalRecords, nil
+}
+
+func (m PersonModel) Update(ctx context.Context, person *Person) error {
+	query := `
+        UPDATE people
+        SET name = $1, birth_year = NULLIF($2, 0), biography = $3, version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING version`
+
+	args := []any{person.Name, person.BirthYear, person.Biography, person.ID, person.Version}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PersonModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        DELETE FROM people
+        WHERE id = $1`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"cinemesis/internal/validator"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePerson(t *testing.T) {
+	tests := []struct {
+		name   string
+		person *Person
+		errors map[string]string
+	}{
+		{
+			name:   "Valid person",
+			person: &Person{Name: "Agnès Varda", BirthYear: 1928},
+		},
+		{
+			name:   "Birth year is optional",
+			person: &Person{Name: "Unknown"},
+		},
+		{
+			name:   "Missing name",
+			person: &Person{},
+			errors: map[string]string{"name": "must be provided"},
+		},
+		{
+			name:   "Birth year in the future",
+			person: &Person{Name: "Future", BirthYear: 3000},
+			errors: map[string]string{"birth_year": "must not be in the future"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidatePerson(v, tt.person)
+
+			if tt.errors == nil {
+				assert.True(t, v.Valid())
+				return
+			}
+			assert.Equal(t, tt.errors, v.Errors)
+		})
+	}
+}
+
+func TestPersonModel_Get(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := PersonModel{DB: db}
+	query := regexp.QuoteMeta(`SELECT id, created_at, name, COALESCE(birth_year, 0), biography, version FROM people WHERE id = $1`)
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "birth_year", "biography", "version"}).
+				AddRow(1, time.Now(), "Agnès Varda", 1928, "", 1))
+
+		person, err := m.Get(context.Background(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "Agnès Varda", person.Name)
+		assert.Equal(t, int32(1928), person.BirthYear)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs(int64(2)).
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := m.Get(context.Background(), 2)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPersonModel_Update(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := PersonModel{DB: db}
+	query := regexp.QuoteMeta(`UPDATE people SET name = $1, birth_year = NULLIF($2, 0), biography = $3, version = version + 1 WHERE id = $4 AND version = $5`)
+
+	t.Run("Edit conflict", func(t *testing.T) {
+		person := &Person{ID: 1, Name: "Agnès Varda", Version: 1}
+
+		mock.ExpectQuery(query).
+			WithArgs(person.Name, person.BirthYear, person.Biography, person.ID, person.Version).
+			WillReturnError(sql.ErrNoRows)
+
+		err := m.Update(context.Background(), person)
+		assert.ErrorIs(t, err, ErrEditConflict)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"slices"
 	"time"
 
@@ -19,21 +20,53 @@ type PermissionModel struct {
 	DB *sql.DB
 }
 
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+// GetAllForUser returns the effective permissions of a user: the codes granted
+// directly plus every code bundled in the roles the user holds.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
         SELECT permissions.code
         FROM permissions
         INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-        INNER JOIN users ON users_permissions.user_id = users.id
-        WHERE users.id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+        WHERE users_permissions.user_id = $1
+        UNION
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+        INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+        WHERE users_roles.user_id = $1
+        ORDER BY code`
+	return m.queryCodes(ctx, query, userID)
+}
+
+// GetDirectForUser returns only the permissions granted to the user individually,
+// ignoring roles.
+func (m PermissionModel) GetDirectForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+        WHERE users_permissions.user_id = $1
+        ORDER BY permissions.code`
+	return m.queryCodes(ctx, query, userID)
+}
+
+func (m PermissionModel) GetAll(ctx context.Context) (Permissions, error) {
+	query := `
+        SELECT code
+        FROM permissions
+        ORDER BY code`
+	return m.queryCodes(ctx, query)
+}
+
+func (m PermissionModel) queryCodes(ctx context.Context, query string, args ...any) (Permissions, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var permissions Permissions
+	permissions := Permissions{}
 	for rows.Next() {
 		var permission string
 		err := rows.Scan(&permission)
@@ -48,12 +81,62 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
         INSERT INTO users_permissions
         SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// GrantForUser grants a single permission to a user. Granting a permission the
+// user already holds is a no-op; an unknown code returns ErrRecordNotFound.
+func (m PermissionModel) GrantForUser(ctx context.Context, userID int64, code string) error {
+	query := `
+        WITH permission AS (
+            SELECT id FROM permissions WHERE code = $2
+        ), granted AS (
+            INSERT INTO users_permissions (user_id, permission_id)
+            SELECT $1, id FROM permission
+            ON CONFLICT DO NOTHING
+        )
+        SELECT id FROM permission`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, userID, code).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m PermissionModel) RemoveForUser(ctx context.Context, userID int64, code string) error {
+	query := `
+        DELETE FROM users_permissions
+        USING permissions
+        WHERE users_permissions.permission_id = permissions.id
+        AND users_permissions.user_id = $1
+        AND permissions.code = $2`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -20,6 +21,13 @@ type Review struct {
 	Downvotes int32     `json:"downvotes"`
 	Edited    bool      `json:"edited"`
 	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version,omitzero"`
+}
+
+type ReviewInput struct {
+	MovieID int64  `json:"movie_id"`
+	Text    string `json:"text"`
+	Rating  uint8  `json:"rating"`
 }
 
 type ReviewWithUser struct {
@@ -29,28 +37,76 @@ type ReviewWithUser struct {
 	CurrentUserVote int    `json:"user_vote,omitempty"`
 }
 
-func ValidateReview(v *validator.Validator, review *Review) {
-	v.Check(review.Text != "", "text", "must be provided")
-	v.Check(len(review.Text) >= 10, "text", "must be at least 10 characters long")
-	v.Check(len(review.Text) <= 500, "text", "must be less than 500 characters long")
+// SortKey returns the value the review is sorted by in the text form carried by
+// pagination cursors.
+func (r *ReviewWithUser) SortKey(sortBy string) string {
+	switch sortBy {
+	case filters.SortByRating:
+		return strconv.FormatUint(uint64(r.Rating), 10)
+	case filters.SortByUpvotes:
+		return strconv.FormatInt(int64(r.Upvotes), 10)
+	default:
+		return r.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
 
-	v.Check(review.Rating >= 1 && review.Rating <= 10, "rating", "must be between 1 and 10")
+// scanTargets returns where each of the review columns a listing selected is
+// scanned into.
+func (r *ReviewWithUser) scanTargets(columns []string) []any {
+	targets := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			targets[i] = &r.ID
+		case "user_id":
+			targets[i] = &r.UserID
+		case "movie_id":
+			targets[i] = &r.MovieID
+		case "text":
+			targets[i] = &r.Text
+		case "rating":
+			targets[i] = &r.Rating
+		case "created_at":
+			targets[i] = &r.CreatedAt
+		case "upvotes":
+			targets[i] = &r.Upvotes
+		case "downvotes":
+			targets[i] = &r.Downvotes
+		case "edited":
+			targets[i] = &r.Edited
+		case "user_name":
+			targets[i] = &r.UserName
+		case "total_votes":
+			targets[i] = &r.TotalVotes
+		case "user_vote":
+			targets[i] = &r.CurrentUserVote
+		}
+	}
+	return targets
+}
 
-	v.Check(review.MovieID > 0, "movie_id", "must be a valid movie ID")
-	v.Check(review.UserID > 0, "user_id", "must be a valid user ID")
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.String("text", review.Text,
+		validator.Required(),
+		validator.MinLen(10).Message("must be at least 10 characters long"),
+		validator.MaxLen(500).Message("must be less than 500 characters long"),
+	)
+	v.Int("rating", int64(review.Rating), validator.Range(1, 10))
+	v.Int("movie_id", review.MovieID, validator.Min(1).Message("must be a valid movie ID"))
+	v.Int("user_id", review.UserID, validator.Min(1).Message("must be a valid user ID"))
 }
 
 type ReviewModel struct {
 	DB *sql.DB
 }
 
-func (r ReviewModel) Insert(review *Review) error {
+func (r ReviewModel) Insert(ctx context.Context, review *Review) error {
 	query := `
 		INSERT INTO reviews (user_id, movie_id, text, rating, edited)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	return r.DB.QueryRowContext(ctx, query,
@@ -67,21 +123,24 @@ func (r ReviewModel) Get(ctx context.Context, id int64, userID *int64) (*ReviewW
 	var args []interface{}
 	args = append(args, id)
 
+	// Without a user there is no vote to look up, so user_vote is always 0.
+	userVote := "0"
 	if userID != nil {
-		userVoteJoin = `LEFT JOIN review_vote rv ON rv.review_id = r.id AND rv.user_id = $2`
+		userVoteJoin = `LEFT JOIN review_votes rv ON rv.review_id = r.id AND rv.user_id = $2`
+		userVote = "COALESCE(rv.vote_type, 0)"
 		args = append(args, *userID)
 	}
 
 	query := fmt.Sprintf(`
 		SELECT r.id, r.user_id, r.movie_id, r.text, r.rating,
-		       r.upvotes, r.downvotes, r.created_at, r.edited,
+		       r.upvotes, r.downvotes, r.created_at, r.edited, r.version,
 		       u.name AS user_name,
 		       (r.upvotes - r.downvotes) AS total_votes,
-		       COALESCE(rv.vote_type, 0) AS user_vote
+		       %s AS user_vote
 		FROM reviews r
 		JOIN users u ON r.user_id = u.id
 		%s
-		WHERE r.id = $1`, userVoteJoin)
+		WHERE r.id = $1`, userVote, userVoteJoin)
 
 	var review ReviewWithUser
 	err := r.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -94,6 +153,7 @@ func (r ReviewModel) Get(ctx context.Context, id int64, userID *int64) (*ReviewW
 		&review.Downvotes,
 		&review.CreatedAt,
 		&review.Edited,
+		&review.Version,
 		&review.UserName,
 		&review.TotalVotes,
 		&review.CurrentUserVote,
@@ -111,6 +171,7 @@ func (r ReviewModel) Get(ctx context.Context, id int64, userID *int64) (*ReviewW
 
 func (r ReviewModel) GetFiltered(ctx context.Context, currentUserID int64, rf filters.ReviewFilters) ([]*ReviewWithUser, int, error) {
 	query, args := filters.NewReviewQueryBuilder().Build(rf, currentUserID)
+	columns := rf.Columns()
 
 	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -123,21 +184,7 @@ func (r ReviewModel) GetFiltered(ctx context.Context, currentUserID int64, rf fi
 
 	for rows.Next() {
 		var review ReviewWithUser
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.UserID,
-			&review.MovieID,
-			&review.Text,
-			&review.Rating,
-			&review.CreatedAt,
-			&review.Upvotes,
-			&review.Downvotes,
-			&review.Edited,
-			&review.UserName,
-			&review.TotalVotes,
-			&review.CurrentUserVote,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, review.scanTargets(columns)...)...)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -231,9 +278,9 @@ func (r ReviewModel) GetTopMovieReviews(ctx context.Context, movieID int64, limi
 func (r ReviewModel) Update(ctx context.Context, reviewID int64, review *Review) error {
 	query := `
 		UPDATE reviews
-		SET text = $1, movie_id  = $2, user_id = $3, upvotes = $4, rating = $5, edited = true
-		WHERE id = $6
-		RETURNING id, created_at`
+		SET text = $1, movie_id  = $2, user_id = $3, upvotes = $4, rating = $5, edited = true, version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING id, created_at, version`
 
 	args := []any{
 		review.Text,
@@ -242,12 +289,13 @@ func (r ReviewModel) Update(ctx context.Context, reviewID int64, review *Review)
 		review.Upvotes,
 		review.Rating,
 		reviewID,
+		review.Version,
 	}
 
-	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt)
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ErrRecordNotFound
+			return ErrEditConflict
 		}
 		return err
 	}
@@ -278,3 +326,27 @@ func (r ReviewModel) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+func (r ReviewModel) DeleteVersion(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM reviews WHERE id = $1 AND version = $2`
+
+	result, err := r.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -153,7 +153,7 @@ func TestReviewModel_Insert(t *testing.T) {
 			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).
 				AddRow(1, fixedCreatedAt))
 
-		err := m.Insert(review)
+		err := m.Insert(context.Background(), review)
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), review.ID)
 		assert.Equal(t, fixedCreatedAt, review.CreatedAt)
@@ -169,7 +169,7 @@ func TestReviewModel_Insert(t *testing.T) {
 			WithArgs(review.UserID, review.MovieID, review.Text, review.Rating, review.Edited).
 			WillReturnError(errors.New("database error"))
 
-		err := m.Insert(review)
+		err := m.Insert(context.Background(), review)
 		assert.Error(t, err)
 		assert.Equal(t, "database error", err.Error())
 
@@ -189,20 +189,20 @@ func TestReviewModel_Get(t *testing.T) {
 		userID := int64(2)
 		query := regexp.QuoteMeta(`
         SELECT r.id, r.user_id, r.movie_id, r.text, r.rating,
-               r.upvotes, r.downvotes, r.created_at, r.edited,
+               r.upvotes, r.downvotes, r.created_at, r.edited, r.version,
                u.name AS user_name,
                (r.upvotes - r.downvotes) AS total_votes,
                COALESCE(rv.vote_type, 0) AS user_vote
         FROM reviews r
         JOIN users u ON r.user_id = u.id
-        LEFT JOIN review_vote rv ON rv.review_id = r.id AND rv.user_id = $2
+        LEFT JOIN review_votes rv ON rv.review_id = r.id AND rv.user_id = $2
         WHERE r.id = $1`)
 
 		mock.ExpectQuery(query).
 			WithArgs(int64(1), userID).
 			WillReturnRows(sqlmock.NewRows([]string{
-				"id", "user_id", "movie_id", "text", "rating", "upvotes", "downvotes", "created_at", "edited", "user_name", "total_votes", "user_vote",
-			}).AddRow(1, 1, 1, "Great movie!", 8, 10, 2, fixedCreatedAt, false, "Test User", 8, 1))
+				"id", "user_id", "movie_id", "text", "rating", "upvotes", "downvotes", "created_at", "edited", "version", "user_name", "total_votes", "user_vote",
+			}).AddRow(1, 1, 1, "Great movie!", 8, 10, 2, fixedCreatedAt, false, 3, "Test User", 8, 1))
 
 		review, err := m.Get(context.Background(), 1, &userID)
 		assert.NoError(t, err)
@@ -214,6 +214,7 @@ func TestReviewModel_Get(t *testing.T) {
 		assert.Equal(t, int32(10), review.Upvotes)
 		assert.Equal(t, int32(2), review.Downvotes)
 		assert.Equal(t, false, review.Edited)
+		assert.Equal(t, int32(3), review.Version)
 		assert.Equal(t, "Test User", review.UserName)
 		assert.Equal(t, int32(8), review.TotalVotes)
 		assert.Equal(t, 1, review.CurrentUserVote)
@@ -224,10 +225,10 @@ func TestReviewModel_Get(t *testing.T) {
 	t.Run("Success without userID", func(t *testing.T) {
 		query := regexp.QuoteMeta(`
         SELECT r.id, r.user_id, r.movie_id, r.text, r.rating,
-               r.upvotes, r.downvotes, r.created_at, r.edited,
+               r.upvotes, r.downvotes, r.created_at, r.edited, r.version,
                u.name AS user_name,
                (r.upvotes - r.downvotes) AS total_votes,
-               COALESCE(rv.vote_type, 0) AS user_vote
+               0 AS user_vote
         FROM reviews r
         JOIN users u ON r.user_id = u.id
         
@@ -236,8 +237,8 @@ func TestReviewModel_Get(t *testing.T) {
 		mock.ExpectQuery(query).
 			WithArgs(int64(1)).
 			WillReturnRows(sqlmock.NewRows([]string{
-				"id", "user_id", "movie_id", "text", "rating", "upvotes", "downvotes", "created_at", "edited", "user_name", "total_votes", "user_vote",
-			}).AddRow(1, 1, 1, "Great movie!", 8, 10, 2, fixedCreatedAt, false, "Test User", 8, 0))
+				"id", "user_id", "movie_id", "text", "rating", "upvotes", "downvotes", "created_at", "edited", "version", "user_name", "total_votes", "user_vote",
+			}).AddRow(1, 1, 1, "Great movie!", 8, 10, 2, fixedCreatedAt, false, 3, "Test User", 8, 0))
 
 		review, err := m.Get(context.Background(), 1, nil)
 		assert.NoError(t, err)
@@ -253,13 +254,13 @@ func TestReviewModel_Get(t *testing.T) {
 		userID := int64(2)
 		query := regexp.QuoteMeta(`
         SELECT r.id, r.user_id, r.movie_id, r.text, r.rating,
-               r.upvotes, r.downvotes, r.created_at, r.edited,
+               r.upvotes, r.downvotes, r.created_at, r.edited, r.version,
                u.name AS user_name,
                (r.upvotes - r.downvotes) AS total_votes,
                COALESCE(rv.vote_type, 0) AS user_vote
         FROM reviews r
         JOIN users u ON r.user_id = u.id
-        LEFT JOIN review_vote rv ON rv.review_id = r.id AND rv.user_id = $2
+        LEFT JOIN review_votes rv ON rv.review_id = r.id AND rv.user_id = $2
         WHERE r.id = $1`)
 
 		mock.ExpectQuery(query).
@@ -503,39 +504,42 @@ func TestReviewModel_Update(t *testing.T) {
 		Text:    "Updated review",
 		Rating:  9,
 		Upvotes: 15,
+		Version: 2,
 	}
 
 	t.Run("Success", func(t *testing.T) {
 		reviewID := int64(1)
 		mock.ExpectQuery(regexp.QuoteMeta(`
         UPDATE reviews
-        SET text = $1, movie_id = $2, user_id = $3, upvotes = $4, rating = $5, edited = true
-        WHERE id = $6
-        RETURNING id, created_at`)).
-			WithArgs(review.Text, review.MovieID, review.UserID, review.Upvotes, review.Rating, reviewID).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).
-				AddRow(reviewID, fixedCreatedAt))
+        SET text = $1, movie_id = $2, user_id = $3, upvotes = $4, rating = $5, edited = true, version = version + 1
+        WHERE id = $6 AND version = $7
+        RETURNING id, created_at, version`)).
+			WithArgs(review.Text, review.MovieID, review.UserID, review.Upvotes, review.Rating, reviewID, int32(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).
+				AddRow(reviewID, fixedCreatedAt, 3))
 
 		err := m.Update(context.Background(), reviewID, review)
 		assert.NoError(t, err)
 		assert.Equal(t, reviewID, review.ID)
 		assert.Equal(t, fixedCreatedAt, review.CreatedAt)
+		assert.Equal(t, int32(3), review.Version)
+		review.Version = 2
 
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
-	t.Run("Not found", func(t *testing.T) {
+	t.Run("Edit conflict", func(t *testing.T) {
 		reviewID := int64(999)
 		mock.ExpectQuery(regexp.QuoteMeta(`
         UPDATE reviews
-        SET text = $1, movie_id = $2, user_id = $3, upvotes = $4, rating = $5, edited = true
-        WHERE id = $6
-        RETURNING id, created_at`)).
-			WithArgs(review.Text, review.MovieID, review.UserID, review.Upvotes, review.Rating, reviewID).
+        SET text = $1, movie_id = $2, user_id = $3, upvotes = $4, rating = $5, edited = true, version = version + 1
+        WHERE id = $6 AND version = $7
+        RETURNING id, created_at, version`)).
+			WithArgs(review.Text, review.MovieID, review.UserID, review.Upvotes, review.Rating, reviewID, int32(2)).
 			WillReturnError(sql.ErrNoRows)
 
 		err := m.Update(context.Background(), reviewID, review)
-		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.ErrorIs(t, err, ErrEditConflict)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	RoleViewer    = "viewer"
+	RoleCritic    = "critic"
+	RoleEditor    = "editor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type RoleInput struct {
+	Role string `json:"role"`
+}
+
+type PermissionInput struct {
+	Permission string `json:"permission"`
+}
+
+type RoleModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns every role together with the permission codes it bundles.
+func (m RoleModel) GetAll(ctx context.Context) ([]*Role, error) {
+	query := `
+        SELECT roles.id, roles.name, COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+        FROM roles
+        LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+        LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+        GROUP BY roles.id, roles.name
+        ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.ID, &role.Name, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (m RoleModel) GetAllForUser(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+        SELECT roles.name
+        FROM roles
+        INNER JOIN users_roles ON users_roles.role_id = roles.id
+        WHERE users_roles.user_id = $1
+        ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// AddForUser assigns a role to a user. Assigning a role the user already holds
+// is a no-op; an unknown role name returns ErrRecordNotFound.
+func (m RoleModel) AddForUser(ctx context.Context, userID int64, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return addRoleForUser(ctx, m.DB, userID, name)
+}
+
+// AddForUserTx is AddForUser as part of tx.
+func (m RoleModel) AddForUserTx(ctx context.Context, tx *sql.Tx, userID int64, name string) error {
+	return addRoleForUser(ctx, tx, userID, name)
+}
+
+func addRoleForUser(ctx context.Context, db rowQueryer, userID int64, name string) error {
+	query := `
+        WITH role AS (
+            SELECT id FROM roles WHERE name = $2
+        ), assigned AS (
+            INSERT INTO users_roles (user_id, role_id)
+            SELECT $1, id FROM role
+            ON CONFLICT DO NOTHING
+        )
+        SELECT id FROM role`
+
+	var id int64
+	err := db.QueryRowContext(ctx, query, userID, name).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m RoleModel) RemoveForUser(ctx context.Context, userID int64, name string) error {
+	query := `
+        DELETE FROM users_roles
+        USING roles
+        WHERE users_roles.role_id = roles.id
+        AND users_roles.user_id = $1
+        AND roles.name = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleModel_AddForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := RoleModel{DB: db}
+	query := regexp.QuoteMeta(`WITH role AS ( SELECT id FROM roles WHERE name = $2 )`)
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs(int64(1), RoleEditor).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+		err := m.AddForUser(context.Background(), 1, RoleEditor)
+		assert.NoError(t, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs(int64(1), "superuser").
+			WillReturnError(sql.ErrNoRows)
+
+		err := m.AddForUser(context.Background(), 1, "superuser")
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRoleModel_RemoveForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := RoleModel{DB: db}
+	query := regexp.QuoteMeta(`DELETE FROM users_roles USING roles`)
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectExec(query).
+			WithArgs(int64(1), RoleModerator).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := m.RemoveForUser(context.Background(), 1, RoleModerator)
+		assert.NoError(t, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not assigned", func(t *testing.T) {
+		mock.ExpectExec(query).
+			WithArgs(int64(1), RoleModerator).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := m.RemoveForUser(context.Background(), 1, RoleModerator)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPermissionModel_GetAllForUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := PermissionModel{DB: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id`)).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("movies:read").AddRow("reviews:moderate"))
+
+	permissions, err := m.GetAllForUser(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, permissions.Include("reviews:moderate"))
+	assert.False(t, permissions.Include("admin"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -10,23 +10,39 @@ var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
 type Runtime int32
 
-func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+// ParseRuntime accepts a runtime either as a plain number of minutes ("107") or
+// in the "107 mins" form.
+func ParseRuntime(s string) (Runtime, error) {
+	parts := strings.Split(s, " ")
+
+	if (len(parts) == 2 && parts[1] != "mins") || len(parts) > 2 {
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	i, err := strconv.ParseInt(parts[0], 10, 32)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
-	parts := strings.Split(unquotedJSONValue, " ")
+	return Runtime(i), nil
+}
 
-	if (len(parts) == 2 && parts[1] != "mins") || len(parts) > 2 {
-		return ErrInvalidRuntimeFormat
+func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	if string(jsonValue) == "null" {
+		return nil
 	}
 
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		// Bare numbers are accepted as well, which is how runtimes are exported.
+		unquotedJSONValue = string(jsonValue)
+	}
+
+	runtime, err := ParseRuntime(unquotedJSONValue)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return err
 	}
 
-	*r = Runtime(i)
+	*r = runtime
 	return nil
 }
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Runtime
+		wantErr bool
+	}{
+		{input: `"107 mins"`, want: 107},
+		{input: `"107"`, want: 107},
+		{input: `107`, want: 107},
+		{input: `null`, want: 0},
+		{input: `"107 minutes"`, wantErr: true},
+		{input: `"long"`, wantErr: true},
+		{input: `1.5`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var r Runtime
+			err := json.Unmarshal([]byte(tt.input), &r)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRuntimeFormat)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, r)
+		})
+	}
+}
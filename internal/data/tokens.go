@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"time"
 )
 
@@ -13,14 +14,38 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "token-reset"
+	ScopeRefresh        = "refresh"
+	ScopeEmailChange    = "email-change"
+	// ScopeTwoFactor is issued by a password login to a user with two-factor
+	// authentication, to be exchanged along with a code for a session.
+	ScopeTwoFactor = "2fa-pending"
+)
+
+var (
+	ErrTokenReused = errors.New("refresh token reuse detected")
 )
 
 type Token struct {
-	PlainText string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	UserID    int64     `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
+	PlainText  string     `json:"token"`
+	Hash       []byte     `json:"-"`
+	UserID     int64      `json:"-"`
+	Expiry     time.Time  `json:"expiry"`
+	Scope      string     `json:"-"`
+	SessionID  string     `json:"-"`
+	UserAgent  string     `json:"-"`
+	NewEmail   string     `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+	LastUsedAt *time.Time `json:"-"`
+}
+
+// Session groups the authentication and refresh tokens issued by a single login.
+type Session struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	UserAgent  string     `json:"user_agent"`
+	Expiry     time.Time  `json:"expiry"`
+	Current    bool       `json:"current"`
 }
 
 type AuthInput struct {
@@ -32,6 +57,10 @@ type EmailInput struct {
 	Email string `json:"email" example:" "`
 }
 
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" example:" "`
+}
+
 type TokenModel struct {
 	DB *sql.DB
 }
@@ -51,32 +80,313 @@ func generateToken(userID int64, ttl time.Duration, scope string) *Token {
 }
 
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
-	v.Check(tokenPlaintext != "", "token", "must be provided")
-	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+	v.Check(tokenPlaintext != "", "token", validator.CodeRequired, "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", validator.CodeInvalidFormat, "must be 26 bytes long")
+}
+
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := generateToken(userID, ttl, scope)
+	err := m.Insert(ctx, token)
+	return token, err
 }
 
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+// NewTx is New as part of tx, for tokens that are mailed through the outbox in
+// the same transaction.
+func (m TokenModel) NewTx(ctx context.Context, tx *sql.Tx, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token := generateToken(userID, ttl, scope)
-	err := m.Insert(token)
+	err := insertToken(ctx, tx, token)
 	return token, err
 }
 
-func (m TokenModel) Insert(token *Token) error {
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	return insertToken(ctx, m.DB, token)
+}
+
+// execer and rowQueryer are satisfied by both *sql.DB and *sql.Tx, so a query
+// can be shared between a model method and its transactional variant.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertToken(ctx context.Context, db execer, token *Token) error {
+	query := `
+        INSERT INTO tokens (hash, user_id, expiry, scope, session_id, user_agent)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)`
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.SessionID, token.UserAgent}
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// NewSession issues an authentication token and a refresh token that share a
+// freshly generated session ID.
+func (m TokenModel) NewSession(ctx context.Context, userID int64, userAgent string, authTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	authToken, refreshToken, err := issueSessionTokens(ctx, tx, userID, rand.Text(), userAgent, authTTL, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return authToken, refreshToken, nil
+}
+
+func issueSessionTokens(ctx context.Context, tx *sql.Tx, userID int64, sessionID, userAgent string, authTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	authToken := generateToken(userID, authTTL, ScopeAuthentication)
+	refreshToken := generateToken(userID, refreshTTL, ScopeRefresh)
+
+	for _, token := range []*Token{authToken, refreshToken} {
+		token.SessionID = sessionID
+		token.UserAgent = userAgent
+		if err := insertToken(ctx, tx, token); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return authToken, refreshToken, nil
+}
+
+// Rotate exchanges a refresh token for a new authentication/refresh token pair in
+// the same session. The presented refresh token is kept but marked as used, so
+// that presenting it a second time is detected as reuse: in that case the whole
+// session is revoked and ErrTokenReused is returned.
+func (m TokenModel) Rotate(ctx context.Context, refreshPlaintext string, authTTL, refreshTTL time.Duration) (*Token, *Token, error) {
+	hash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT user_id, session_id, user_agent, used_at
+        FROM tokens
+        WHERE hash = $1 AND scope = $2 AND expiry > $3
+        FOR UPDATE`
+
+	var (
+		userID    int64
+		sessionID string
+		userAgent string
+		usedAt    sql.NullTime
+	)
+
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeRefresh, time.Now()).Scan(&userID, &sessionID, &userAgent, &usedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if usedAt.Valid {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE session_id = $1`, sessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW() WHERE hash = $1`, hash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE session_id = $1 AND scope = $2`, sessionID, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authToken, refreshToken, err := issueSessionTokens(ctx, tx, userID, sessionID, userAgent, authTTL, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return authToken, refreshToken, nil
+}
+
+// Touch records that the token was used. Writes are throttled to one a minute
+// per token so that authenticated traffic doesn't turn into a stream of updates.
+func (m TokenModel) Touch(ctx context.Context, tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        UPDATE tokens
+        SET last_used_at = NOW()
+        WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, hash[:])
+	return err
+}
+
+// GetSessionsForUser lists the live sessions of a user. The session that owns
+// currentPlaintext is flagged as current.
+func (m TokenModel) GetSessionsForUser(ctx context.Context, userID int64, currentPlaintext string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+        SELECT session_id, MIN(created_at), MAX(last_used_at), MAX(user_agent), MAX(expiry), bool_or(hash = $2)
+        FROM tokens
+        WHERE user_id = $1
+        AND scope IN ($3, $4)
+        AND session_id IS NOT NULL
+        AND used_at IS NULL
+        AND expiry > NOW()
+        GROUP BY session_id
+        ORDER BY MIN(created_at) DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, currentHash[:], ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.UserAgent,
+			&session.Expiry,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes every token belonging to one of the user's sessions.
+func (m TokenModel) DeleteSession(ctx context.Context, userID int64, sessionID string) error {
+	query := `
+        DELETE FROM tokens
+        WHERE user_id = $1 AND session_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteSessionForToken revokes the session the given token belongs to (logout).
+func (m TokenModel) DeleteSessionForToken(ctx context.Context, tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
 	query := `
-        INSERT INTO tokens (hash, user_id, expiry, scope) 
-        VALUES ($1, $2, $3, $4)`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+        DELETE FROM tokens
+        WHERE hash = $1
+        OR session_id = (SELECT session_id FROM tokens WHERE hash = $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := m.DB.ExecContext(ctx, query, hash[:])
 	return err
 }
 
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+// DeleteOtherSessionsForUser revokes all of the user's sessions except the one
+// the given token belongs to.
+func (m TokenModel) DeleteOtherSessionsForUser(ctx context.Context, userID int64, currentPlaintext string) error {
+	hash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+        DELETE FROM tokens
+        WHERE user_id = $1
+        AND scope IN ($3, $4)
+        AND hash <> $2
+        AND session_id IS DISTINCT FROM (SELECT session_id FROM tokens WHERE hash = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, hash[:], ScopeAuthentication, ScopeRefresh)
+	return err
+}
+
+// NewEmailChangeTx issues a token confirming that the user owns newEmail, as
+// part of tx. Any email change the user had pending is cancelled, so only the
+// latest requested address can be confirmed.
+func (m TokenModel) NewEmailChangeTx(ctx context.Context, tx *sql.Tx, userID int64, ttl time.Duration, newEmail string) (*Token, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM tokens WHERE scope = $1 AND user_id = $2`, ScopeEmailChange, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := generateToken(userID, ttl, ScopeEmailChange)
+	token.NewEmail = newEmail
+
+	query := `
+        INSERT INTO tokens (hash, user_id, expiry, scope, new_email)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope, token.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
-        DELETE FROM tokens 
+        DELETE FROM tokens
         WHERE scope = $1 AND user_id = $2`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
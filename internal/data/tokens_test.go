@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenModel_NewSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TokenModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO tokens (hash, user_id, expiry, scope, session_id, user_agent)`)).
+		WithArgs(sqlmock.AnyArg(), int64(1), sqlmock.AnyArg(), ScopeAuthentication, sqlmock.AnyArg(), "curl/8.0").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO tokens (hash, user_id, expiry, scope, session_id, user_agent)`)).
+		WithArgs(sqlmock.AnyArg(), int64(1), sqlmock.AnyArg(), ScopeRefresh, sqlmock.AnyArg(), "curl/8.0").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	authToken, refreshToken, err := m.NewSession(context.Background(), 1, "curl/8.0", time.Hour, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, ScopeAuthentication, authToken.Scope)
+	assert.Equal(t, ScopeRefresh, refreshToken.Scope)
+	assert.Equal(t, authToken.SessionID, refreshToken.SessionID)
+	assert.NotEqual(t, authToken.PlainText, refreshToken.PlainText)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenModel_Rotate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TokenModel{DB: db}
+	refreshPlaintext := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	refreshHash := sha256.Sum256([]byte(refreshPlaintext))
+	selectQuery := regexp.QuoteMeta(`SELECT user_id, session_id, user_agent, used_at FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > $3 FOR UPDATE`)
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectQuery).
+			WithArgs(refreshHash[:], ScopeRefresh, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "session_id", "user_agent", "used_at"}).
+				AddRow(1, "session", "curl/8.0", nil))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE tokens SET used_at = NOW() WHERE hash = $1`)).
+			WithArgs(refreshHash[:]).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM tokens WHERE session_id = $1 AND scope = $2`)).
+			WithArgs("session", ScopeAuthentication).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO tokens`)).
+			WithArgs(sqlmock.AnyArg(), int64(1), sqlmock.AnyArg(), ScopeAuthentication, "session", "curl/8.0").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO tokens`)).
+			WithArgs(sqlmock.AnyArg(), int64(1), sqlmock.AnyArg(), ScopeRefresh, "session", "curl/8.0").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		authToken, refreshToken, err := m.Rotate(context.Background(), refreshPlaintext, time.Hour, 24*time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, "session", authToken.SessionID)
+		assert.Equal(t, "session", refreshToken.SessionID)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reuse revokes session", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectQuery).
+			WithArgs(refreshHash[:], ScopeRefresh, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "session_id", "user_agent", "used_at"}).
+				AddRow(1, "session", "curl/8.0", time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM tokens WHERE session_id = $1`)).
+			WithArgs("session").
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+
+		_, _, err := m.Rotate(context.Background(), refreshPlaintext, time.Hour, 24*time.Hour)
+		assert.ErrorIs(t, err, ErrTokenReused)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectQuery).
+			WithArgs(refreshHash[:], ScopeRefresh, sqlmock.AnyArg()).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		_, _, err := m.Rotate(context.Background(), refreshPlaintext, time.Hour, 24*time.Hour)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTokenModel_NewEmailChangeTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TokenModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM tokens WHERE scope = $1 AND user_id = $2`)).
+		WithArgs(ScopeEmailChange, int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO tokens (hash, user_id, expiry, scope, new_email)`)).
+		WithArgs(sqlmock.AnyArg(), int64(1), sqlmock.AnyArg(), ScopeEmailChange, "new@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	token, err := m.NewEmailChangeTx(context.Background(), tx, 1, time.Hour, "new@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, ScopeEmailChange, token.Scope)
+	assert.Equal(t, "new@example.com", token.NewEmail)
+	require.NoError(t, tx.Commit())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
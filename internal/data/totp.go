@@ -0,0 +1,286 @@
+package data
+
+import (
+	"cinemesis/internal/validator"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued when two-factor
+// authentication is enabled.
+const RecoveryCodeCount = 10
+
+var (
+	ErrTOTPEnabled = errors.New("two-factor authentication already enabled")
+)
+
+// TOTP is a user's authenticator app enrolment. It only guards logins once
+// confirmed with a first code.
+type TOTP struct {
+	UserID      int64
+	Secret      []byte
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+type PasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+type CodeInput struct {
+	Code string `json:"code"`
+}
+
+// DisableTOTPInput takes a code from the authenticator app or a recovery code,
+// as well as the password.
+type DisableTOTPInput struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+// TwoFactorInput exchanges the token a password login returned for an
+// authentication token.
+type TwoFactorInput struct {
+	TokenPlaintext string `json:"token"`
+	Code           string `json:"code"`
+}
+
+func ValidateCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", validator.CodeRequired, "must be provided")
+	v.Check(len(code) <= 32, "code", validator.CodeTooLong, "must not be more than 32 bytes long")
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+// Get returns the user's enrolment, confirmed or not.
+func (m TOTPModel) Get(ctx context.Context, userID int64) (*TOTP, error) {
+	query := `
+        SELECT user_id, secret, confirmed_at, last_step
+        FROM user_totp
+        WHERE user_id = $1`
+
+	var t TOTP
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&t.UserID, &t.Secret, &t.ConfirmedAt, &t.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// Provision stores a new unconfirmed secret for the user, replacing any earlier
+// one that was never confirmed. It returns ErrTOTPEnabled if two-factor
+// authentication is already on.
+func (m TOTPModel) Provision(ctx context.Context, userID int64, secret []byte) error {
+	query := `
+        INSERT INTO user_totp (user_id, secret)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret = EXCLUDED.secret, created_at = NOW(), last_step = 0
+        WHERE user_totp.confirmed_at IS NULL`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPEnabled
+	}
+
+	return nil
+}
+
+// Confirm turns on two-factor authentication once the first code, for the
+// given time step, has been checked against the provisioned secret. It returns
+// the recovery codes, which are only stored hashed.
+func (m TOTPModel) Confirm(ctx context.Context, userID, step int64) ([]string, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE user_totp
+        SET confirmed_at = NOW(), last_step = $2
+        WHERE user_id = $1 AND confirmed_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrTOTPEnabled
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseStep records that a code for step was accepted, and reports false if a
+// code for that step or a later one already was, so each code works once.
+func (m TOTPModel) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `
+        UPDATE user_totp
+        SET last_step = $2
+        WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode reports whether code is one of the user's unused recovery
+// codes, and uses it up if so.
+func (m TOTPModel) UseRecoveryCode(ctx context.Context, userID int64, code string) (bool, error) {
+	query := `
+        SELECT id, hash
+        FROM recovery_codes
+        WHERE user_id = $1 AND used_at IS NULL`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	code = normalizeRecoveryCode(code)
+	var matched int64
+
+	for rows.Next() {
+		var id int64
+		var p password
+
+		if err := rows.Scan(&id, &p.hash); err != nil {
+			return false, err
+		}
+
+		match, err := p.Matches(code)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			matched = id
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	if matched == 0 {
+		return false, nil
+	}
+
+	// Two logins racing with the same code can both match it; only the one
+	// that marks it used succeeds.
+	result, err := m.DB.ExecContext(ctx, `UPDATE recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, matched)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Disable turns off two-factor authentication and discards the secret and the
+// recovery codes.
+func (m TOTPModel) Disable(ctx context.Context, userID int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		plaintext := rand.Text()[:10]
+		codes[i] = strings.ToLower(plaintext[:5] + "-" + plaintext[5:])
+
+		var p password
+		if err := p.Set(plaintext); err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, p.hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode undoes the formatting recovery codes are shown with, so
+// they can be typed in either case, with or without the hyphen.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
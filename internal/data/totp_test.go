@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPModel_Provision_AlreadyEnabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TOTPModel{DB: db}
+	secret := []byte("12345678901234567890")
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_totp (user_id, secret)`)).
+		WithArgs(int64(7), secret).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = m.Provision(context.Background(), 7, secret)
+	assert.ErrorIs(t, err, ErrTOTPEnabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTOTPModel_Confirm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TOTPModel{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_totp`)).
+		WithArgs(int64(7), int64(37037036)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM recovery_codes WHERE user_id = $1`)).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for range RecoveryCodeCount {
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO recovery_codes (user_id, hash)`)).
+			WithArgs(int64(7), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	codes, err := m.Confirm(context.Background(), 7, 37037036)
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTOTPModel_UseStep_Replay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TOTPModel{DB: db}
+
+	mock.ExpectExec(regexp.QuoteMeta(`SET last_step = $2`)).
+		WithArgs(int64(7), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ok, err := m.UseStep(context.Background(), 7, 100)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTOTPModel_UseRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := TOTPModel{DB: db}
+
+	var other, code password
+	require.NoError(t, other.Set("ZZZZZZZZZZ"))
+	require.NoError(t, code.Set("ABCDEFGHIJ"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, hash`)).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "hash"}).AddRow(1, other.hash).AddRow(2, code.hash))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE recovery_codes SET used_at = NOW()`)).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ok, err := m.UseRecoveryCode(context.Background(), 7, "abcde-fghij")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
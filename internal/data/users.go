@@ -3,9 +3,11 @@ package data
 import (
 	"cinemesis/internal/validator"
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -20,6 +22,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
 	Version   int       `json:"-"`
 }
 
@@ -34,6 +37,15 @@ type RegisterInput struct {
 	Password string `json:"password"`
 }
 
+// UpdateUserInput changes the authenticated user's own account. Fields left
+// out are not changed, and CurrentPassword is required for any change.
+type UpdateUserInput struct {
+	Name            *string `json:"name"`
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+}
+
 type TokenInput struct {
 	TokenPlaintext string `json:"token"`
 }
@@ -70,6 +82,22 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// unknownUserPassword is checked when a sign-in names an email nobody has, so
+// it takes as long as a wrong password does and doesn't give away which
+// addresses have accounts.
+var unknownUserPassword = sync.OnceValue(func() password {
+	var p password
+	_ = p.Set(rand.Text())
+	return p
+})
+
+// MatchesNoUser does the work of checking a password without a user to check
+// it against. It never matches.
+func MatchesNoUser(plaintextPassword string) {
+	p := unknownUserPassword()
+	_, _ = p.Matches(plaintextPassword)
+}
+
 type UserModel struct {
 	DB *sql.DB
 }
@@ -78,20 +106,30 @@ var (
 	ErrDuplicateEmail = errors.New("duplicate email")
 )
 
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return insertUser(ctx, m.DB, user)
+}
+
+// InsertTx is Insert as part of tx, so the user is only created if everything
+// else written with it commits too.
+func (m UserModel) InsertTx(ctx context.Context, tx *sql.Tx, user *User) error {
+	return insertUser(ctx, tx, user)
+}
+
+func insertUser(ctx context.Context, db rowQueryer, user *User) error {
 	query := `
-        INSERT INTO users (name, email, password_hash, activated) 
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, password_hash, activated, locale) 
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version`
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case err.Error() == `pq: duplicate key value violates unique constraint "idx_users_email_lower"`:
 			return ErrDuplicateEmail
 		default:
 			return err
@@ -101,14 +139,51 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) Get(ctx context.Context, id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, name, email, password_hash, activated, locale, version
+        FROM users
+        WHERE id = $1`
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Locale,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, activated, locale, version
         FROM users
-        WHERE email = $1`
+        WHERE LOWER(email) = LOWER($1)`
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
@@ -118,6 +193,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 
@@ -133,29 +209,39 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return updateUser(ctx, m.DB, user)
+}
+
+// UpdateTx is Update as part of tx.
+func (m UserModel) UpdateTx(ctx context.Context, tx *sql.Tx, user *User) error {
+	return updateUser(ctx, tx, user)
+}
+
+func updateUser(ctx context.Context, db rowQueryer, user *User) error {
 	query := `
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`
 	args := []any{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case err.Error() == `pq: duplicate key value violates unique constraint "idx_users_email_lower"`:
 			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
@@ -168,19 +254,18 @@ func (m UserModel) Update(user *User) error {
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
-	v.Check(email != "", "email", "must be provided")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+	v.String("email", email,
+		validator.Required(),
+		validator.Regexp(validator.EmailRX).Message("must be a valid email address"),
+	)
 }
 
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
-	v.Check(password != "", "password", "must be provided")
-	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.String("password", password, validator.Required(), validator.MinLen(8), validator.MaxLen(72))
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.String("name", user.Name, validator.Required(), validator.MaxLen(500))
 
 	ValidateEmail(v, user.Email)
 
@@ -193,12 +278,12 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -208,7 +293,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
@@ -218,6 +303,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 	if err != nil {
@@ -231,3 +317,47 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	return &user, nil
 }
+
+// GetForEmailChangeToken returns the user an unexpired email change token was
+// issued to, along with the address it confirms.
+func (m UserModel) GetForEmailChangeToken(ctx context.Context, tokenPlaintext string) (*User, string, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version, tokens.new_email
+        FROM users
+        INNER JOIN tokens
+        ON users.id = tokens.user_id
+        WHERE tokens.hash = $1
+        AND tokens.scope = $2
+        AND tokens.expiry > $3`
+
+	args := []any{tokenHash[:], ScopeEmailChange, time.Now()}
+	var user User
+	var newEmail string
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Locale,
+		&user.Version,
+		&newEmail,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, "", ErrRecordNotFound
+		default:
+			return nil, "", err
+		}
+	}
+
+	return &user, newEmail, nil
+}
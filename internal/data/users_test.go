@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
@@ -259,6 +260,7 @@ func TestUserModel_Insert(t *testing.T) {
 		Email:     "test@example.com",
 		Password:  password{},
 		Activated: false,
+		Locale:    "ru",
 	}
 	err = user.Password.Set("password123")
 	require.NoError(t, err)
@@ -267,14 +269,14 @@ func TestUserModel_Insert(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
-        INSERT INTO users (name, email, password_hash, activated) 
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, password_hash, activated, locale) 
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version`)).
-			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated).
+			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.Locale).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "version"}).
 				AddRow(1, fixedCreatedAt, 1))
 
-		err := m.Insert(user)
+		err := m.Insert(context.Background(), user)
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), user.ID)
 		assert.Equal(t, fixedCreatedAt, user.CreatedAt)
@@ -285,13 +287,13 @@ func TestUserModel_Insert(t *testing.T) {
 
 	t.Run("Duplicate email", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
-        INSERT INTO users (name, email, password_hash, activated) 
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, password_hash, activated, locale) 
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version`)).
-			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated).
-			WillReturnError(errors.New("pq: duplicate key value violates unique constraint \"users_email_key\""))
+			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.Locale).
+			WillReturnError(errors.New("pq: duplicate key value violates unique constraint \"idx_users_email_lower\""))
 
-		err := m.Insert(user)
+		err := m.Insert(context.Background(), user)
 		assert.ErrorIs(t, err, ErrDuplicateEmail)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -310,19 +312,20 @@ func TestUserModel_GetByEmail(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, activated, locale, version
         FROM users
-        WHERE email = $1`)).
+        WHERE LOWER(email) = LOWER($1)`)).
 			WithArgs("test@example.com").
-			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "email", "password_hash", "activated", "version"}).
-				AddRow(1, fixedCreatedAt, "Test User", "test@example.com", passwordHash, true, 1))
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "email", "password_hash", "activated", "locale", "version"}).
+				AddRow(1, fixedCreatedAt, "Test User", "test@example.com", passwordHash, true, "en", 1))
 
-		user, err := m.GetByEmail("test@example.com")
+		user, err := m.GetByEmail(context.Background(), "test@example.com")
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), user.ID)
 		assert.Equal(t, "Test User", user.Name)
 		assert.Equal(t, "test@example.com", user.Email)
 		assert.True(t, user.Activated)
+		assert.Equal(t, "en", user.Locale)
 		assert.Equal(t, 1, user.Version)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -330,13 +333,13 @@ func TestUserModel_GetByEmail(t *testing.T) {
 
 	t.Run("Not found", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, activated, locale, version
         FROM users
-        WHERE email = $1`)).
+        WHERE LOWER(email) = LOWER($1)`)).
 			WithArgs("notfound@example.com").
 			WillReturnError(sql.ErrNoRows)
 
-		_, err := m.GetByEmail("notfound@example.com")
+		_, err := m.GetByEmail(context.Background(), "notfound@example.com")
 		assert.ErrorIs(t, err, ErrRecordNotFound)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -363,13 +366,13 @@ func TestUserModel_Update(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`)).
-			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version).
+			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.Locale, user.ID, user.Version).
 			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
 
-		err := m.Update(user)
+		err := m.Update(context.Background(), user)
 		assert.NoError(t, err)
 		assert.Equal(t, 2, user.Version)
 
@@ -379,13 +382,13 @@ func TestUserModel_Update(t *testing.T) {
 	t.Run("Duplicate email", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`)).
-			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version).
-			WillReturnError(errors.New("pq: duplicate key value violates unique constraint \"users_email_key\""))
+			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.Locale, user.ID, user.Version).
+			WillReturnError(errors.New("pq: duplicate key value violates unique constraint \"idx_users_email_lower\""))
 
-		err := m.Update(user)
+		err := m.Update(context.Background(), user)
 		assert.ErrorIs(t, err, ErrDuplicateEmail)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -394,13 +397,13 @@ func TestUserModel_Update(t *testing.T) {
 	t.Run("Edit conflict", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`)).
-			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version).
+			WithArgs(user.Name, user.Email, user.Password.hash, user.Activated, user.Locale, user.ID, user.Version).
 			WillReturnError(sql.ErrNoRows)
 
-		err := m.Update(user)
+		err := m.Update(context.Background(), user)
 		assert.ErrorIs(t, err, ErrEditConflict)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -422,7 +425,7 @@ func TestUserModel_GetForToken(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -430,15 +433,16 @@ func TestUserModel_GetForToken(t *testing.T) {
         AND tokens.scope = $2 
         AND tokens.expiry > $3`)).
 			WithArgs(tokenHash[:], tokenScope, sqlmock.AnyArg()).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "email", "password_hash", "activated", "version"}).
-				AddRow(1, fixedCreatedAt, "Test User", "test@example.com", passwordHash, true, 1))
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "email", "password_hash", "activated", "locale", "version"}).
+				AddRow(1, fixedCreatedAt, "Test User", "test@example.com", passwordHash, true, "en", 1))
 
-		user, err := m.GetForToken(tokenScope, tokenPlaintext)
+		user, err := m.GetForToken(context.Background(), tokenScope, tokenPlaintext)
 		assert.NoError(t, err)
 		assert.Equal(t, int64(1), user.ID)
 		assert.Equal(t, "Test User", user.Name)
 		assert.Equal(t, "test@example.com", user.Email)
 		assert.True(t, user.Activated)
+		assert.Equal(t, "en", user.Locale)
 		assert.Equal(t, 1, user.Version)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
@@ -446,7 +450,7 @@ func TestUserModel_GetForToken(t *testing.T) {
 
 	t.Run("Not found", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -456,7 +460,46 @@ func TestUserModel_GetForToken(t *testing.T) {
 			WithArgs(tokenHash[:], tokenScope, sqlmock.AnyArg()).
 			WillReturnError(sql.ErrNoRows)
 
-		_, err := m.GetForToken(tokenScope, tokenPlaintext)
+		_, err := m.GetForToken(context.Background(), tokenScope, tokenPlaintext)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUserModel_GetForEmailChangeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	m := UserModel{DB: db}
+	fixedCreatedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tokenPlaintext := "validtoken123"
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := regexp.QuoteMeta(`SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version, tokens.new_email`)
+
+	t.Run("Success", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs(tokenHash[:], ScopeEmailChange, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "email", "password_hash", "activated", "locale", "version", "new_email"}).
+				AddRow(1, fixedCreatedAt, "Test User", "old@example.com", []byte("hash"), true, "en", 3, "new@example.com"))
+
+		user, newEmail, err := m.GetForEmailChangeToken(context.Background(), tokenPlaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), user.ID)
+		assert.Equal(t, "old@example.com", user.Email)
+		assert.Equal(t, "new@example.com", newEmail)
+		assert.Equal(t, 3, user.Version)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs(tokenHash[:], ScopeEmailChange, sqlmock.AnyArg()).
+			WillReturnError(sql.ErrNoRows)
+
+		_, _, err := m.GetForEmailChangeToken(context.Background(), tokenPlaintext)
 		assert.ErrorIs(t, err, ErrRecordNotFound)
 
 		assert.NoError(t, mock.ExpectationsWereMet())
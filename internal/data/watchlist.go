@@ -0,0 +1,152 @@
+package data
+
+import (
+	"cinemesis/internal/filters"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyOnWatchlist = errors.New("movie already on watchlist")
+)
+
+type WatchlistEntry struct {
+	MovieID int64     `json:"movie_id"`
+	Title   string    `json:"title"`
+	Year    int32     `json:"year,omitzero"`
+	Runtime Runtime   `json:"runtime,omitzero"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+func (m WatchlistModel) Insert(ctx context.Context, userID int64, entry *WatchlistEntry) error {
+	query := `
+        INSERT INTO watchlist (user_id, movie_id)
+        VALUES ($1, $2)
+        RETURNING added_at`
+
+	err := m.DB.QueryRowContext(ctx, query, userID, entry.MovieID).Scan(&entry.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlist_pkey"`:
+			return ErrAlreadyOnWatchlist
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m WatchlistModel) GetAll(ctx context.Context, userID int64, wf filters.WatchlistFilters) ([]*WatchlistEntry, int, error) {
+	query, args := filters.NewQueryBuilder().BuildWatchlistQuery(userID, wf)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []*WatchlistEntry{}
+	var totalRecords int
+
+	for rows.Next() {
+		var entry WatchlistEntry
+		err := rows.Scan(
+			&totalRecords,
+			&entry.MovieID,
+			&entry.Title,
+			&entry.Year,
+			&entry.Runtime,
+			&entry.AddedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, totalRecords, nil
+}
+
+func (m WatchlistModel) Delete(ctx context.Context, userID, movieID int64) error {
+	query := `
+        DELETE FROM watchlist
+        WHERE user_id = $1 AND movie_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// LoadUserFlags sets InWatchlist and Watched on each movie for the given user,
+// the latter from the user's diary.
+func (m WatchlistModel) LoadUserFlags(ctx context.Context, userID int64, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	query := `
+        SELECT ids.id,
+            EXISTS (SELECT 1 FROM watchlist w WHERE w.user_id = $1 AND w.movie_id = ids.id),
+            EXISTS (SELECT 1 FROM diary_entries d WHERE d.user_id = $1 AND d.movie_id = ids.id)
+        FROM unnest($2::bigint[]) AS ids(id)`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type flags struct{ inWatchlist, watched bool }
+	byMovie := make(map[int64]flags, len(movies))
+
+	for rows.Next() {
+		var id int64
+		var f flags
+		if err := rows.Scan(&id, &f.inWatchlist, &f.watched); err != nil {
+			return err
+		}
+		byMovie[id] = f
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		f := byMovie[movie.ID]
+		movie.InWatchlist = &f.inWatchlist
+		movie.Watched = &f.watched
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package filters
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorCodec(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	cursor := Cursor{Sort: "-year", Key: "2018", ID: 42, Backward: true}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		decoded, err := codec.Decode(codec.Encode(cursor))
+		require.NoError(t, err)
+		assert.Equal(t, cursor, decoded)
+	})
+
+	t.Run("TamperedPayload", func(t *testing.T) {
+		token := codec.Encode(cursor)
+		forged := codec.Encode(Cursor{Sort: "-year", Key: "1999", ID: 1})
+		payload, _, _ := strings.Cut(forged, ".")
+		_, signature, _ := strings.Cut(token, ".")
+
+		_, err := codec.Decode(payload + "." + signature)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("OtherSecret", func(t *testing.T) {
+		_, err := NewCursorCodec([]byte("other")).Decode(codec.Encode(cursor))
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("Garbage", func(t *testing.T) {
+		_, err := codec.Decode("not-a-cursor")
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestTrimCursorPage(t *testing.T) {
+	key := func(id int) (string, int64) { return strconv.Itoa(id), int64(id) }
+	page := PageFilters{PageSize: 2, CursorMode: true}
+
+	t.Run("FirstPage", func(t *testing.T) {
+		rows, next, prev := TrimCursorPage(page, "id", []int{1, 2, 3}, key)
+		assert.Equal(t, []int{1, 2}, rows)
+		require.NotNil(t, next)
+		assert.Equal(t, int64(2), next.ID)
+		assert.Nil(t, prev)
+	})
+
+	t.Run("LastPage", func(t *testing.T) {
+		p := page
+		p.Cursor = &Cursor{Sort: "id", Key: "2", ID: 2}
+
+		rows, next, prev := TrimCursorPage(p, "id", []int{3}, key)
+		assert.Equal(t, []int{3}, rows)
+		assert.Nil(t, next)
+		require.NotNil(t, prev)
+		assert.Equal(t, int64(3), prev.ID)
+		assert.True(t, prev.Backward)
+	})
+
+	t.Run("BackwardPage", func(t *testing.T) {
+		p := page
+		p.Cursor = &Cursor{Sort: "id", Key: "3", ID: 3, Backward: true}
+
+		rows, next, prev := TrimCursorPage(p, "id", []int{2, 1}, key)
+		assert.Equal(t, []int{1, 2}, rows)
+		require.NotNil(t, next)
+		assert.Equal(t, int64(2), next.ID)
+		assert.Nil(t, prev)
+	})
+}
+
+func TestBuildMovieQueryCursor(t *testing.T) {
+	mf := NewMovieFilters()
+	mf.Sort = "-year"
+	mf.CursorMode = true
+	mf.Cursor = &Cursor{Sort: "-year", Key: "2018", ID: 7}
+
+	query, args := NewMovieQueryBuilder().WithYearRange(1990, 0).Build(mf)
+
+	assert.Contains(t, query, "SELECT 0, m.id")
+	assert.Contains(t, query, "(m.year, m.id) < ($2::integer, $3)")
+	assert.Contains(t, query, "ORDER BY m.year DESC, m.id DESC")
+	assert.Contains(t, query, "LIMIT $4")
+	assert.NotContains(t, query, "OFFSET")
+	assert.Equal(t, []any{int32(1990), "2018", int64(7), 21}, args)
+
+	mf.IncludeTotal = true
+	query, _ = NewMovieQueryBuilder().WithYearRange(1990, 0).Build(mf)
+	assert.Contains(t, query, "(SELECT count(*) FROM movies m WHERE m.year >= $1)")
+}
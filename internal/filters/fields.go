@@ -0,0 +1,90 @@
+package filters
+
+import (
+	"cinemesis/internal/utils"
+	"cinemesis/internal/validator"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Column is a field of a listing that can be picked with the fields parameter,
+// and the SQL expression it is read from.
+type Column struct {
+	Field string
+	Expr  string
+}
+
+// Fieldset holds the fields and include parameters: which fields of a resource
+// to return, and which related resources to embed in it. Nil Fields means all
+// of them; Include starts out as the resource's default relations.
+type Fieldset struct {
+	Fields          []string
+	Include         []string
+	FieldSafelist   []string
+	IncludeSafelist []string
+}
+
+// readFieldset reads the fields and include parameters. An include parameter
+// replaces the default relations, so an empty one embeds none.
+func (f *Fieldset) readFieldset(qs url.Values) {
+	f.Fields = utils.ReadCSV(qs, "fields", nil)
+	if qs.Has("include") {
+		f.Include = utils.ReadCSV(qs, "include", []string{})
+	}
+}
+
+func ValidateFieldset(v *validator.Validator, f Fieldset) {
+	v.Strings("fields", f.Fields, validator.UniqueValues(), validator.Each(validator.OneOf(f.FieldSafelist...)))
+	v.Strings("include", f.Include, validator.UniqueValues(), validator.Each(validator.OneOf(f.IncludeSafelist...)))
+}
+
+// Has reports whether the field is to be returned.
+func (f Fieldset) Has(field string) bool {
+	return f.Fields == nil || slices.Contains(f.Fields, field)
+}
+
+// Includes reports whether the related resource is to be embedded.
+func (f Fieldset) Includes(relation string) bool {
+	return slices.Contains(f.Include, relation)
+}
+
+// Sparse reports whether only some fields were asked for.
+func (f Fieldset) Sparse() bool {
+	return f.Fields != nil
+}
+
+// Keep returns the JSON members a sparse response keeps: the fields asked for
+// and the relations embedded.
+func (f Fieldset) Keep() []string {
+	return append(slices.Clone(f.Fields), f.Include...)
+}
+
+// columns returns the columns to select, in their listed order: those the
+// fieldset asks for and those named in required, which the query needs for
+// ordering and pagination whatever the client wants back.
+func (f Fieldset) columns(all []Column, required ...string) []Column {
+	var cols []Column
+	for _, c := range all {
+		if f.Has(c.Field) || slices.Contains(required, c.Field) {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+func fieldNames(cols []Column) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Field
+	}
+	return names
+}
+
+func selectList(cols []Column) string {
+	exprs := make([]string, len(cols))
+	for i, c := range cols {
+		exprs[i] = c.Expr
+	}
+	return strings.Join(exprs, ", ")
+}
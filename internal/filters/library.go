@@ -0,0 +1,153 @@
+package filters
+
+import (
+	"cinemesis/internal/utils"
+	"cinemesis/internal/validator"
+	"fmt"
+	"net/url"
+)
+
+type WatchlistFilters struct {
+	PageFilters
+}
+
+type DiaryFilters struct {
+	PageFilters
+	MovieID int64 `json:"movie_id,omitempty"`
+}
+
+func NewWatchlistFilters() WatchlistFilters {
+	return WatchlistFilters{
+		PageFilters: PageFilters{
+			Page:     DefaultPage,
+			PageSize: DefaultPageSize,
+			Sort:     "-added_at",
+			SortSafelist: []string{
+				"added_at", "title", "year",
+				"-added_at", "-title", "-year",
+			},
+		},
+	}
+}
+
+func ParseWatchlistFiltersFromQuery(qs url.Values, v *validator.Validator) WatchlistFilters {
+	filters := NewWatchlistFilters()
+
+	filters.Page = utils.ReadInt(qs, "page", 1, v)
+	filters.PageSize = utils.ReadInt(qs, "page_size", 20, v)
+	filters.Sort = utils.ReadString(qs, "sort", "-added_at")
+
+	return filters
+}
+
+func (wf *WatchlistFilters) ValidateWatchlistFilters(v *validator.Validator, f WatchlistFilters) {
+	ValidatePageFilters(v, f.PageFilters)
+}
+
+func (qb *QueryBuilder) BuildWatchlistQuery(userID int64, filters WatchlistFilters) (string, []any) {
+	qb.argCount++
+	qb.conditions = append(qb.conditions, fmt.Sprintf("w.user_id = $%d", qb.argCount))
+	qb.args = append(qb.args, userID)
+
+	columnMap := map[string]string{
+		"added_at": "w.added_at",
+		"title":    "m.title",
+		"year":     "m.year",
+	}
+
+	actualColumn, exists := columnMap[filters.SortColumn()]
+	if !exists {
+		actualColumn = "w.added_at"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), m.id, m.title, m.year, m.runtime, w.added_at
+		FROM watchlist w
+		INNER JOIN movies m ON m.id = w.movie_id
+		%s
+		ORDER BY %s %s, m.id ASC
+		%s`,
+		whereClause(qb.conditions),
+		actualColumn,
+		filters.sortDirection(),
+		qb.limitClause(filters.PageFilters),
+	)
+
+	return query, qb.args
+}
+
+func NewDiaryFilters() DiaryFilters {
+	return DiaryFilters{
+		PageFilters: PageFilters{
+			Page:     DefaultPage,
+			PageSize: DefaultPageSize,
+			Sort:     "-watched_on",
+			SortSafelist: []string{
+				"watched_on", "rating", "title",
+				"-watched_on", "-rating", "-title",
+			},
+		},
+	}
+}
+
+func ParseDiaryFiltersFromQuery(qs url.Values, v *validator.Validator) DiaryFilters {
+	filters := NewDiaryFilters()
+
+	filters.Page = utils.ReadInt(qs, "page", 1, v)
+	filters.PageSize = utils.ReadInt(qs, "page_size", 20, v)
+	filters.Sort = utils.ReadString(qs, "sort", "-watched_on")
+	filters.MovieID = int64(utils.ReadInt(qs, "movie_id", 0, v))
+
+	return filters
+}
+
+func (df *DiaryFilters) ValidateDiaryFilters(v *validator.Validator, f DiaryFilters) {
+	ValidatePageFilters(v, f.PageFilters)
+
+	v.Check(f.MovieID >= 0, "movie_id", validator.CodeOutOfRange, "must be a positive integer")
+}
+
+// BuildDiaryQuery lists a user's diary entries. Entries without a rating sort
+// last whichever the direction; ties are broken by entry id in the same
+// direction, so entries logged on the same day keep the order they were added.
+func (qb *QueryBuilder) BuildDiaryQuery(userID int64, filters DiaryFilters) (string, []any) {
+	qb.argCount++
+	qb.conditions = append(qb.conditions, fmt.Sprintf("d.user_id = $%d", qb.argCount))
+	qb.args = append(qb.args, userID)
+
+	if filters.MovieID > 0 {
+		qb.argCount++
+		qb.conditions = append(qb.conditions, fmt.Sprintf("d.movie_id = $%d", qb.argCount))
+		qb.args = append(qb.args, filters.MovieID)
+	}
+
+	columnMap := map[string]string{
+		"watched_on": "d.watched_on",
+		"rating":     "d.rating",
+		"title":      "m.title",
+	}
+
+	actualColumn, exists := columnMap[filters.SortColumn()]
+	if !exists {
+		actualColumn = "d.watched_on"
+	}
+
+	direction := filters.sortDirection()
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), d.id, d.movie_id, m.title, m.year, to_char(d.watched_on, 'YYYY-MM-DD'),
+			d.rewatch, COALESCE(d.rating, 0), d.notes, d.created_at, d.version
+		FROM diary_entries d
+		INNER JOIN movies m ON m.id = d.movie_id
+		%s
+		ORDER BY %s %s NULLS LAST, d.id %s
+		%s`,
+		whereClause(qb.conditions),
+		actualColumn,
+		direction,
+		direction,
+		qb.limitClause(filters.PageFilters),
+	)
+
+	return query, qb.args
+}
@@ -0,0 +1,44 @@
+package filters
+
+import (
+	"net/url"
+	"testing"
+
+	"cinemesis/internal/validator"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildWatchlistQuery(t *testing.T) {
+	wf := NewWatchlistFilters()
+	wf.Sort = "title"
+
+	query, args := NewQueryBuilder().BuildWatchlistQuery(7, wf)
+
+	assert.Contains(t, query, "WHERE w.user_id = $1")
+	assert.Contains(t, query, "ORDER BY m.title ASC, m.id ASC")
+	assert.Contains(t, query, "LIMIT $2 OFFSET $3")
+	assert.Equal(t, []any{int64(7), 20, 0}, args)
+}
+
+func TestBuildDiaryQuery(t *testing.T) {
+	v := validator.New()
+	df := ParseDiaryFiltersFromQuery(url.Values{"movie_id": {"3"}, "sort": {"-rating"}, "page": {"2"}}, v)
+	df.ValidateDiaryFilters(v, df)
+	assert.True(t, v.Valid())
+
+	query, args := NewQueryBuilder().BuildDiaryQuery(7, df)
+
+	assert.Contains(t, query, "WHERE d.user_id = $1 AND d.movie_id = $2")
+	assert.Contains(t, query, "ORDER BY d.rating DESC NULLS LAST, d.id DESC")
+	assert.Contains(t, query, "LIMIT $3 OFFSET $4")
+	assert.Equal(t, []any{int64(7), int64(3), 20, 20}, args)
+}
+
+func TestValidateDiaryFilters_Sort(t *testing.T) {
+	v := validator.New()
+	df := ParseDiaryFiltersFromQuery(url.Values{"sort": {"added_at"}}, v)
+	df.ValidateDiaryFilters(v, df)
+
+	assert.Equal(t, "invalid sort value", v.Errors["sort"])
+}
@@ -5,20 +5,56 @@ import (
 	"cinemesis/internal/validator"
 	"fmt"
 	"net/url"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/lib/pq"
 )
 
+// RatingMeanJoin exposes the catalogue-wide mean rating as rs.mean, read from
+// the single row of rating_stats the background jobs refresh, and
+// WeightedRatingExpr is the Bayesian score built from it. Every
+// movie gets 10 extra votes at the mean, (v*R + 10*C) / (v + 10), so a film
+// with a handful of 10s doesn't outrank one with hundreds of 8s.
+const (
+	RatingMeanJoin     = `CROSS JOIN rating_stats rs`
+	WeightedRatingExpr = `((m.rating_sum + 10 * rs.mean) / (m.rating_count + 10))`
+)
+
+// MovieFields are the movie fields clients can pick with the fields parameter.
+var MovieFields = []string{
+	"id", "updated_at", "title", "year", "runtime", "average_rating", "weighted_rating",
+	"rating_count", "rating_histogram", "in_watchlist", "watched", "version",
+}
+
+// movieColumns are the movie columns listings select, in the order they are
+// scanned.
+var movieColumns = []Column{
+	{"id", "m.id"},
+	{"created_at", "m.created_at"},
+	{"updated_at", "m.updated_at"},
+	{"title", "m.title"},
+	{"year", "m.year"},
+	{"runtime", "m.runtime"},
+	{"version", "m.version"},
+	{"rating_count", "m.rating_count"},
+	{"average_rating", "m.average_rating"},
+	{"weighted_rating", WeightedRatingExpr},
+	{"rating_histogram", "m.rating_histogram"},
+}
+
 type MovieFilters struct {
 	PageFilters
+	Fieldset
 	Title      string   `json:"title,omitempty"`
 	Genres     []string `json:"genres,omitempty"`
 	MinYear    int32    `json:"min_year,omitempty"`
 	MaxYear    int32    `json:"max_year,omitempty"`
 	MinRuntime int32    `json:"min_runtime,omitempty"`
 	MaxRuntime int32    `json:"max_runtime,omitempty"`
+	Actor      string   `json:"actor,omitempty"`
+	Director   string   `json:"director,omitempty"`
+	MinRating  float64  `json:"min_rating,omitempty"`
 }
 
 type MovieQueryBuilder struct {
@@ -36,39 +72,62 @@ func NewMovieQueryBuilder() *MovieQueryBuilder {
 }
 
 func (qb *QueryBuilder) BuildMovieQuery(filters MovieFilters) (string, []any) {
-	var whereClause string
-	if len(qb.conditions) > 0 {
-		whereClause = "WHERE " + strings.Join(qb.conditions, " AND ")
-	}
+	filterWhere := whereClause(qb.conditions)
 
 	columnMap := map[string]string{
 		"id":      "m.id",
 		"title":   "m.title",
 		"year":    "m.year",
 		"runtime": "m.runtime",
+
+		"rating":          "m.average_rating",
+		"weighted_rating": WeightedRatingExpr,
+	}
+
+	// castMap holds the column types cursor keys are cast to.
+	castMap := map[string]string{
+		"m.id":      "bigint",
+		"m.title":   "text",
+		"m.year":    "integer",
+		"m.runtime": "integer",
+
+		"m.average_rating": "double precision",
+		WeightedRatingExpr: "double precision",
 	}
 
-	sortColumn := filters.sortColumn()
+	sortColumn := filters.SortColumn()
 	actualColumn, exists := columnMap[sortColumn]
 	if !exists {
 		actualColumn = "m.id"
 	}
 
+	orderBy := fmt.Sprintf("%s %s, m.id ASC", actualColumn, filters.sortDirection())
+	if filters.CursorMode {
+		orderBy = qb.addKeysetCondition(filters.PageFilters, actualColumn, castMap[actualColumn], "m.id", filters.sortDirection())
+	}
+
+	// The mean is only needed for the weighted rating.
+	var meanJoin string
+	if slices.Contains(filters.Columns(), "weighted_rating") {
+		meanJoin = RatingMeanJoin
+	}
+
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), m.id, m.created_at, m.updated_at, m.title, m.year, m.runtime, m.version
+		SELECT %s, %s
 		FROM movies m
 		%s
-		ORDER BY %s %s, m.id ASC
-		LIMIT $%d OFFSET $%d`,
-		whereClause,
-		actualColumn,
-		filters.sortDirection(),
-		qb.argCount+1,
-		qb.argCount+2,
+		%s
+		ORDER BY %s
+		%s`,
+		filters.totalExpr("movies m", filterWhere),
+		selectList(filters.columns(movieColumns, "id", filters.sortField())),
+		meanJoin,
+		whereClause(qb.conditions),
+		orderBy,
+		qb.limitClause(filters.PageFilters),
 	)
 
-	args := append(qb.args, filters.limit(), filters.offset())
-	return query, args
+	return query, qb.args
 }
 
 func NewMovieFilters() MovieFilters {
@@ -78,11 +137,42 @@ func NewMovieFilters() MovieFilters {
 			PageSize: 20,
 			Sort:     "year",
 			SortSafelist: []string{
-				"id", "title", "year", "runtime",
-				"-id", "-title", "-year", "-runtime",
+				"id", "title", "year", "runtime", "rating", "weighted_rating",
+				"-id", "-title", "-year", "-runtime", "-rating", "-weighted_rating",
 			},
 		},
+		Fieldset: Fieldset{
+			Include:         []string{"genres"},
+			FieldSafelist:   MovieFields,
+			IncludeSafelist: []string{"genres"},
+		},
+	}
+}
+
+// ParseMovieFieldsetFromQuery reads the fields and include parameters for a
+// single movie, which can also embed its credits and top reviews.
+func ParseMovieFieldsetFromQuery(qs url.Values) Fieldset {
+	f := Fieldset{
+		Include:         []string{"genres", "credits", "top_reviews"},
+		FieldSafelist:   MovieFields,
+		IncludeSafelist: []string{"genres", "credits", "top_reviews"},
+	}
+	f.readFieldset(qs)
+	return f
+}
+
+// Columns returns the fields the movie query selects, in order, for scanning.
+// The id and the sort column are always among them.
+func (mf MovieFilters) Columns() []string {
+	return fieldNames(mf.columns(movieColumns, "id", mf.sortField()))
+}
+
+// sortField returns the movie field the listing is sorted by.
+func (mf MovieFilters) sortField() string {
+	if mf.SortColumn() == "rating" {
+		return "average_rating"
 	}
+	return mf.SortColumn()
 }
 
 func ParseMovieFiltersFromQuery(qs url.Values, v *validator.Validator) MovieFilters {
@@ -91,26 +181,43 @@ func ParseMovieFiltersFromQuery(qs url.Values, v *validator.Validator) MovieFilt
 	filters.Page = utils.ReadInt(qs, "page", 1, v)
 	filters.PageSize = utils.ReadInt(qs, "page_size", 20, v)
 	filters.Sort = utils.ReadString(qs, "sort", "id")
+	filters.readCursor(qs, v)
 	filters.Title = utils.ReadString(qs, "title", "")
 	filters.Genres = utils.ReadCSV(qs, "genres", []string{})
 	filters.MinYear = int32(utils.ReadInt(qs, "min_year", 0, v))
 	filters.MaxYear = int32(utils.ReadInt(qs, "max_year", 0, v))
 	filters.MinRuntime = int32(utils.ReadInt(qs, "min_runtime", 0, v))
 	filters.MaxRuntime = int32(utils.ReadInt(qs, "max_runtime", 0, v))
+	filters.Actor = utils.ReadString(qs, "actor", "")
+	filters.Director = utils.ReadString(qs, "director", "")
+	filters.MinRating = utils.ReadFloat(qs, "min_rating", 0, v)
+	filters.readFieldset(qs)
 
 	return filters
 }
 
+// CursorSort identifies the ordering cursors for this listing are issued for.
+func (mf MovieFilters) CursorSort() string {
+	return mf.Sort
+}
+
+func (mf *MovieFilters) DecodeCursor(codec *CursorCodec, v *validator.Validator) {
+	mf.decodeCursor(codec, mf.CursorSort(), v)
+}
+
 func (mf *MovieFilters) ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
 	ValidatePageFilters(v, f.PageFilters)
+	ValidateFieldset(v, f.Fieldset)
 
-	v.Check(f.MinYear == 0 || f.MinYear >= 1888, "min_year", "must be greater than 1888")
-	v.Check(f.MaxYear == 0 || f.MaxYear <= int32(time.Now().Year()+10), "max_year", "must not be too far in the future")
-	v.Check(f.MinYear == 0 || f.MaxYear == 0 || f.MinYear <= f.MaxYear, "max_year", "must be greater than min_year")
+	v.Check(f.MinYear == 0 || f.MinYear >= 1888, "min_year", validator.CodeOutOfRange, "must be greater than 1888")
+	v.Check(f.MaxYear == 0 || f.MaxYear <= int32(time.Now().Year()+10), "max_year", validator.CodeOutOfRange, "must not be too far in the future")
+	v.Check(f.MinYear == 0 || f.MaxYear == 0 || f.MinYear <= f.MaxYear, "max_year", validator.CodeOutOfRange, "must be greater than min_year")
 
-	v.Check(f.MinRuntime == 0 || f.MinRuntime > 0, "min_runtime", "must be greater than zero")
-	v.Check(f.MaxRuntime == 0 || f.MaxRuntime <= 1000, "max_runtime", "must be a maximum of 1000 minutes")
-	v.Check(f.MinRuntime == 0 || f.MaxRuntime == 0 || f.MinRuntime <= f.MaxRuntime, "max_runtime", "must be greater than min_runtime")
+	v.Check(f.MinRuntime == 0 || f.MinRuntime > 0, "min_runtime", validator.CodeOutOfRange, "must be greater than zero")
+	v.Check(f.MaxRuntime == 0 || f.MaxRuntime <= 1000, "max_runtime", validator.CodeOutOfRange, "must be a maximum of 1000 minutes")
+	v.Check(f.MinRuntime == 0 || f.MaxRuntime == 0 || f.MinRuntime <= f.MaxRuntime, "max_runtime", validator.CodeOutOfRange, "must be greater than min_runtime")
+
+	v.Check(f.MinRating >= 0 && f.MinRating <= 10, "min_rating", validator.CodeOutOfRange, "must be between 0 and 10")
 }
 
 func (qb *QueryBuilder) AddTitleFilter(title string) *QueryBuilder {
@@ -186,6 +293,34 @@ func (mqb *MovieQueryBuilder) WithGenres(genreIDs []int64) *MovieQueryBuilder {
 	return mqb
 }
 
+func (qb *QueryBuilder) AddMinRatingFilter(minRating float64) *QueryBuilder {
+	qb.argCount++
+	qb.conditions = append(qb.conditions, fmt.Sprintf("m.average_rating >= $%d", qb.argCount))
+	qb.args = append(qb.args, minRating)
+	return qb
+}
+
+func (mqb *MovieQueryBuilder) WithMinRating(minRating float64) *MovieQueryBuilder {
+	if minRating > 0 {
+		mqb.AddMinRatingFilter(minRating)
+	}
+	return mqb
+}
+
+func (mqb *MovieQueryBuilder) WithActor(actor string) *MovieQueryBuilder {
+	if actor != "" {
+		mqb.AddCreditFilter("cast", actor)
+	}
+	return mqb
+}
+
+func (mqb *MovieQueryBuilder) WithDirector(director string) *MovieQueryBuilder {
+	if director != "" {
+		mqb.AddCreditFilter("director", director)
+	}
+	return mqb
+}
+
 func (mqb *MovieQueryBuilder) WithYearRange(min, max int32) *MovieQueryBuilder {
 	mqb.AddYearRangeFilter(min, max)
 	return mqb
@@ -0,0 +1,80 @@
+package filters
+
+import (
+	"net/url"
+	"testing"
+
+	"cinemesis/internal/validator"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMovieQueryRatings(t *testing.T) {
+	t.Run("SortByWeightedRating", func(t *testing.T) {
+		mf := NewMovieFilters()
+		mf.Sort = "-weighted_rating"
+		mf.MinRating = 7
+
+		query, args := NewMovieQueryBuilder().WithMinRating(mf.MinRating).Build(mf)
+
+		assert.Contains(t, query, RatingMeanJoin)
+		assert.Contains(t, query, "WHERE m.average_rating >= $1")
+		assert.Contains(t, query, "ORDER BY "+WeightedRatingExpr+" DESC, m.id ASC")
+		assert.Equal(t, []any{7.0, 20, 0}, args)
+	})
+
+	t.Run("CursorOnAverageRating", func(t *testing.T) {
+		mf := NewMovieFilters()
+		mf.Sort = "rating"
+		mf.CursorMode = true
+		mf.Cursor = &Cursor{Sort: "rating", Key: "7.5", ID: 3}
+
+		query, args := NewMovieQueryBuilder().Build(mf)
+
+		assert.Contains(t, query, "(m.average_rating, m.id) > ($1::double precision, $2)")
+		assert.Equal(t, []any{"7.5", int64(3), 21}, args)
+	})
+}
+
+func TestValidateMovieFiltersMinRating(t *testing.T) {
+	v := validator.New()
+	mf := ParseMovieFiltersFromQuery(url.Values{"min_rating": {"11"}, "sort": {"-rating"}}, v)
+	mf.ValidateMovieFilters(v, mf)
+
+	assert.Equal(t, map[string]string{"min_rating": "must be between 0 and 10"}, v.Errors)
+}
+
+func TestMovieFieldset(t *testing.T) {
+	t.Run("SelectsRequestedColumns", func(t *testing.T) {
+		v := validator.New()
+		mf := ParseMovieFiltersFromQuery(url.Values{"fields": {"title,year"}, "include": {""}, "sort": {"-runtime"}}, v)
+		mf.ValidateMovieFilters(v, mf)
+		assert.True(t, v.Valid())
+
+		assert.Equal(t, []string{"id", "title", "year", "runtime"}, mf.Columns())
+		assert.False(t, mf.Includes("genres"))
+		assert.Equal(t, []string{"title", "year"}, mf.Keep())
+
+		query, _ := NewMovieQueryBuilder().Build(mf)
+		assert.Contains(t, query, "SELECT count(*) OVER(), m.id, m.title, m.year, m.runtime\n")
+		assert.NotContains(t, query, RatingMeanJoin)
+	})
+
+	t.Run("DefaultsToEverything", func(t *testing.T) {
+		mf := ParseMovieFiltersFromQuery(url.Values{}, validator.New())
+
+		assert.False(t, mf.Sparse())
+		assert.True(t, mf.Includes("genres"))
+		assert.Len(t, mf.Columns(), len(movieColumns))
+	})
+
+	t.Run("RejectsUnknownFields", func(t *testing.T) {
+		v := validator.New()
+		mf := ParseMovieFiltersFromQuery(url.Values{"fields": {"title,password"}, "include": {"credits"}}, v)
+		mf.ValidateMovieFilters(v, mf)
+
+		assert.Contains(t, v.Errors, "fields[1]")
+		assert.Contains(t, v.Errors, "include[0]")
+		assert.Equal(t, validator.CodeNotAllowed, v.Codes["fields[1]"])
+	})
+}
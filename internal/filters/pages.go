@@ -1,7 +1,10 @@
 package filters
 
 import (
+	"cinemesis/internal/utils"
 	"cinemesis/internal/validator"
+	"fmt"
+	"net/url"
 	"slices"
 	"strings"
 )
@@ -18,6 +21,13 @@ type PageFilters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+
+	// Cursor pagination is opt-in through the cursor query parameter. It skips
+	// the total count unless IncludeTotal is set.
+	CursorMode   bool
+	CursorToken  string
+	Cursor       *Cursor
+	IncludeTotal bool
 }
 
 type QueryBuilder struct {
@@ -35,14 +45,21 @@ func NewQueryBuilder() *QueryBuilder {
 }
 
 func ValidatePageFilters(v *validator.Validator, f PageFilters) {
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	v.Check(f.Page > 0, "page", validator.CodeOutOfRange, "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", validator.CodeOutOfRange, "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", validator.CodeOutOfRange, "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", validator.CodeOutOfRange, "must be a maximum of 100")
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", validator.CodeNotAllowed, "invalid sort value")
+	v.Check(!f.CursorMode || f.Page == 1, "page", validator.CodeNotAllowed, "cannot be combined with cursor")
+}
+
+func (p *PageFilters) readCursor(qs url.Values, v *validator.Validator) {
+	p.CursorMode = qs.Has("cursor")
+	p.CursorToken = qs.Get("cursor")
+	p.IncludeTotal = utils.ReadBool(qs, "include_total", false, v)
 }
 
-func (p PageFilters) sortColumn() string {
+func (p PageFilters) SortColumn() string {
 	if slices.Contains(p.SortSafelist, p.Sort) {
 		return strings.TrimPrefix(p.Sort, "-")
 	}
@@ -63,8 +80,69 @@ func (q QueryBuilder) AddArg(arg any) QueryBuilder {
 }
 
 func (p PageFilters) limit() int {
+	if p.CursorMode {
+		return p.PageSize + 1
+	}
 	return p.PageSize
 }
 func (p PageFilters) offset() int {
 	return (p.Page - 1) * p.PageSize
 }
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// totalExpr returns the select expression for the total record count. Offset
+// pages use the window count; cursor pages only count when asked to, and then
+// over the filtered table, since the window would only see rows past the cursor.
+func (p PageFilters) totalExpr(from, where string) string {
+	switch {
+	case !p.CursorMode:
+		return "count(*) OVER()"
+	case p.IncludeTotal:
+		return fmt.Sprintf("(SELECT count(*) FROM %s %s)", from, where)
+	default:
+		return "0"
+	}
+}
+
+// addKeysetCondition restricts the query to the rows past the cursor and returns
+// the ORDER BY clause for the page. The id breaks ties in the same direction as
+// the sort column so (column, id) can be compared as a row value; backward
+// cursors walk the index in reverse and TrimCursorPage restores the order.
+func (qb *QueryBuilder) addKeysetCondition(p PageFilters, column, cast, idColumn, direction string) string {
+	if p.Cursor != nil && p.Cursor.Backward {
+		direction = map[string]string{"ASC": "DESC", "DESC": "ASC"}[direction]
+	}
+
+	if p.Cursor != nil {
+		op := ">"
+		if direction == "DESC" {
+			op = "<"
+		}
+		qb.conditions = append(qb.conditions, fmt.Sprintf("(%s, %s) %s ($%d::%s, $%d)",
+			column, idColumn, op, qb.argCount+1, cast, qb.argCount+2))
+		qb.args = append(qb.args, p.Cursor.Key, p.Cursor.ID)
+		qb.argCount += 2
+	}
+
+	return fmt.Sprintf("%s %s, %s %s", column, direction, idColumn, direction)
+}
+
+// limitClause returns the LIMIT/OFFSET clause and its arguments. Cursor pages
+// have no offset.
+func (qb *QueryBuilder) limitClause(p PageFilters) string {
+	if p.CursorMode {
+		qb.argCount++
+		qb.args = append(qb.args, p.limit())
+		return fmt.Sprintf("LIMIT $%d", qb.argCount)
+	}
+
+	qb.argCount += 2
+	qb.args = append(qb.args, p.limit(), p.offset())
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", qb.argCount-1, qb.argCount)
+}
@@ -0,0 +1,94 @@
+package filters
+
+import (
+	"cinemesis/internal/utils"
+	"cinemesis/internal/validator"
+	"fmt"
+	"net/url"
+)
+
+type PeopleFilters struct {
+	PageFilters
+	Name string `json:"name,omitempty"`
+}
+
+func NewPeopleFilters() PeopleFilters {
+	return PeopleFilters{
+		PageFilters: PageFilters{
+			Page:     DefaultPage,
+			PageSize: DefaultPageSize,
+			Sort:     "name",
+			SortSafelist: []string{
+				"id", "name",
+				"-id", "-name",
+			},
+		},
+	}
+}
+
+func ParsePeopleFiltersFromQuery(qs url.Values, v *validator.Validator) PeopleFilters {
+	filters := NewPeopleFilters()
+
+	filters.Page = utils.ReadInt(qs, "page", 1, v)
+	filters.PageSize = utils.ReadInt(qs, "page_size", 20, v)
+	filters.Sort = utils.ReadString(qs, "sort", "name")
+	filters.Name = utils.ReadString(qs, "name", "")
+
+	return filters
+}
+
+func (pf *PeopleFilters) ValidatePeopleFilters(v *validator.Validator, f PeopleFilters) {
+	ValidatePageFilters(v, f.PageFilters)
+}
+
+func (qb *QueryBuilder) BuildPeopleQuery(filters PeopleFilters) (string, []any) {
+	if filters.Name != "" {
+		qb.argCount++
+		qb.conditions = append(qb.conditions,
+			fmt.Sprintf("to_tsvector('simple', p.name) @@ plainto_tsquery('simple', $%d)", qb.argCount))
+		qb.args = append(qb.args, filters.Name)
+	}
+
+	columnMap := map[string]string{
+		"id":   "p.id",
+		"name": "p.name",
+	}
+
+	actualColumn, exists := columnMap[filters.SortColumn()]
+	if !exists {
+		actualColumn = "p.id"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), p.id, p.created_at, p.name, COALESCE(p.birth_year, 0), p.biography, p.version
+		FROM people p
+		%s
+		ORDER BY %s %s, p.id ASC
+		%s`,
+		whereClause(qb.conditions),
+		actualColumn,
+		filters.sortDirection(),
+		qb.limitClause(filters.PageFilters),
+	)
+
+	return query, qb.args
+}
+
+// AddCreditFilter keeps the movies that credit the given person in the given
+// role. The person is matched by id or, case-insensitively, by full name.
+func (qb *QueryBuilder) AddCreditFilter(role, person string) *QueryBuilder {
+	qb.argCount++
+	roleArg := qb.argCount
+	qb.argCount++
+	personArg := qb.argCount
+
+	qb.conditions = append(qb.conditions, fmt.Sprintf(`
+		m.id IN (
+			SELECT c.movie_id FROM movie_credits c
+			JOIN people p ON p.id = c.person_id
+			WHERE c.role = $%d AND (p.id::text = $%d OR lower(p.name) = lower($%d))
+		)`, roleArg, personArg, personArg))
+
+	qb.args = append(qb.args, role, person)
+	return qb
+}
@@ -0,0 +1,31 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMovieQueryCredits(t *testing.T) {
+	query, args := NewMovieQueryBuilder().
+		WithActor("Corinne Marchand").
+		WithDirector("42").
+		Build(NewMovieFilters())
+
+	assert.Contains(t, query, "WHERE c.role = $1 AND (p.id::text = $2 OR lower(p.name) = lower($2))")
+	assert.Contains(t, query, "WHERE c.role = $3 AND (p.id::text = $4 OR lower(p.name) = lower($4))")
+	assert.Equal(t, []any{"cast", "Corinne Marchand", "director", "42", 20, 0}, args)
+}
+
+func TestBuildPeopleQuery(t *testing.T) {
+	pf := NewPeopleFilters()
+	pf.Name = "varda"
+	pf.Sort = "-name"
+
+	query, args := NewQueryBuilder().BuildPeopleQuery(pf)
+
+	assert.Contains(t, query, "WHERE to_tsvector('simple', p.name) @@ plainto_tsquery('simple', $1)")
+	assert.Contains(t, query, "ORDER BY p.name DESC, p.id ASC")
+	assert.Contains(t, query, "LIMIT $2 OFFSET $3")
+	assert.Equal(t, []any{"varda", 20, 0}, args)
+}
@@ -5,7 +5,6 @@ import (
 	"cinemesis/internal/validator"
 	"fmt"
 	"net/url"
-	"strings"
 )
 
 const (
@@ -19,8 +18,32 @@ const (
 	SortOrderDesc = "desc"
 )
 
+// ReviewFields are the review fields clients can pick with the fields parameter.
+var ReviewFields = []string{
+	"id", "user_id", "movie_id", "text", "rating", "created_at", "upvotes",
+	"downvotes", "edited", "user_name", "total_votes", "user_vote",
+}
+
+// reviewColumns are the review columns listings select, in the order they are
+// scanned. user_vote reads from the join on the current user's votes.
+var reviewColumns = []Column{
+	{"id", "r.id"},
+	{"user_id", "r.user_id"},
+	{"movie_id", "r.movie_id"},
+	{"text", "r.text"},
+	{"rating", "r.rating"},
+	{"created_at", "r.created_at"},
+	{"upvotes", "r.upvotes"},
+	{"downvotes", "r.downvotes"},
+	{"edited", "r.edited"},
+	{"user_name", "u.name AS user_name"},
+	{"total_votes", "(r.upvotes + r.downvotes) AS total_votes"},
+	{"user_vote", "COALESCE(rv.vote_type, 0) AS user_vote"},
+}
+
 type ReviewFilters struct {
 	PageFilters
+	Fieldset
 	UserID  int64 `json:"user_id,omitempty"`
 	MovieID int64 `json:"movie_id,omitempty"`
 
@@ -45,12 +68,12 @@ func (qb *QueryBuilder) BuildReviewQuery(filters ReviewFilters, currentUserID in
 	qb.addMovieFilter(filters.MovieID)
 	qb.addUserFilter(filters.UserID)
 
-	var whereClause string
-	if len(qb.conditions) > 0 {
-		whereClause = "WHERE " + strings.Join(qb.conditions, " AND ")
-	}
+	filterWhere := whereClause(qb.conditions)
 
-	sortClause := filters.GetSortClause()
+	orderBy := filters.GetSortClause() + ", r.id ASC"
+	if filters.CursorMode {
+		orderBy = qb.addKeysetCondition(filters.PageFilters, filters.sortColumn(), filters.sortCast(), "r.id", filters.sortDirection())
+	}
 
 	var joinUserVote string
 	if currentUserID > 0 {
@@ -63,34 +86,22 @@ func (qb *QueryBuilder) BuildReviewQuery(filters ReviewFilters, currentUserID in
 	}
 
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER() AS total_count,
-		       r.id,
-		       r.user_id,
-		       r.movie_id,
-		       r.text,
-		       r.rating,
-		       r.created_at,
-		       r.upvotes,
-		       r.downvotes,
-		       r.edited,
-		       u.name AS user_name,
-		       (r.upvotes + r.downvotes) AS total_votes,
-		       COALESCE(rv.vote_type, 0) AS user_vote
+		SELECT %s AS total_count, %s
 		FROM reviews r
 		JOIN users u ON r.user_id = u.id
 		%s
 		%s
-		ORDER BY %s, r.id ASC
-		LIMIT $%d OFFSET $%d`,
+		ORDER BY %s
+		%s`,
+		filters.totalExpr("reviews r", filterWhere),
+		selectList(filters.columns(reviewColumns, "id", filters.sortField())),
 		joinUserVote,
-		whereClause,
-		sortClause,
-		qb.argCount+1,
-		qb.argCount+2,
+		whereClause(qb.conditions),
+		orderBy,
+		qb.limitClause(filters.PageFilters),
 	)
 
-	args := append(qb.args, filters.limit(), filters.offset())
-	return query, args
+	return query, qb.args
 }
 
 func (qb *QueryBuilder) addMovieFilter(movieID int64) {
@@ -120,6 +131,9 @@ func NewReviewFilters() ReviewFilters {
 				SortByUpvotes,
 			},
 		},
+		Fieldset: Fieldset{
+			FieldSafelist: ReviewFields,
+		},
 		SortBy:    SortByDate,
 		SortOrder: SortOrderAsc,
 	}
@@ -149,39 +163,78 @@ func ParseReviewFiltersFromQuery(qs url.Values, v *validator.Validator) ReviewFi
 		filters.SortOrder = SortOrderAsc
 	}
 
+	filters.readCursor(qs, v)
+	filters.readFieldset(qs)
+
 	return filters
 }
 
 func (rf *ReviewFilters) ValidateReviewFilters(v *validator.Validator, f ReviewFilters) {
 	ValidatePageFilters(v, f.PageFilters)
+	ValidateFieldset(v, f.Fieldset)
 
 	validSortBy := []string{SortByDate, SortByRating, SortByUpvotes}
-	v.Check(validator.PermittedValue(f.SortBy, validSortBy...), "sort_by", "invalid sort type")
+	v.Check(validator.PermittedValue(f.SortBy, validSortBy...), "sort_by", validator.CodeNotAllowed, "invalid sort type")
 
 	validSortOrder := []string{SortOrderAsc, SortOrderDesc}
-	v.Check(validator.PermittedValue(f.SortOrder, validSortOrder...), "sort_order", "must be 'asc' or 'desc'")
+	v.Check(validator.PermittedValue(f.SortOrder, validSortOrder...), "sort_order", validator.CodeNotAllowed, "must be 'asc' or 'desc'")
+}
+
+// CursorSort identifies the ordering cursors for this listing are issued for.
+func (rf ReviewFilters) CursorSort() string {
+	return rf.SortBy + ":" + rf.SortOrder
+}
+
+func (rf *ReviewFilters) DecodeCursor(codec *CursorCodec, v *validator.Validator) {
+	rf.decodeCursor(codec, rf.CursorSort(), v)
 }
 
 func (rf ReviewFilters) GetSortClause() string {
-	var sortColumn string
+	return fmt.Sprintf("%s %s", rf.sortColumn(), rf.sortDirection())
+}
 
+func (rf ReviewFilters) sortColumn() string {
 	switch rf.SortBy {
-	case SortByDate:
-		sortColumn = "r.created_at"
 	case SortByRating:
-		sortColumn = "r.rating"
+		return "r.rating"
 	case SortByUpvotes:
-		sortColumn = "r.upvotes"
+		return "r.upvotes"
 	default:
-		sortColumn = "r.created_at"
+		return "r.created_at"
 	}
+}
 
-	direction := "ASC"
-	if rf.SortOrder == SortOrderDesc {
-		direction = "DESC"
+// Columns returns the fields the review query selects, in order, for scanning.
+// The id and the sort column are always among them.
+func (rf ReviewFilters) Columns() []string {
+	return fieldNames(rf.columns(reviewColumns, "id", rf.sortField()))
+}
+
+// sortField returns the review field the listing is sorted by.
+func (rf ReviewFilters) sortField() string {
+	switch rf.SortBy {
+	case SortByRating, SortByUpvotes:
+		return rf.SortBy
+	default:
+		return "created_at"
 	}
+}
 
-	return fmt.Sprintf("%s %s", sortColumn, direction)
+// sortCast returns the column type cursor keys are cast to.
+func (rf ReviewFilters) sortCast() string {
+	switch rf.SortBy {
+	case SortByRating, SortByUpvotes:
+		return "integer"
+	default:
+		return "timestamptz"
+	}
+}
+
+func (rf ReviewFilters) sortDirection() string {
+	if rf.SortOrder == SortOrderDesc {
+		return "DESC"
+	}
+	return "ASC"
 }
 
 func (rf ReviewFilters) ToggleSortOrder() ReviewFilters {
@@ -0,0 +1,168 @@
+package mailer
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	ht "html/template"
+	tt "text/template"
+)
+
+// DefaultLocale is the last resort of every fallback chain, so every template
+// must exist in it.
+const DefaultLocale = "en"
+
+// templateBlocks must be defined by every template in every locale.
+var templateBlocks = []string{"subject", "plainBody", "htmlBody"}
+
+// Locales lists the locales templates are provided in, one directory each
+// under templates/.
+func Locales() []string {
+	entries, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	var locales []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			locales = append(locales, entry.Name())
+		}
+	}
+	return locales
+}
+
+// NormalizeLocale lowercases a language tag and uses hyphens as separators,
+// the form locale directories are named in: "pt_BR" becomes "pt-br".
+func NormalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// localePrefixes returns locale and each shorter prefix of it, most specific
+// first: "pt-br" gives "pt-br", "pt".
+func localePrefixes(locale string) []string {
+	var prefixes []string
+	for locale = NormalizeLocale(locale); locale != ""; {
+		prefixes = append(prefixes, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return prefixes
+}
+
+// localeChain is the order templates are looked up in for a locale: its
+// prefixes, then DefaultLocale.
+func localeChain(locale string) []string {
+	chain := localePrefixes(locale)
+	if !slices.Contains(chain, DefaultLocale) {
+		chain = append(chain, DefaultLocale)
+	}
+	return chain
+}
+
+// MatchLocale picks the locale to send a user's mail in from an
+// Accept-Language header: the highest weighted language that templates exist
+// for, or DefaultLocale.
+func MatchLocale(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var prefs []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = NormalizeLocale(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+
+		prefs = append(prefs, weighted{tag: tag, q: q})
+	}
+
+	slices.SortStableFunc(prefs, func(a, b weighted) int { return cmp.Compare(b.q, a.q) })
+
+	locales := Locales()
+	for _, pref := range prefs {
+		for _, locale := range localePrefixes(pref.tag) {
+			if slices.Contains(locales, locale) {
+				return locale
+			}
+		}
+	}
+
+	return DefaultLocale
+}
+
+// templatePath finds templateFile for locale, following its fallback chain.
+func templatePath(locale, templateFile string) (string, error) {
+	for _, l := range localeChain(locale) {
+		p := path.Join("templates", l, templateFile)
+		if _, err := fs.Stat(templateFS, p); err == nil {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("template %q not found for locale %q", templateFile, locale)
+}
+
+// CheckTemplates reports every template that is missing from a locale, fails to
+// parse, or doesn't define all of subject, plainBody and htmlBody. Templates
+// found in DefaultLocale are expected in every locale.
+func CheckTemplates() error {
+	files, err := fs.Glob(templateFS, path.Join("templates", DefaultLocale, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, locale := range Locales() {
+		for _, file := range files {
+			p := path.Join("templates", locale, path.Base(file))
+			if _, err := fs.Stat(templateFS, p); err != nil {
+				errs = append(errs, fmt.Errorf("%s: missing", p))
+				continue
+			}
+
+			textTmpl, err := tt.New("").ParseFS(templateFS, p)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			htmlTmpl, err := ht.New("").ParseFS(templateFS, p)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			for _, block := range templateBlocks {
+				if textTmpl.Lookup(block) == nil || htmlTmpl.Lookup(block) == nil {
+					errs = append(errs, fmt.Errorf("%s: no %q block", p, block))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
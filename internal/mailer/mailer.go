@@ -3,10 +3,11 @@ package mailer
 import (
 	"bytes"
 	"embed"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
-	"github.com/wneessen/go-mail"
-
 	ht "html/template"
 	tt "text/template"
 )
@@ -14,83 +15,116 @@ import (
 //go:embed "templates"
 var templateFS embed.FS
 
+// ErrTemplate wraps errors rendering a message. Retrying such a message won't
+// help, unlike a refused or timed out delivery.
+var ErrTemplate = errors.New("mailer: template error")
+
+// Message is a rendered email, handed to a Transport for delivery.
+type Message struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Subject   string    `json:"subject"`
+	PlainBody string    `json:"plain_body"`
+	HTMLBody  string    `json:"html_body"`
+	Date      time.Time `json:"date"`
+}
+
+// Transport delivers rendered messages. See SMTPTransport, FileTransport and
+// MemoryTransport.
+type Transport interface {
+	Send(msg *Message) error
+}
+
 type Mailer struct {
-	client *mail.Client
-	sender string
+	transport Transport
+	sender    string
+
+	sent   atomic.Int64
+	failed atomic.Int64
 }
 
-func New(host string, port int, username, password, sender string) (*Mailer, error) {
-	// Initialize a new mail.Dialer instance with the given SMTP server settings.
-	client, err := mail.NewClient(
-		host,
-		mail.WithSMTPAuth(mail.SMTPAuthLogin),
-		mail.WithPort(port),
-		mail.WithUsername(username),
-		mail.WithPassword(password),
-		mail.WithTimeout(5*time.Second),
-	)
-	if err != nil {
-		return nil, err
-	}
+// Stats counts the messages delivered and those that could not be, whether
+// they failed to render or were refused.
+type Stats struct {
+	Sent   int64
+	Failed int64
+}
 
-	mailer := &Mailer{
-		client: client,
-		sender: sender,
+func New(transport Transport, sender string) *Mailer {
+	return &Mailer{
+		transport: transport,
+		sender:    sender,
 	}
-	return mailer, nil
 }
 
-func (m *Mailer) Send(recipient string, templateFile string, data any) error {
-	textTmpl, err := tt.New("").ParseFS(templateFS, "templates/"+templateFile)
+// Send renders templateFile in locale, or the nearest locale it exists in, with
+// data and makes a single delivery attempt. Retrying is left to the caller.
+func (m *Mailer) Send(recipient, locale, templateFile string, data any) error {
+	err := m.send(recipient, locale, templateFile, data)
 	if err != nil {
+		m.failed.Add(1)
 		return err
 	}
+	m.sent.Add(1)
+	return nil
+}
 
-	subject := new(bytes.Buffer)
-	err = textTmpl.ExecuteTemplate(subject, "subject", data)
+func (m *Mailer) send(recipient, locale, templateFile string, data any) error {
+	subject, plainBody, htmlBody, err := render(locale, templateFile, data)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrTemplate, err)
+	}
+
+	return m.transport.Send(&Message{
+		From:      m.sender,
+		To:        recipient,
+		Subject:   subject,
+		PlainBody: plainBody,
+		HTMLBody:  htmlBody,
+		Date:      time.Now(),
+	})
+}
+
+func render(locale, templateFile string, data any) (subject, plainBody, htmlBody string, err error) {
+	p, err := templatePath(locale, templateFile)
+	if err != nil {
+		return "", "", "", err
 	}
 
-	plainBody := new(bytes.Buffer)
-	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	textTmpl, err := tt.New("").ParseFS(templateFS, p)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
 
-	htmlTmpl, err := ht.New("").ParseFS(templateFS, "templates/"+templateFile)
+	subjectBuf := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(subjectBuf, "subject", data)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
 
-	htmlBody := new(bytes.Buffer)
-	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	plainBuf := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(plainBuf, "plainBody", data)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
 
-	msg := mail.NewMsg()
-	err = msg.To(recipient)
+	htmlTmpl, err := ht.New("").ParseFS(templateFS, p)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
-	err = msg.From(m.sender)
+
+	htmlBuf := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBuf, "htmlBody", data)
 	if err != nil {
-		return err
+		return "", "", "", err
 	}
-	msg.Subject(subject.String())
-	msg.SetBodyString(mail.TypeTextPlain, plainBody.String())
-	msg.AddAlternativeString(mail.TypeTextHTML, htmlBody.String())
-
-	for i := 1; i <= 3; i++ {
-		err = m.client.DialAndSend(msg)
-		if err == nil {
-			return nil
-		}
-		// If it didn't work, sleep for a short time and retry.
-		if i != 3 {
-			time.Sleep(500 * time.Millisecond)
-		}
+
+	return subjectBuf.String(), plainBuf.String(), htmlBuf.String(), nil
+}
+
+func (m *Mailer) Stats() Stats {
+	return Stats{
+		Sent:   m.sent.Load(),
+		Failed: m.failed.Load(),
 	}
-	return err
 }
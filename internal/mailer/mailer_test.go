@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailer_SendCapturesRenderedMessage(t *testing.T) {
+	transport := NewMemoryTransport(10)
+	m := New(transport, "Cinemesis <no-reply@cinemesis.test>")
+
+	err := m.Send("alice@example.com", "en", "token_activation.tmpl", map[string]any{"activationToken": "TOKEN"})
+	require.NoError(t, err)
+
+	messages := transport.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "alice@example.com", messages[0].To)
+	assert.Equal(t, "Activate your Cinemesis account", messages[0].Subject)
+	assert.Contains(t, messages[0].PlainBody, "TOKEN")
+	assert.Contains(t, messages[0].HTMLBody, "TOKEN")
+	assert.Equal(t, Stats{Sent: 1}, m.Stats())
+}
+
+func TestMailer_SendUnknownTemplate(t *testing.T) {
+	transport := NewMemoryTransport(10)
+	m := New(transport, "no-reply@cinemesis.test")
+
+	err := m.Send("alice@example.com", "en", "missing.tmpl", nil)
+	assert.ErrorIs(t, err, ErrTemplate)
+	assert.Empty(t, transport.Messages())
+	assert.Equal(t, Stats{Failed: 1}, m.Stats())
+}
+
+func TestMailer_SendFallsBackThroughLocales(t *testing.T) {
+	tests := []struct {
+		locale  string
+		subject string
+	}{
+		{"ru", "Активируйте аккаунт Cinemesis"},
+		{"ru-RU", "Активируйте аккаунт Cinemesis"},
+		{"de", "Activate your Cinemesis account"},
+		{"", "Activate your Cinemesis account"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			transport := NewMemoryTransport(1)
+			m := New(transport, "no-reply@cinemesis.test")
+
+			err := m.Send("alice@example.com", tt.locale, "token_activation.tmpl", map[string]any{"activationToken": "TOKEN"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.subject, transport.Messages()[0].Subject)
+		})
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", DefaultLocale},
+		{"ru", "ru"},
+		{"ru-RU,ru;q=0.9,en;q=0.8", "ru"},
+		{"en-US,en;q=0.9,ru;q=0.8", "en"},
+		{"de-DE,de;q=0.9,ru;q=0.5", "ru"},
+		{"en;q=0.2, ru;q=0.7", "ru"},
+		{"ru;q=0, *", DefaultLocale},
+		{"fr", DefaultLocale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchLocale(tt.acceptLanguage))
+		})
+	}
+}
+
+// Every locale must translate every template, with all the blocks Send
+// renders.
+func TestCheckTemplates(t *testing.T) {
+	assert.Contains(t, Locales(), DefaultLocale)
+	assert.NoError(t, CheckTemplates())
+}
+
+func TestMemoryTransport_DropsOldest(t *testing.T) {
+	transport := NewMemoryTransport(2)
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		require.NoError(t, transport.Send(&Message{To: to}))
+	}
+
+	messages := transport.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "b@example.com", messages[0].To)
+	assert.Equal(t, "c@example.com", messages[1].To)
+}
+
+func TestFileTransport_WritesToMaildir(t *testing.T) {
+	dir := t.TempDir()
+	transport, err := NewFileTransport(dir)
+	require.NoError(t, err)
+
+	err = transport.Send(&Message{
+		From:      "no-reply@cinemesis.test",
+		To:        "alice@example.com",
+		Subject:   "Hello",
+		PlainBody: "plain",
+		HTMLBody:  "<p>html</p>",
+		Date:      time.Now(),
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	tmp, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp)
+
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(b), "Subject: Hello"))
+	assert.True(t, strings.Contains(string(b), "alice@example.com"))
+}
@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+// SMTPTransport delivers messages through an SMTP server.
+type SMTPTransport struct {
+	client *mail.Client
+}
+
+func NewSMTPTransport(host string, port int, username, password string) (*SMTPTransport, error) {
+	client, err := mail.NewClient(
+		host,
+		mail.WithSMTPAuth(mail.SMTPAuthLogin),
+		mail.WithPort(port),
+		mail.WithUsername(username),
+		mail.WithPassword(password),
+		mail.WithTimeout(5*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMTPTransport{client: client}, nil
+}
+
+func (t *SMTPTransport) Send(msg *Message) error {
+	m, err := msg.mime()
+	if err != nil {
+		return err
+	}
+	return t.client.DialAndSend(m)
+}
+
+// FileTransport writes each message as an .eml file into the new/ directory of
+// a maildir, so it can be opened with a mail client instead of being sent.
+type FileTransport struct {
+	dir string
+	seq atomic.Int64
+}
+
+// NewFileTransport creates the maildir layout under dir if it doesn't exist.
+func NewFileTransport(dir string) (*FileTransport, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Send(msg *Message) error {
+	m, err := msg.mime()
+	if err != nil {
+		return err
+	}
+
+	// Messages are written to tmp/ and moved into new/ once complete, as the
+	// maildir format requires, so readers never see a partial file.
+	name := fmt.Sprintf("%d.%d_%d.eml", msg.Date.UnixNano(), os.Getpid(), t.seq.Add(1))
+	tmp := filepath.Join(t.dir, "tmp", name)
+
+	err = m.WriteToFile(tmp)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(t.dir, "new", name))
+}
+
+// MemoryTransport keeps the most recent messages in memory instead of sending
+// them, for development and tests.
+type MemoryTransport struct {
+	limit int
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryTransport keeps up to limit messages, dropping the oldest first.
+func NewMemoryTransport(limit int) *MemoryTransport {
+	return &MemoryTransport{limit: limit}
+}
+
+func (t *MemoryTransport) Send(msg *Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, *msg)
+	if len(t.messages) > t.limit {
+		t.messages = slices.Delete(t.messages, 0, len(t.messages)-t.limit)
+	}
+
+	return nil
+}
+
+// Messages returns the captured messages, oldest first.
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return slices.Clone(t.messages)
+}
+
+func (msg *Message) mime() (*mail.Msg, error) {
+	m := mail.NewMsg()
+
+	err := m.To(msg.To)
+	if err != nil {
+		return nil, err
+	}
+	err = m.From(msg.From)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Subject(msg.Subject)
+	m.SetDateWithValue(msg.Date)
+	m.SetBodyString(mail.TypeTextPlain, msg.PlainBody)
+	m.AddAlternativeString(mail.TypeTextHTML, msg.HTMLBody)
+
+	return m, nil
+}
@@ -0,0 +1,381 @@
+// Package metrics implements the small subset of Prometheus instrumentation the
+// API needs: counters, gauges and histograms, optionally partitioned by labels,
+// rendered in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are latency histogram bounds in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metric families by name. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	name       string
+	help       string
+	typ        string
+	collectors []collector
+}
+
+// A collector reports its samples through emit. suffix is appended to the
+// family name, for the _bucket, _sum and _count series of histograms.
+type collector interface {
+	collect(emit func(suffix, labels string, value float64))
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// register adds c to the family of the given name. A family may be registered
+// more than once, for func metrics with different constant labels, but always
+// with the same type.
+func (r *Registry) register(name, help, typ string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		r.families[name] = f
+	} else if f.typ != typ {
+		panic(fmt.Sprintf("metrics: %s registered as both %s and %s", name, f.typ, typ))
+	}
+
+	f.collectors = append(f.collectors, c)
+}
+
+// Write renders every metric in the text exposition format, families sorted by
+// name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(families, func(a, b *family) int { return strings.Compare(a.name, b.name) })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+
+		for _, c := range f.collectors {
+			c.collect(func(suffix, labels string, value float64) {
+				bw.WriteString(f.name)
+				bw.WriteString(suffix)
+				if labels != "" {
+					bw.WriteString("{" + labels + "}")
+				}
+				bw.WriteString(" " + formatValue(value) + "\n")
+			})
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Handler serves the registry to a Prometheus scraper.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	labels string
+	value  atomic.Int64
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, "counter", c)
+	return c
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) collect(emit func(suffix, labels string, value float64)) {
+	emit("", c.labels, float64(c.value.Load()))
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	labels string
+	value  atomic.Int64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, "gauge", g)
+	return g
+}
+
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+func (g *Gauge) Set(n int64) {
+	g.value.Store(n)
+}
+
+func (g *Gauge) collect(emit func(suffix, labels string, value float64)) {
+	emit("", g.labels, float64(g.value.Load()))
+}
+
+// funcMetric reads its value at scrape time, for values that are already
+// tracked elsewhere such as sql.DBStats.
+type funcMetric struct {
+	labels string
+	fn     func() float64
+}
+
+func (f *funcMetric) collect(emit func(suffix, labels string, value float64)) {
+	emit("", f.labels, f.fn())
+}
+
+// NewGaugeFunc registers a gauge whose value is fn(). labelPairs are constant
+// label names and values, alternating; registering the same name again with
+// other label values adds a series to the family.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64, labelPairs ...string) {
+	r.register(name, help, "gauge", &funcMetric{labels: pairLabels(labelPairs), fn: fn})
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only ever increase.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64, labelPairs ...string) {
+	r.register(name, help, "counter", &funcMetric{labels: pairLabels(labelPairs), fn: fn})
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	labels string
+	upper  []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(labels string, buckets []float64) *Histogram {
+	return &Histogram{
+		labels: labels,
+		upper:  buckets,
+		counts: make([]uint64, len(buckets)),
+	}
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram("", checkBuckets(buckets))
+	r.register(name, help, "histogram", h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.upper, v)
+
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+func (h *Histogram) collect(emit func(suffix, labels string, value float64)) {
+	h.mu.Lock()
+	counts := slices.Clone(h.counts)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, upper := range h.upper {
+		cumulative += counts[i]
+		emit("_bucket", joinLabels(h.labels, `le="`+formatValue(upper)+`"`), float64(cumulative))
+	}
+	emit("_bucket", joinLabels(h.labels, `le="+Inf"`), float64(count))
+	emit("_sum", h.labels, sum)
+	emit("_count", h.labels, float64(count))
+}
+
+// vec partitions a metric by label values, creating a child per distinct set.
+type vec[T collector] struct {
+	names    []string
+	newChild func(labels string) T
+
+	mu       sync.RWMutex
+	children map[string]T
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.names) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.names)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+
+	labels := make([]string, len(values))
+	for i, value := range values {
+		labels[i] = v.names[i] + `="` + escapeLabel(value) + `"`
+	}
+
+	child = v.newChild(strings.Join(labels, ","))
+	v.children[key] = child
+	return child
+}
+
+func (v *vec[T]) collect(emit func(suffix, labels string, value float64)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	children := make([]T, len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+	}
+	v.mu.RUnlock()
+
+	for _, child := range children {
+		child.collect(emit)
+	}
+}
+
+type CounterVec struct {
+	vec[*Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{vec[*Counter]{
+		names:    labelNames,
+		newChild: func(labels string) *Counter { return &Counter{labels: labels} },
+		children: make(map[string]*Counter),
+	}}
+	r.register(name, help, "counter", c)
+	return c
+}
+
+// With returns the counter for the given label values, in the order the label
+// names were registered.
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.with(labelValues)
+}
+
+type HistogramVec struct {
+	vec[*Histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	buckets = checkBuckets(buckets)
+	h := &HistogramVec{vec[*Histogram]{
+		names:    labelNames,
+		newChild: func(labels string) *Histogram { return newHistogram(labels, buckets) },
+		children: make(map[string]*Histogram),
+	}}
+	r.register(name, help, "histogram", h)
+	return h
+}
+
+// With returns the histogram for the given label values, in the order the
+// label names were registered.
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues)
+}
+
+func checkBuckets(buckets []float64) []float64 {
+	if !slices.IsSorted(buckets) {
+		panic("metrics: histogram buckets must be sorted")
+	}
+	return slices.Clone(buckets)
+}
+
+func pairLabels(pairs []string) string {
+	if len(pairs)%2 != 0 {
+		panic("metrics: label pairs must come as name, value")
+	}
+
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		labels = append(labels, pairs[i]+`="`+escapeLabel(pairs[i+1])+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
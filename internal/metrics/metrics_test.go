@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+
+	var b strings.Builder
+	require.NoError(t, r.Write(&b))
+	return b.String()
+}
+
+func TestRegistry_CounterVec(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("http_requests_total", "Requests served.", "route", "status")
+
+	requests.With("/v1/movies", "200").Inc()
+	requests.With("/v1/movies", "200").Add(2)
+	requests.With(`/v1/"odd"`, "404").Inc()
+
+	assert.Equal(t, `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{route="/v1/\"odd\"",status="404"} 1
+http_requests_total{route="/v1/movies",status="200"} 3
+`, render(t, r))
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "method")
+
+	h.With("GET").Observe(0.05)
+	h.With("GET").Observe(0.1)
+	h.With("GET").Observe(3)
+
+	assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="GET",le="0.1"} 2
+latency_seconds_bucket{method="GET",le="1"} 2
+latency_seconds_bucket{method="GET",le="+Inf"} 3
+latency_seconds_sum{method="GET"} 3.15
+latency_seconds_count{method="GET"} 3
+`, render(t, r))
+}
+
+func TestRegistry_FuncsAndGauges(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterFunc("mailer_sends_total", "Emails sent.", func() float64 { return 4 }, "result", "success")
+	r.NewCounterFunc("mailer_sends_total", "Emails sent.", func() float64 { return 1 }, "result", "failure")
+	g := r.NewGauge("background_tasks_running", "Tasks running.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	assert.Equal(t, `# HELP background_tasks_running Tasks running.
+# TYPE background_tasks_running gauge
+background_tasks_running 1
+# HELP mailer_sends_total Emails sent.
+# TYPE mailer_sends_total counter
+mailer_sends_total{result="success"} 4
+mailer_sends_total{result="failure"} 1
+`, render(t, r))
+}
+
+func TestRegistry_TypeMismatchPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("things", "Things.")
+
+	assert.Panics(t, func() { r.NewGauge("things", "Things.") })
+}
+
+func TestCounterVec_WrongLabelCountPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("things_total", "Things.", "kind")
+
+	assert.Panics(t, func() { c.With("a", "b") })
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Rate per second. A Limit
+// with no Rate doesn't limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of asking for a request to be allowed, with what the
+// client needs to know to pace itself.
+type Result struct {
+	Allowed bool
+	// Limit is the most requests that can be made at once.
+	Limit int
+	// Remaining is how many more requests can be made right now.
+	Remaining int
+	// Reset is how long until Remaining is back up to Limit.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, zero if it
+	// was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of every limited key. Memory keeps it in the process;
+// a store shared between instances can take its place to limit them as one.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	// Peek reports whether Allow would allow a request, without counting one.
+	Peek(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// sweepInterval is how often Memory forgets the keys it no longer needs.
+const sweepInterval = time.Minute
+
+// Memory is a token bucket Store held in memory. It is safe for concurrent use.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	return m.take(key, limit, true), nil
+}
+
+func (m *Memory) Peek(_ context.Context, key string, limit Limit) (Result, error) {
+	return m.take(key, limit, false), nil
+}
+
+// take refills the key's bucket and, if consume is set, takes a request from
+// it when there is one to take.
+func (m *Memory) take(key string, limit Limit, consume bool) Result {
+	if limit.Rate <= 0 {
+		return Result{Allowed: true, Limit: limit.Burst, Remaining: limit.Burst}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	burst := float64(limit.Burst)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	res := Result{Limit: limit.Burst}
+
+	if b.tokens >= 1 {
+		if consume {
+			b.tokens--
+		}
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.full = now.Add(res.Reset)
+
+	return res
+}
+
+// Len returns the number of keys being tracked.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.buckets)
+}
+
+// sweep drops buckets that have filled up again, since a missing bucket
+// starts out full anyway. It only does the work once per sweepInterval.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
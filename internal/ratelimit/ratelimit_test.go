@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock returns a Memory whose time only moves when the returned function
+// is called.
+func fakeClock() (*Memory, func(time.Duration)) {
+	m := NewMemory()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.lastSweep = now
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemory_Allow(t *testing.T) {
+	m, advance := fakeClock()
+	limit := Limit{Rate: 1, Burst: 2}
+
+	res, err := m.Allow(context.Background(), "a", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Limit)
+	assert.Equal(t, 1, res.Remaining)
+	assert.Equal(t, time.Second, res.Reset)
+
+	res, _ = m.Allow(context.Background(), "a", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 2*time.Second, res.Reset)
+
+	res, _ = m.Allow(context.Background(), "a", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	advance(500 * time.Millisecond)
+	res, _ = m.Allow(context.Background(), "a", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	advance(500 * time.Millisecond)
+	res, _ = m.Allow(context.Background(), "a", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, time.Duration(0), res.RetryAfter)
+}
+
+func TestMemory_Peek(t *testing.T) {
+	m, _ := fakeClock()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	res, err := m.Peek(context.Background(), "a", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, _ = m.Allow(context.Background(), "a", limit)
+	assert.True(t, res.Allowed)
+
+	res, _ = m.Peek(context.Background(), "a", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+}
+
+func TestMemory_KeysAreIndependent(t *testing.T) {
+	m, _ := fakeClock()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	res, _ := m.Allow(context.Background(), "a", limit)
+	assert.True(t, res.Allowed)
+	res, _ = m.Allow(context.Background(), "a", limit)
+	assert.False(t, res.Allowed)
+
+	res, _ = m.Allow(context.Background(), "b", limit)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemory_NoRate(t *testing.T) {
+	m, _ := fakeClock()
+
+	for range 10 {
+		res, _ := m.Allow(context.Background(), "a", Limit{Burst: 3})
+		assert.True(t, res.Allowed)
+	}
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestMemory_SweepsFullBuckets(t *testing.T) {
+	m, advance := fakeClock()
+
+	m.Allow(context.Background(), "slow", Limit{Rate: 0.001, Burst: 1})
+	m.Allow(context.Background(), "fast", Limit{Rate: 10, Burst: 1})
+	assert.Equal(t, 2, m.Len())
+
+	advance(sweepInterval)
+	m.Allow(context.Background(), "other", Limit{Rate: 10, Burst: 1})
+	assert.Equal(t, 2, m.Len())
+}
@@ -0,0 +1,50 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+)
+
+// Header is the HTTP header a request ID is accepted from and echoed in.
+const Header = "X-Request-ID"
+
+// maxLength keeps IDs supplied by clients from bloating every log line.
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a random request ID.
+func New() string {
+	return rand.Text()
+}
+
+// Valid reports whether id, supplied by a client, is safe to log and echo
+// back: non-empty, not too long, and made only of letters, digits and -_.:
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or an empty string if it
+// has none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,26 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid(New()))
+	assert.True(t, Valid("req-42_a.b:c"))
+
+	assert.False(t, Valid(""))
+	assert.False(t, Valid("has space"))
+	assert.False(t, Valid("line\nbreak"))
+	assert.False(t, Valid(strings.Repeat("a", maxLength+1)))
+}
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, "", FromContext(context.Background()))
+
+	ctx := NewContext(context.Background(), "abc")
+	assert.Equal(t, "abc", FromContext(ctx))
+}
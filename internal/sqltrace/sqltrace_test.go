@@ -0,0 +1,109 @@
+package sqltrace
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dsnConnector opens connections to a sqlmock DSN, standing in for a driver's
+// own connector.
+type dsnConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.drv }
+
+func newTracedDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock, *tracetest.SpanRecorder, trace.Tracer) {
+	t.Helper()
+
+	mockDB, mock, err := sqlmock.NewWithDSN(t.Name())
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	db := sql.OpenDB(Connector(dsnConnector{dsn: t.Name(), drv: mockDB.Driver()}, tp, "postgresql"))
+	t.Cleanup(func() {
+		db.Close()
+		mockDB.Close()
+	})
+
+	return db, mock, recorder, tp.Tracer("test")
+}
+
+func TestConnector_TracesWithinSpan(t *testing.T) {
+	db, mock, recorder, tracer := newTracedDB(t)
+
+	mock.ExpectQuery("SELECT title FROM movies").
+		WillReturnRows(sqlmock.NewRows([]string{"title"}).AddRow("Alien"))
+	mock.ExpectExec("UPDATE movies").
+		WillReturnError(errors.New("deadlock detected"))
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+
+	var title string
+	err := db.QueryRowContext(ctx, "SELECT title FROM movies WHERE id = $1", 1).Scan(&title)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, "UPDATE movies SET title = $1", "Aliens")
+	require.Error(t, err)
+
+	parent.End()
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	query, exec := spans[0], spans[1]
+
+	assert.Equal(t, "SELECT", query.Name())
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Contains(t, query.Attributes(), attribute.String("db.system.name", "postgresql"))
+	assert.Contains(t, query.Attributes(), attribute.String("db.query.text", "SELECT title FROM movies WHERE id = $1"))
+	assert.Equal(t, codes.Unset, query.Status().Code)
+
+	assert.Equal(t, "UPDATE", exec.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), exec.Parent().SpanID())
+	assert.Equal(t, codes.Error, exec.Status().Code)
+	assert.Equal(t, "deadlock detected", exec.Status().Description)
+}
+
+func TestConnector_SkipsWithoutSpan(t *testing.T) {
+	db, mock, recorder, _ := newTracedDB(t)
+
+	mock.ExpectExec("DELETE FROM tokens").WillReturnResult(sqlmock.NewResult(0, 3))
+
+	_, err := db.ExecContext(context.Background(), "DELETE FROM tokens WHERE expiry < now()")
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Empty(t, recorder.Ended())
+}
+
+func TestOperation(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM movies":             "SELECT",
+		"\n\t\tinsert INTO movies (title)": "INSERT",
+		"WITH x AS (SELECT 1) SELECT *":    "WITH",
+		"   ":                              "SQL",
+	}
+
+	for query, want := range tests {
+		assert.Equal(t, want, Operation(query), query)
+	}
+}
@@ -0,0 +1,108 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters authenticator apps assume by default: HMAC-SHA1, six digits and a
+// 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is how many periods either side of the current one are accepted,
+	// to allow for clock drift and the time it takes to type a code.
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random 160-bit secret, the size RFC 4226 recommends.
+func NewSecret() []byte {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return secret
+}
+
+// EncodeSecret returns secret in the unpadded base32 form authenticator apps
+// accept when it is typed in.
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// URI returns the otpauth URI authenticator apps import, usually from a QR
+// code.
+func URI(issuer, account string, secret []byte) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Step returns the time step t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for a time step.
+func Code(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range Digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
+
+// IsCode reports whether s has the shape of a code, as opposed to, say, a
+// recovery code.
+func IsCode(s string) bool {
+	if len(s) != Digits {
+		return false
+	}
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// Validate checks code against the steps around t and returns the step it
+// matched. Callers should reject steps that were already used, as a code stays
+// valid for a while.
+func Validate(secret []byte, code string, t time.Time) (int64, bool) {
+	if !IsCode(code) {
+		return 0, false
+	}
+
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
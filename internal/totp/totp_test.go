@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The SHA1 test vectors of RFC 6238 appendix B, truncated to six digits.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode_RFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, Code(rfcSecret, Step(time.Unix(tt.unix, 0))), "T=%d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name   string
+		code   string
+		wantOK bool
+	}{
+		{"current step", Code(rfcSecret, step), true},
+		{"previous step", Code(rfcSecret, step-1), true},
+		{"next step", Code(rfcSecret, step+1), true},
+		{"too old", Code(rfcSecret, step-2), false},
+		{"not digits", "abcdef", false},
+		{"too short", "12345", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Validate(rfcSecret, tt.code, now)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+
+	matched, ok := Validate(rfcSecret, Code(rfcSecret, step-1), now)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, matched)
+}
+
+func TestURI(t *testing.T) {
+	secret := NewSecret()
+	uri := URI("Cinemesis", "alice@example.com", secret)
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Cinemesis:alice@example.com?"))
+	assert.Contains(t, uri, "secret="+EncodeSecret(secret))
+	assert.Contains(t, uri, "issuer=Cinemesis")
+	assert.Contains(t, uri, "digits=6")
+}
@@ -35,13 +35,50 @@ func ReadInt(qs url.Values, key string, defaultValue int, v *validator.Validator
 
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		v.AddError(key, "must be an integer value")
+		v.AddError(key, validator.CodeInvalidType, "must be an integer value")
 		return defaultValue
 	}
 
 	return i
 }
 
+func ReadFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalidType, "must be a number")
+		return defaultValue
+	}
+
+	return f
+}
+
+func ReadBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, validator.CodeInvalidType, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+func GetEnvString(key string, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
+
 func GetEnvInt(key string, fallback int) int {
 	if val := os.Getenv(key); val != "" {
 		if i, err := strconv.Atoi(val); err == nil {
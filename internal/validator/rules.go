@@ -0,0 +1,197 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A Rule is one declarative check of a field, such as Required or MaxLen(500),
+// applied with String, Int or Strings. Each rule has a code and a default
+// message; Message replaces the message where a field needs its own wording.
+type Rule struct {
+	code    string
+	message func(kind) string
+	ok      func(value) bool
+	each    []Rule // checked against each element instead, when ok is nil
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindInt
+	kindList
+)
+
+// value is the field a rule is checking, of one of the kinds.
+type value struct {
+	kind kind
+	s    string
+	n    int64
+	list []string
+}
+
+func (v value) len() int {
+	if v.kind == kindList {
+		return len(v.list)
+	}
+	return len(v.s)
+}
+
+// Message returns the rule with its error message replaced by message.
+func (r Rule) Message(message string) Rule {
+	r.message = func(kind) string { return message }
+	return r
+}
+
+// String checks a string field against rules, adding an error for every rule
+// it breaks.
+func (v *Validator) String(path, s string, rules ...Rule) {
+	v.apply(path, value{kind: kindString, s: s}, rules)
+}
+
+// Int checks an integer field against rules, adding an error for every rule it
+// breaks.
+func (v *Validator) Int(path string, n int64, rules ...Rule) {
+	v.apply(path, value{kind: kindInt, n: n}, rules)
+}
+
+// Strings checks a list of strings against rules, adding an error for every
+// rule it breaks. Rules given to Each are checked against every element, with
+// errors reported at the element's own path, such as genres[2].
+func (v *Validator) Strings(path string, list []string, rules ...Rule) {
+	v.apply(path, value{kind: kindList, list: list}, rules)
+}
+
+func (v *Validator) apply(path string, val value, rules []Rule) {
+	for _, r := range rules {
+		if r.ok == nil {
+			for i, s := range val.list {
+				v.String(Index(path, i), s, r.each...)
+			}
+			continue
+		}
+		if !r.ok(val) {
+			v.AddError(path, r.code, r.message(val.kind))
+		}
+	}
+}
+
+// Required checks that a string is not empty, an integer is not zero and a
+// list is not nil.
+func Required() Rule {
+	return Rule{
+		code:    CodeRequired,
+		message: func(kind) string { return "must be provided" },
+		ok: func(v value) bool {
+			switch v.kind {
+			case kindInt:
+				return v.n != 0
+			case kindList:
+				return v.list != nil
+			default:
+				return v.s != ""
+			}
+		},
+	}
+}
+
+// NotBlank checks that a string has something other than white space.
+func NotBlank() Rule {
+	return Rule{
+		code:    CodeRequired,
+		message: func(kind) string { return "must not be blank" },
+		ok:      func(v value) bool { return strings.TrimSpace(v.s) != "" },
+	}
+}
+
+// MinLen checks that a string is at least n bytes long, or a list has at least
+// n elements.
+func MinLen(n int) Rule {
+	return Rule{
+		code: CodeTooShort,
+		message: func(k kind) string {
+			if k == kindList {
+				return fmt.Sprintf("must contain at least %d values", n)
+			}
+			return fmt.Sprintf("must be at least %d bytes long", n)
+		},
+		ok: func(v value) bool { return v.len() >= n },
+	}
+}
+
+// MaxLen checks that a string is at most n bytes long, or a list has at most n
+// elements.
+func MaxLen(n int) Rule {
+	return Rule{
+		code: CodeTooLong,
+		message: func(k kind) string {
+			if k == kindList {
+				return fmt.Sprintf("must not contain more than %d values", n)
+			}
+			return fmt.Sprintf("must not be more than %d bytes long", n)
+		},
+		ok: func(v value) bool { return v.len() <= n },
+	}
+}
+
+// Min checks that an integer is at least n.
+func Min(n int64) Rule {
+	return Rule{
+		code:    CodeOutOfRange,
+		message: func(kind) string { return fmt.Sprintf("must be at least %d", n) },
+		ok:      func(v value) bool { return v.n >= n },
+	}
+}
+
+// Max checks that an integer is at most n.
+func Max(n int64) Rule {
+	return Rule{
+		code:    CodeOutOfRange,
+		message: func(kind) string { return fmt.Sprintf("must not be more than %d", n) },
+		ok:      func(v value) bool { return v.n <= n },
+	}
+}
+
+// Range checks that an integer is between lo and hi inclusive.
+func Range(lo, hi int64) Rule {
+	return Rule{
+		code:    CodeOutOfRange,
+		message: func(kind) string { return fmt.Sprintf("must be between %d and %d", lo, hi) },
+		ok:      func(v value) bool { return v.n >= lo && v.n <= hi },
+	}
+}
+
+// Regexp checks that a string matches rx.
+func Regexp(rx *regexp.Regexp) Rule {
+	return Rule{
+		code:    CodeInvalidFormat,
+		message: func(kind) string { return "is not in a valid format" },
+		ok:      func(v value) bool { return Matches(v.s, rx) },
+	}
+}
+
+// OneOf checks that a string is one of values.
+func OneOf(values ...string) Rule {
+	return Rule{
+		code:    CodeNotAllowed,
+		message: func(kind) string { return "must be one of " + strings.Join(values, ", ") },
+		ok:      func(v value) bool { return slices.Contains(values, v.s) },
+	}
+}
+
+// UniqueValues checks that a list has no value more than once.
+func UniqueValues() Rule {
+	return Rule{
+		code:    CodeDuplicate,
+		message: func(kind) string { return "must not contain duplicate values" },
+		ok:      func(v value) bool { return Unique(v.list) },
+	}
+}
+
+// Each checks every element of a list against rules.
+func Each(rules ...Rule) Rule {
+	return Rule{each: rules}
+}
@@ -3,20 +3,55 @@ package validator
 import (
 	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 )
 
 var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
-// Define a new Validator type which contains a map of validation errors.
+// Codes name the kind of each validation error, so clients can act on errors
+// without matching the English messages. They are part of the API and must not
+// change.
+const (
+	CodeRequired      = "required"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeOutOfRange    = "out_of_range"
+	CodeInvalidFormat = "invalid_format"
+	CodeInvalidType   = "invalid_type"
+	CodeNotAllowed    = "not_allowed"
+	CodeDuplicate     = "duplicate"
+	CodeAlreadyExists = "already_exists"
+	CodeNotFound      = "not_found"
+	CodeIncorrect     = "incorrect"
+	CodeInvalidState  = "invalid_state"
+	CodeInvalid       = "invalid"
+)
+
+// FieldError is one check a field failed.
+type FieldError struct {
+	Code    string
+	Message string
+}
+
+// Define a new Validator type which contains every validation error of each
+// field, keyed by the field's path. Errors and Codes hold just the first of
+// them, which is what the default error body shows.
 type Validator struct {
 	Errors map[string]string
+	Codes  map[string]string
+	Fields map[string][]FieldError
 }
 
-// New is a helper which creates a new Validator instance with an empty errors map.
+// New is a helper which creates a new Validator instance with empty errors maps.
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{
+		Errors: make(map[string]string),
+		Codes:  make(map[string]string),
+		Fields: make(map[string][]FieldError),
+	}
 }
 
 // Valid returns true if the errors map doesn't contain any entries.
@@ -24,18 +59,25 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// AddError adds an error message to the map (so long as no entry already exists for
-// the given key).
-func (v *Validator) AddError(key, message string) {
+// AddError adds an error message and its code for the field at key. The same
+// error is only kept once.
+func (v *Validator) AddError(key, code, message string) {
+	fe := FieldError{Code: code, Message: message}
+	if slices.Contains(v.Fields[key], fe) {
+		return
+	}
+	v.Fields[key] = append(v.Fields[key], fe)
+
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
+		v.Codes[key] = code
 	}
 }
 
 // Check adds an error message to the map only if a validation check is not 'ok'.
-func (v *Validator) Check(ok bool, key, message string) {
+func (v *Validator) Check(ok bool, key, code, message string) {
 	if !ok {
-		v.AddError(key, message)
+		v.AddError(key, code, message)
 	}
 }
 
@@ -58,3 +100,36 @@ func Unique[T comparable](values []T) bool {
 	}
 	return len(values) == len(uniqueValues)
 }
+
+// Index returns the path of element i of the array at path, such as genres[2].
+func Index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// Key returns the path of member key of the object at path, such as
+// credits[0].role.
+func Key(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Pointer returns the JSON pointer (RFC 6901) for a path made by Index and Key,
+// such as /credits/0/role for credits[0].role.
+func Pointer(path string) string {
+	var b strings.Builder
+	for segment := range strings.SplitSeq(path, ".") {
+		name, rest, _ := strings.Cut(segment, "[")
+		b.WriteString("/" + pointerEscaper.Replace(name))
+		for rest != "" {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			b.WriteString("/" + index)
+			rest = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return b.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator_CollectsEveryError(t *testing.T) {
+	v := New()
+	v.String("text", "", Required(), MinLen(10), MaxLen(500))
+	v.AddError("text", CodeRequired, "must be provided")
+
+	assert.False(t, v.Valid())
+	assert.Equal(t, "must be provided", v.Errors["text"])
+	assert.Equal(t, CodeRequired, v.Codes["text"])
+	assert.Equal(t, []FieldError{
+		{Code: CodeRequired, Message: "must be provided"},
+		{Code: CodeTooShort, Message: "must be at least 10 bytes long"},
+	}, v.Fields["text"])
+}
+
+func TestRules(t *testing.T) {
+	code := regexp.MustCompile(`^[A-Z]{3}$`)
+
+	tests := []struct {
+		name  string
+		check func(v *Validator)
+		want  map[string][]FieldError
+	}{
+		{
+			name: "Valid",
+			check: func(v *Validator) {
+				v.String("code", "ABC", Required(), Regexp(code), OneOf("ABC", "DEF"))
+				v.Int("rating", 7, Required(), Range(1, 10))
+				v.Strings("tags", []string{"a", "b"}, Required(), MinLen(1), MaxLen(2), UniqueValues(), Each(NotBlank()))
+			},
+			want: map[string][]FieldError{},
+		},
+		{
+			name: "String rules",
+			check: func(v *Validator) {
+				v.String("code", "abcd", MaxLen(3), Regexp(code), OneOf("ABC", "DEF"))
+			},
+			want: map[string][]FieldError{
+				"code": {
+					{Code: CodeTooLong, Message: "must not be more than 3 bytes long"},
+					{Code: CodeInvalidFormat, Message: "is not in a valid format"},
+					{Code: CodeNotAllowed, Message: "must be one of ABC, DEF"},
+				},
+			},
+		},
+		{
+			name: "Int rules",
+			check: func(v *Validator) {
+				v.Int("year", 0, Required(), Min(1888), Max(2000).Message("must not be in the future"))
+				v.Int("rating", 11, Range(1, 10))
+			},
+			want: map[string][]FieldError{
+				"year": {
+					{Code: CodeRequired, Message: "must be provided"},
+					{Code: CodeOutOfRange, Message: "must be at least 1888"},
+				},
+				"rating": {{Code: CodeOutOfRange, Message: "must be between 1 and 10"}},
+			},
+		},
+		{
+			name: "List rules with element paths",
+			check: func(v *Validator) {
+				v.Strings("genres", []string{"drama", " ", "drama"}, MaxLen(2), UniqueValues(), Each(NotBlank(), MaxLen(4)))
+			},
+			want: map[string][]FieldError{
+				"genres": {
+					{Code: CodeTooLong, Message: "must not contain more than 2 values"},
+					{Code: CodeDuplicate, Message: "must not contain duplicate values"},
+				},
+				"genres[0]": {{Code: CodeTooLong, Message: "must not be more than 4 bytes long"}},
+				"genres[1]": {{Code: CodeRequired, Message: "must not be blank"}},
+				"genres[2]": {{Code: CodeTooLong, Message: "must not be more than 4 bytes long"}},
+			},
+		},
+		{
+			name: "Nil list is required",
+			check: func(v *Validator) {
+				v.Strings("genres", nil, Required())
+			},
+			want: map[string][]FieldError{
+				"genres": {{Code: CodeRequired, Message: "must be provided"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			tt.check(v)
+			assert.Equal(t, tt.want, v.Fields)
+			assert.Equal(t, len(tt.want) == 0, v.Valid())
+		})
+	}
+}
+
+func TestPaths(t *testing.T) {
+	assert.Equal(t, "genres[2]", Index("genres", 2))
+	assert.Equal(t, "credits[0].role", Key(Index("credits", 0), "role"))
+	assert.Equal(t, "role", Key("", "role"))
+
+	tests := map[string]string{
+		"title":               "/title",
+		"genres[2]":           "/genres/2",
+		"credits[0].role":     "/credits/0/role",
+		"matrix[1][3]":        "/matrix/1/3",
+		"a/b.c~d":             "/a~1b/c~0d",
+		"lists[0].items[4].n": "/lists/0/items/4/n",
+	}
+
+	for path, want := range tests {
+		assert.Equal(t, want, Pointer(path), path)
+	}
+}
@@ -0,0 +1,9 @@
+INSERT INTO permissions (code)
+VALUES
+    ('reviews:moderate');
+
+-- admin grants every permission, moderating reviews included, but was never
+-- seeded.
+INSERT INTO permissions (code)
+SELECT 'admin'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'admin');
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS tokens_user_id_scope_idx;
+DROP INDEX IF EXISTS tokens_session_id_idx;
+
+DELETE FROM tokens WHERE scope = 'refresh';
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS session_id,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS created_at;
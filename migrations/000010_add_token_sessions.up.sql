@@ -0,0 +1,12 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS last_used_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS session_id text;
+
+-- Tokens issued before sessions existed each become a session of their own.
+UPDATE tokens SET session_id = encode(hash, 'hex') WHERE scope = 'authentication' AND session_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_session_id_idx ON tokens (session_id);
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
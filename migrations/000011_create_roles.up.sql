@@ -0,0 +1,67 @@
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+-- Seed every permission code used by the routes.
+INSERT INTO permissions (code)
+VALUES
+    ('movies:read'),
+    ('movies:write'),
+    ('genres:read'),
+    ('genres:write'),
+    ('reviews:read'),
+    ('reviews:write'),
+    ('reviews:moderate'),
+    ('admin')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name)
+VALUES
+    ('viewer'),
+    ('critic'),
+    ('editor'),
+    ('moderator'),
+    ('admin')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM (VALUES
+    ('viewer', 'movies:read'),
+    ('viewer', 'genres:read'),
+    ('viewer', 'reviews:read'),
+    ('critic', 'movies:read'),
+    ('critic', 'genres:read'),
+    ('critic', 'reviews:read'),
+    ('critic', 'reviews:write'),
+    ('editor', 'movies:read'),
+    ('editor', 'movies:write'),
+    ('editor', 'genres:read'),
+    ('editor', 'genres:write'),
+    ('editor', 'reviews:read'),
+    ('editor', 'reviews:write'),
+    ('moderator', 'movies:read'),
+    ('moderator', 'genres:read'),
+    ('moderator', 'reviews:read'),
+    ('moderator', 'reviews:write'),
+    ('moderator', 'reviews:moderate'),
+    ('admin', 'admin')
+) AS grants (role, code)
+INNER JOIN roles ON roles.name = grants.role
+INNER JOIN permissions ON permissions.code = grants.code
+ON CONFLICT DO NOTHING;
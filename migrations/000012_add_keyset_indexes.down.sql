@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS reviews_user_created_at_idx;
+DROP INDEX IF EXISTS reviews_movie_upvotes_idx;
+DROP INDEX IF EXISTS reviews_movie_rating_idx;
+DROP INDEX IF EXISTS reviews_movie_created_at_idx;
+
+DROP INDEX IF EXISTS movies_runtime_id_idx;
+DROP INDEX IF EXISTS movies_year_id_idx;
+DROP INDEX IF EXISTS movies_title_id_idx;
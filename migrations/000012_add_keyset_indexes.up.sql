@@ -0,0 +1,8 @@
+CREATE INDEX IF NOT EXISTS movies_title_id_idx ON movies (title, id);
+CREATE INDEX IF NOT EXISTS movies_year_id_idx ON movies (year, id);
+CREATE INDEX IF NOT EXISTS movies_runtime_id_idx ON movies (runtime, id);
+
+CREATE INDEX IF NOT EXISTS reviews_movie_created_at_idx ON reviews (movie_id, created_at, id);
+CREATE INDEX IF NOT EXISTS reviews_movie_rating_idx ON reviews (movie_id, rating, id);
+CREATE INDEX IF NOT EXISTS reviews_movie_upvotes_idx ON reviews (movie_id, upvotes, id);
+CREATE INDEX IF NOT EXISTS reviews_user_created_at_idx ON reviews (user_id, created_at, id);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS people (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    birth_year integer,
+    biography text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS people_name_idx ON people USING GIN (to_tsvector('simple', name));
+CREATE INDEX IF NOT EXISTS people_lower_name_idx ON people (lower(name));
+
+CREATE TABLE IF NOT EXISTS movie_credits (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    person_id bigint NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('cast', 'director', 'writer', 'producer', 'composer', 'cinematographer', 'editor')),
+    character text NOT NULL DEFAULT '',
+    billing_order integer NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_credits_unique_idx ON movie_credits (movie_id, person_id, role, character);
+CREATE INDEX IF NOT EXISTS movie_credits_person_idx ON movie_credits (person_id, role);
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS reviews_movie_rating ON reviews;
+DROP FUNCTION IF EXISTS reviews_update_movie_rating();
+
+DROP INDEX IF EXISTS movies_average_rating_id_idx;
+
+ALTER TABLE movies
+    DROP COLUMN IF EXISTS average_rating,
+    DROP COLUMN IF EXISTS rating_histogram,
+    DROP COLUMN IF EXISTS rating_sum,
+    DROP COLUMN IF EXISTS rating_count;
@@ -0,0 +1,61 @@
+ALTER TABLE movies
+    ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rating_sum integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rating_histogram integer[] NOT NULL DEFAULT array_fill(0, ARRAY[10]),
+    ADD COLUMN IF NOT EXISTS average_rating double precision
+        GENERATED ALWAYS AS (CASE WHEN rating_count > 0 THEN rating_sum::double precision / rating_count ELSE 0 END) STORED;
+
+UPDATE movies m
+SET rating_count = s.rating_count,
+    rating_sum = s.rating_sum,
+    rating_histogram = s.rating_histogram
+FROM (
+    SELECT movie_id,
+           count(*) AS rating_count,
+           sum(rating) AS rating_sum,
+           ARRAY[
+               count(*) FILTER (WHERE rating = 1),
+               count(*) FILTER (WHERE rating = 2),
+               count(*) FILTER (WHERE rating = 3),
+               count(*) FILTER (WHERE rating = 4),
+               count(*) FILTER (WHERE rating = 5),
+               count(*) FILTER (WHERE rating = 6),
+               count(*) FILTER (WHERE rating = 7),
+               count(*) FILTER (WHERE rating = 8),
+               count(*) FILTER (WHERE rating = 9),
+               count(*) FILTER (WHERE rating = 10)
+           ]::integer[] AS rating_histogram
+    FROM reviews
+    WHERE rating BETWEEN 1 AND 10
+    GROUP BY movie_id
+) s
+WHERE m.id = s.movie_id;
+
+-- Ratings of 0 predate the 1-10 validation and are left out of the aggregates.
+CREATE OR REPLACE FUNCTION reviews_update_movie_rating() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.rating BETWEEN 1 AND 10 THEN
+        UPDATE movies
+        SET rating_count = rating_count - 1,
+            rating_sum = rating_sum - OLD.rating,
+            rating_histogram[OLD.rating] = rating_histogram[OLD.rating] - 1
+        WHERE id = OLD.movie_id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.rating BETWEEN 1 AND 10 THEN
+        UPDATE movies
+        SET rating_count = rating_count + 1,
+            rating_sum = rating_sum + NEW.rating,
+            rating_histogram[NEW.rating] = rating_histogram[NEW.rating] + 1
+        WHERE id = NEW.movie_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_movie_rating
+AFTER INSERT OR DELETE OR UPDATE OF rating, movie_id ON reviews
+FOR EACH ROW EXECUTE FUNCTION reviews_update_movie_rating();
+
+CREATE INDEX IF NOT EXISTS movies_average_rating_id_idx ON movies (average_rating, id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS list_items;
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS diary_entries;
+DROP TABLE IF EXISTS watchlist;
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS watchlist (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS watchlist_user_added_idx ON watchlist (user_id, added_at);
+
+CREATE TABLE IF NOT EXISTS diary_entries (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    watched_on date NOT NULL DEFAULT CURRENT_DATE,
+    rewatch boolean NOT NULL DEFAULT false,
+    rating smallint CHECK (rating BETWEEN 1 AND 10),
+    notes text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS diary_entries_user_watched_idx ON diary_entries (user_id, watched_on, id);
+CREATE INDEX IF NOT EXISTS diary_entries_user_movie_idx ON diary_entries (user_id, movie_id);
+
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    public boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS lists_user_idx ON lists (user_id);
+
+CREATE TABLE IF NOT EXISTS list_items (
+    list_id bigint NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    position integer NOT NULL,
+    note text NOT NULL DEFAULT '',
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_items_position_idx ON list_items (list_id, position);
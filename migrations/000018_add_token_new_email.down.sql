@@ -0,0 +1,2 @@
+DELETE FROM tokens WHERE scope = 'email-change';
+ALTER TABLE tokens DROP COLUMN IF EXISTS new_email;
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS users_release_review_votes ON users;
+DROP FUNCTION IF EXISTS users_release_review_votes();
+DROP TABLE IF EXISTS data_exports;
+DROP INDEX IF EXISTS users_deletion_scheduled_idx;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deletion_scheduled_for,
+    DROP COLUMN IF EXISTS deletion_mode,
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,41 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deletion_scheduled_for timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS deletion_mode text CHECK (deletion_mode IN ('anonymize', 'delete')),
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_deletion_scheduled_idx ON users (deletion_scheduled_for) WHERE deletion_scheduled_for IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS data_exports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready')),
+    archive jsonb,
+    download_hash bytea UNIQUE,
+    completed_at timestamp(0) with time zone,
+    expires_at timestamp(0) with time zone
+);
+
+-- A user has at most one export waiting to be built; asking again returns it.
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_pending_user_idx ON data_exports (user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS data_exports_expires_idx ON data_exports (expires_at) WHERE status = 'ready';
+
+-- reviews.upvotes and reviews.downvotes are maintained by the application when
+-- a vote is cast, but votes removed by the ON DELETE CASCADE from users would
+-- leave them counted. Take a deleted user's votes off other users' reviews
+-- before the cascade removes them; the user's own reviews go with the user.
+CREATE OR REPLACE FUNCTION users_release_review_votes() RETURNS trigger AS $$
+BEGIN
+    UPDATE reviews r
+    SET upvotes = GREATEST(0, r.upvotes - (v.vote_type = 1)::integer),
+        downvotes = GREATEST(0, r.downvotes - (v.vote_type = -1)::integer)
+    FROM review_votes v
+    WHERE v.review_id = r.id AND v.user_id = OLD.id AND r.user_id <> OLD.id;
+
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_release_review_votes
+BEFORE DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION users_release_review_votes();
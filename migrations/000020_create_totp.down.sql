@@ -0,0 +1,3 @@
+DELETE FROM tokens WHERE scope = '2fa-pending';
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,13 @@
+-- Failed sign-in attempts per email address and per client IP, and requests
+-- for emails per address. Rows are keyed by address rather than user, so
+-- unknown addresses are throttled like known ones.
+CREATE TABLE IF NOT EXISTS auth_failures (
+    kind text NOT NULL CHECK (kind IN ('email', 'ip', 'mail')),
+    subject text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp with time zone,
+    PRIMARY KEY (kind, subject)
+);
+
+CREATE INDEX IF NOT EXISTS auth_failures_last_failure_idx ON auth_failures (last_failure_at);
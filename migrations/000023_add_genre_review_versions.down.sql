@@ -0,0 +1,2 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS version;
+ALTER TABLE genres DROP COLUMN IF EXISTS version;
@@ -0,0 +1,2 @@
+ALTER TABLE genres ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+-- The catalogue-wide mean rating the weighted rating is built from. Summing
+-- every movie on each read is too slow, and keeping the totals up to date from
+-- the review trigger would make every review write update this one row, so it
+-- is recomputed periodically by the background jobs instead. The mean moves
+-- slowly, so being a minute behind doesn't change any ranking noticeably.
+CREATE TABLE IF NOT EXISTS rating_stats (
+    id boolean PRIMARY KEY DEFAULT true CHECK (id),
+    mean double precision NOT NULL DEFAULT 0,
+    refreshed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO rating_stats (mean)
+SELECT COALESCE(sum(rating_sum)::double precision / NULLIF(sum(rating_count), 0), 0) FROM movies
+ON CONFLICT (id) DO NOTHING;
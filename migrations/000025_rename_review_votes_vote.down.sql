@@ -0,0 +1,7 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'review_votes' AND column_name = 'vote_type') THEN
+        ALTER TABLE review_votes RENAME COLUMN vote_type TO vote;
+    END IF;
+END;
+$$;
@@ -0,0 +1,10 @@
+-- The application has always used vote_type; databases created from 000008
+-- have the column as vote. The users_release_review_votes trigger from 000019
+-- already refers to vote_type, which PL/pgSQL only resolves when it runs.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'review_votes' AND column_name = 'vote') THEN
+        ALTER TABLE review_votes RENAME COLUMN vote TO vote_type;
+    END IF;
+END;
+$$;